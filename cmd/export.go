@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pmaterer/meta/slip/archive"
+)
+
+const exportUsage = `usage: meta export [-server URL] [-format markdown] -out PATH
+
+Writes one Markdown file per slip, with YAML front matter, into the directory
+PATH or, when PATH ends in .zip, into a zip file. An -out of - writes the zip
+to stdout.`
+
+// runExport carries out `meta export`.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), exportUsage) }
+	server := flags.String("server", os.Getenv("META_SERVER_URL"), "URL of a running meta server")
+	format := flags.String("format", "markdown", "export format; only markdown so far")
+	out := flags.String("out", "", "directory or .zip file to write, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || flags.NArg() > 0 {
+		return errors.New(exportUsage)
+	}
+	if *format != "markdown" {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+
+	return withSlips(*server, func(ctx context.Context, s slips) error {
+		switch {
+		case *out == "-":
+			return archive.ExportMarkdownZip(ctx, s, os.Stdout)
+		case strings.HasSuffix(*out, ".zip"):
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			if err := archive.ExportMarkdownZip(ctx, s, f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		default:
+			return archive.ExportMarkdownDir(ctx, s, *out)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pmaterer/meta/slip"
+	"github.com/pmaterer/meta/slip/archive"
+)
+
+const importUsage = `usage: meta import [-server URL] [-format FORMAT] [-dry-run] PATH
+
+Imports every slip in PATH at once, or none if any of them is refused. With
+-dry-run the slips are only checked. PATH is one of:
+
+  markdown  a directory or zip of Markdown files, as written by meta export
+  json      a JSON array of slips
+  csv       CSV with a header row naming the columns body, tags, created_at
+            and updated_at
+  enex      an Evernote export
+  keep      a Google Takeout zip, or its unpacked Keep directory
+
+The format is worked out from PATH unless given; keep must always be given.`
+
+// runImport carries out `meta import`.
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), importUsage) }
+	server := flags.String("server", os.Getenv("META_SERVER_URL"), "URL of a running meta server")
+	format := flags.String("format", "", "import format: markdown, json, csv, enex or keep")
+	dryRun := flags.Bool("dry-run", false, "check the slips without importing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+	items, err := readImport(flags.Arg(0), *format)
+	if err != nil {
+		return err
+	}
+
+	return withSlips(*server, func(ctx context.Context, s slips) error {
+		report, err := s.ImportSlips(ctx, items, *dryRun)
+		if err != nil {
+			return err
+		}
+		return printImportReport(report)
+	})
+}
+
+// readImport reads the slips in path, in the given format or else the one
+// its name suggests.
+func readImport(path, format string) ([]slip.ImportItem, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		switch format {
+		case "", archive.FormatMarkdown:
+			return archive.ReadMarkdownDir(path)
+		case archive.FormatKeep:
+			return archive.ReadKeepDir(path)
+		}
+		return nil, fmt.Errorf("%s is a directory, so it can only be imported as markdown or keep", path)
+	}
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".zip":
+			format = archive.FormatMarkdown
+		case ".json":
+			format = archive.FormatJSON
+		case ".csv":
+			format = archive.FormatCSV
+		case ".enex":
+			format = archive.FormatENEX
+		default:
+			return nil, fmt.Errorf("cannot tell the format of %s; give it with -format", path)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return archive.Read(format, data)
+}
+
+// printImportReport lists the items that were refused, or says how many
+// slips were imported.
+func printImportReport(report slip.ImportReport) error {
+	if report.Failed > 0 {
+		w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+		for _, result := range report.Results {
+			if result.Error != "" {
+				fmt.Fprintf(w, "%s\t%s\n", result.Source, result.Error)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d of %d slips refused; nothing imported", report.Failed, len(report.Results))
+	}
+	if report.DryRun {
+		fmt.Printf("%d slips would be imported\n", len(report.Results))
+		return nil
+	}
+	fmt.Printf("%d slips imported\n", report.Imported)
+	return nil
+}
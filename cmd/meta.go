@@ -1,40 +1,112 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
+	"os"
 
-	"github.com/gin-gonic/gin"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pmaterer/meta/config"
+	schema "github.com/pmaterer/meta/db"
+	"github.com/pmaterer/meta/internal/migrate"
 	"github.com/pmaterer/meta/internal/postgres"
-	"github.com/pmaterer/meta/slip/delivery/http"
+	"github.com/pmaterer/meta/internal/sqlite"
 	"github.com/pmaterer/meta/slip/repository"
 	"github.com/pmaterer/meta/slip/service"
+	userrepository "github.com/pmaterer/meta/user/repository"
+	userservice "github.com/pmaterer/meta/user/service"
 )
 
+const usage = `usage: meta <command> [arguments]
+
+Commands:
+  serve                            run the HTTP server (the default)
+  migrate up|down|status|goto N    move the database schema between versions
+  slip add|ls|show|edit|rm         work with slips from the terminal
+  export -out PATH                 export every slip as Markdown
+  import [-dry-run] PATH           import slips from Markdown, JSON, CSV,
+                                   Evernote or Google Keep
+  token create|ls|revoke           manage the API tokens of users
+
+Run "meta slip" for the slip commands.`
+
 func main() {
-	var config config.Config
-	err := envconfig.Process("meta", &config)
-	if err != nil {
-		log.Fatal(err.Error())
+	log.SetFlags(0)
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	db, err := postgres.NewHandler(config)
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "migrate":
+		err = withDatabase(func(config config.Config, m *migrate.Migrator, _ *service.Service, _ *userservice.Service) error {
+			return runMigrate(context.Background(), m, args)
+		})
+	case "slip":
+		err = runSlip(args)
+	case "export":
+		err = runExport(args)
+	case "import":
+		err = runImport(args)
+	case "token":
+		err = runToken(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Println(usage)
+	default:
+		err = fmt.Errorf("unknown command %q\n\n%s", command, usage)
+	}
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+}
 
-	slipRepo := repository.NewRepository(db)
-	slipService := service.NewService(slipRepo)
-	slipHandler := http.NewHandler(slipService)
-
-	r := gin.Default()
-	r.POST("/slips", slipHandler.CreateSlip)
-	r.GET("/slips/:id", slipHandler.GetSlip)
-	r.GET("/slips", slipHandler.GetAllSlips)
-	r.PUT("/slips/:id", slipHandler.UpdateSlip)
-	r.DELETE("/slips/:id", slipHandler.DeleteSlip)
+// withDatabase loads the configuration from the environment, connects to the
+// configured database and calls fn with a migrator for it and the slip and
+// user services backed by it. The memory driver has no database and so no
+// migrator.
+func withDatabase(fn func(config.Config, *migrate.Migrator, *service.Service, *userservice.Service) error) error {
+	var config config.Config
+	if err := envconfig.Process("meta", &config); err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
 
-	log.Fatal(r.Run(fmt.Sprintf("%s:%d", config.ServerListenAddress, config.ServerListenPort)))
+	var db *sql.DB
+	var migrator *migrate.Migrator
+	var slipService *service.Service
+	var userService *userservice.Service
+	var err error
+	switch config.DatabaseDriver {
+	case "postgres":
+		if db, err = postgres.NewHandler(config); err != nil {
+			return err
+		}
+		migrator, err = migrate.New(db, migrate.Postgres, schema.Migrations, "migrations")
+		slipService = service.NewService(repository.NewPostgresRepository(db))
+		userService = userservice.NewService(userrepository.NewPostgresRepository(db))
+	case "sqlite":
+		if db, err = sqlite.NewHandler(config); err != nil {
+			return err
+		}
+		migrator, err = migrate.New(db, migrate.SQLite, schema.Migrations, "sqlite")
+		slipService = service.NewService(repository.NewSQLiteRepository(db))
+		userService = userservice.NewService(userrepository.NewSQLiteRepository(db))
+	case "memory":
+		return fn(config, nil, service.NewService(repository.NewMemoryRepository()),
+			userservice.NewService(userrepository.NewMemoryRepository()))
+	default:
+		return fmt.Errorf("unknown database driver %q: use postgres, sqlite or memory", config.DatabaseDriver)
+	}
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	return fn(config, migrator, slipService, userService)
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/pmaterer/meta/internal/migrate"
+)
+
+const migrateUsage = "usage: meta migrate up|down|status|goto VERSION"
+
+// runMigrate carries out `meta migrate`: up applies every pending migration,
+// down reverts the latest one, goto moves to a given version and status
+// shows where the schema stands.
+func runMigrate(ctx context.Context, m *migrate.Migrator, args []string) error {
+	if m == nil {
+		return errors.New("the memory database driver has no schema to migrate")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "goto":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("goto: %w", err)
+		}
+		return m.Goto(ctx, version)
+	case "status":
+		current, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema version %d, latest %d\n", current, m.Latest())
+		for _, migration := range m.Migrations() {
+			state := "pending"
+			if migration.Version <= current {
+				state = "applied"
+			}
+			fmt.Printf("  %06d_%s\t%s\n", migration.Version, migration.Name, state)
+		}
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
+
+// checkSchema refuses to run against a schema older than this build expects,
+// first migrating it if asked to.
+func checkSchema(ctx context.Context, m *migrate.Migrator, migrateFirst bool) error {
+	if m == nil {
+		return nil
+	}
+	if migrateFirst {
+		if err := m.Up(ctx); err != nil {
+			return err
+		}
+	}
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if current < m.Latest() {
+		return fmt.Errorf("database schema is at version %d but this build needs %d: run `meta migrate up`",
+			current, m.Latest())
+	}
+	return nil
+}
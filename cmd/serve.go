@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/config"
+	"github.com/pmaterer/meta/internal/migrate"
+	"github.com/pmaterer/meta/slip/delivery/http"
+	"github.com/pmaterer/meta/slip/delivery/web"
+	"github.com/pmaterer/meta/slip/service"
+	userhttp "github.com/pmaterer/meta/user/delivery/http"
+	userservice "github.com/pmaterer/meta/user/service"
+)
+
+// runServe carries out `meta serve`, running the HTTP server until it fails.
+func runServe(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: meta serve")
+	}
+	return withDatabase(func(config config.Config, migrator *migrate.Migrator, slipService *service.Service, userService *userservice.Service) error {
+		if err := checkSchema(context.Background(), migrator, config.MigrateOnStartup); err != nil {
+			return err
+		}
+		if !config.RequireAuth && !isLoopback(config.ServerListenAddress) {
+			log.Printf("warning: listening on %s without META_REQUIRE_AUTH, so anyone who can reach it may read and change every slip", config.ServerListenAddress)
+		}
+
+		slipHandler := http.NewHandler(slipService)
+		webHandler := web.NewHandler(slipService)
+		userHandler := userhttp.NewHandler(userService)
+
+		if config.TrashRetention > 0 {
+			go slipService.PurgeTrashEvery(context.Background(), config.TrashPurgeInterval, config.TrashRetention)
+		}
+
+		r := gin.Default()
+		r.GET("/", webHandler.Home)
+
+		// Exports, imports and the graph read or write the whole notebook,
+		// so only the other routes are held to the query timeout.
+		api := r.Group("", userHandler.Authenticate(config.RequireAuth))
+		api.GET("/export", slipHandler.Export)
+		api.POST("/import", slipHandler.Import)
+		api.GET("/graph", slipHandler.Graph)
+
+		timed := api.Group("", http.Timeout(config.QueryTimeout))
+		timed.POST("/slips", slipHandler.CreateSlip)
+		timed.POST("/slips/batch", slipHandler.BatchSlips)
+		timed.GET("/slips/search", slipHandler.SearchSlips)
+		timed.GET("/slips/:id", slipHandler.GetSlip)
+		timed.GET("/slips", slipHandler.GetAllSlips)
+		timed.PUT("/slips/:id", slipHandler.UpdateSlip)
+		timed.PATCH("/slips/:id", slipHandler.PatchSlip)
+		timed.DELETE("/slips/:id", slipHandler.DeleteSlip)
+		timed.GET("/slips/:id/revisions", slipHandler.GetRevisions)
+		timed.GET("/slips/:id/revisions/:rev", slipHandler.GetRevision)
+		timed.POST("/slips/:id/revisions/:rev/restore", slipHandler.RestoreRevision)
+		timed.GET("/slips/:id/diff", slipHandler.DiffRevisions)
+		timed.GET("/slips/:id/links", slipHandler.GetLinks)
+		timed.GET("/slips/:id/backlinks", slipHandler.GetBacklinks)
+		timed.GET("/trash", slipHandler.GetTrash)
+		timed.POST("/trash/:id/restore", slipHandler.RestoreSlip)
+		timed.DELETE("/trash/:id", slipHandler.PurgeSlip)
+		timed.GET("/tags", slipHandler.GetTags)
+		timed.POST("/tags/merge", slipHandler.MergeTags)
+		timed.POST("/tags/:name/rename", slipHandler.RenameTag)
+		timed.POST("/tokens", userHandler.CreateToken)
+		timed.GET("/tokens", userHandler.GetTokens)
+		timed.DELETE("/tokens/:id", userHandler.RevokeToken)
+
+		// Only the pages take basic credentials, which browsers send on
+		// their own; they are kept to same-site forms by CheckForgery.
+		ui := r.Group("/ui", userHandler.AuthenticateBrowser(config.RequireAuth), http.Timeout(config.QueryTimeout), webHandler.CheckForgery)
+		ui.StaticFS("/static", web.Static())
+		ui.GET("/", webHandler.List)
+		ui.GET("/slips/new", webHandler.New)
+		ui.POST("/slips", webHandler.Create)
+		ui.GET("/slips/:id", webHandler.Show)
+		ui.POST("/slips/:id", webHandler.Update)
+		ui.GET("/slips/:id/edit", webHandler.Edit)
+		ui.GET("/slips/:id/delete", webHandler.ConfirmDelete)
+		ui.POST("/slips/:id/delete", webHandler.Delete)
+
+		return r.Run(fmt.Sprintf("%s:%d", config.ServerListenAddress, config.ServerListenPort))
+	})
+}
+
+// isLoopback reports whether the listen address only accepts connections
+// from this machine.
+func isLoopback(address string) bool {
+	if address == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
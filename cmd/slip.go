@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/pmaterer/meta/config"
+	"github.com/pmaterer/meta/internal/migrate"
+	"github.com/pmaterer/meta/slip"
+	"github.com/pmaterer/meta/slip/client"
+	"github.com/pmaterer/meta/slip/service"
+	userservice "github.com/pmaterer/meta/user/service"
+)
+
+// slips is what the slip commands need, provided either by a client of a
+// running server or by a service working on the database directly.
+type slips interface {
+	CreateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	GetSlip(ctx context.Context, id int64) (slip.Slip, error)
+	GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error)
+	UpdateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	DeleteSlip(ctx context.Context, id, version int64) error
+	ImportSlips(ctx context.Context, items []slip.ImportItem, dryRun bool) (slip.ImportReport, error)
+}
+
+type slipCommand func(ctx context.Context, s slips, args []string) error
+
+var slipCommands = map[string]slipCommand{
+	"add":  slipAdd,
+	"ls":   slipList,
+	"show": slipShow,
+	"edit": slipEdit,
+	"rm":   slipRemove,
+}
+
+const slipUsage = `usage: meta slip [-server URL] <command> [arguments]
+
+Commands:
+  add [-title T] [-tag T]... [BODY...]   add a slip; without BODY it is read
+                                         from stdin or written in $EDITOR
+  ls [-tag T]... [-any T]... [-not T]... [-n N]
+                                         list slips, oldest first
+  show ID                                print a slip
+  edit ID                                edit a slip's body in $EDITOR
+  rm ID...                               move slips to the trash
+
+With -server, or META_SERVER_URL, the commands talk to a running server,
+sending the token in META_TOKEN if it is set. Otherwise they use the
+database configured for meta serve.`
+
+// runSlip carries out `meta slip`.
+func runSlip(args []string) error {
+	flags := flag.NewFlagSet("slip", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), slipUsage) }
+	server := flags.String("server", os.Getenv("META_SERVER_URL"), "URL of a running meta server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New(slipUsage)
+	}
+	command, ok := slipCommands[flags.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown slip command %q\n\n%s", flags.Arg(0), slipUsage)
+	}
+	args = flags.Args()[1:]
+	return withSlips(*server, func(ctx context.Context, s slips) error {
+		return command(ctx, s, args)
+	})
+}
+
+// withSlips calls fn with a client of the server at the given URL or, with
+// no URL, a service using the configured database directly. The context is
+// cancelled by an interrupt.
+func withSlips(server string, fn func(context.Context, slips) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if server != "" {
+		return fn(ctx, client.NewClient(server, nil).WithToken(os.Getenv("META_TOKEN")))
+	}
+	return withDatabase(func(config config.Config, migrator *migrate.Migrator, slipService *service.Service, _ *userservice.Service) error {
+		if err := checkSchema(ctx, migrator, false); err != nil {
+			return err
+		}
+		return fn(ctx, slipService)
+	})
+}
+
+// tagFlags collects a flag that may be given more than once.
+type tagFlags []string
+
+func (t *tagFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagFlags) Set(tag string) error {
+	*t = append(*t, tag)
+	return nil
+}
+
+func slipAdd(ctx context.Context, s slips, args []string) error {
+	flags := flag.NewFlagSet("slip add", flag.ContinueOnError)
+	var tags tagFlags
+	flags.Var(&tags, "tag", "tag the slip; may be repeated")
+	title := flags.String("title", "", "title the slip, rather than taking the title from its first line")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	body := strings.Join(flags.Args(), " ")
+	if body == "" {
+		var err error
+		if isTerminal(os.Stdin) {
+			body, err = editText("slip-*.md", "")
+		} else {
+			var data []byte
+			data, err = ioutil.ReadAll(os.Stdin)
+			body = strings.TrimSuffix(string(data), "\n")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		return errors.New("not adding an empty slip")
+	}
+
+	created, err := s.CreateSlip(ctx, slip.Slip{Title: *title, Body: body, Tags: tags})
+	if err != nil {
+		return err
+	}
+	fmt.Println(created.ID)
+	return nil
+}
+
+func slipList(ctx context.Context, s slips, args []string) error {
+	flags := flag.NewFlagSet("slip ls", flag.ContinueOnError)
+	var opts slip.ListOptions
+	flags.Var((*tagFlags)(&opts.Tags), "tag", "only slips with this tag; may be repeated")
+	flags.Var((*tagFlags)(&opts.AnyTags), "any", "only slips with any of these tags; may be repeated")
+	flags.Var((*tagFlags)(&opts.NotTags), "not", "no slips with this tag; may be repeated")
+	n := flags.Int("n", slip.DefaultPageLimit, "list at most this many slips; 0 lists them all")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUPDATED\tTAGS\tBODY")
+	listed := 0
+	for {
+		opts.Limit = slip.MaxPageLimit
+		if *n > 0 && *n-listed < opts.Limit {
+			opts.Limit = *n - listed
+		}
+		page, err := s.GetAllSlips(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, sl := range page.Slips {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n",
+				sl.ID, sl.UpdatedAt.Local().Format("2006-01-02 15:04"), strings.Join(sl.Tags, ","), summary(sl.Body, 60))
+		}
+		listed += len(page.Slips)
+		if page.Next == nil || (*n > 0 && listed >= *n) {
+			break
+		}
+		opts.After = page.Next
+	}
+	return w.Flush()
+}
+
+func slipShow(ctx context.Context, s slips, args []string) error {
+	id, err := idArg(args)
+	if err != nil {
+		return err
+	}
+	sl, err := s.GetSlip(ctx, id)
+	if err != nil {
+		return err
+	}
+	tags := append([]string(nil), sl.Tags...)
+	sort.Strings(tags)
+	fmt.Printf("id:      %d\n", sl.ID)
+	fmt.Printf("title:   %s\n", sl.Title)
+	fmt.Printf("version: %d\n", sl.Version)
+	fmt.Printf("created: %s\n", sl.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("updated: %s\n", sl.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("tags:    %s\n\n", strings.Join(tags, ", "))
+	fmt.Println(sl.Body)
+	return nil
+}
+
+// slipEdit opens a slip's body in the user's editor and saves it if it
+// changed. The update is conditional on the version that was edited, so
+// changes made elsewhere in the meantime are not overwritten.
+func slipEdit(ctx context.Context, s slips, args []string) error {
+	id, err := idArg(args)
+	if err != nil {
+		return err
+	}
+	sl, err := s.GetSlip(ctx, id)
+	if err != nil {
+		return err
+	}
+	body, err := editText(fmt.Sprintf("slip-%d-*.md", id), sl.Body)
+	if err != nil {
+		return err
+	}
+	if body == sl.Body {
+		fmt.Printf("slip %d unchanged\n", id)
+		return nil
+	}
+	sl.Body = body
+	updated, err := s.UpdateSlip(ctx, sl)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("slip %d saved at version %d\n", updated.ID, updated.Version)
+	return nil
+}
+
+func slipRemove(ctx context.Context, s slips, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: meta slip rm ID...")
+	}
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("slip id %q: %w", arg, err)
+		}
+		if err := s.DeleteSlip(ctx, id, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func idArg(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected a single slip id")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("slip id %q: %w", args[0], err)
+	}
+	return id, nil
+}
+
+// summary is the first line of body, cut to at most width characters.
+func summary(body string, width int) string {
+	line, _ := bufio.NewReader(strings.NewReader(body)).ReadString('\n')
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	return string([]rune(line)[:width-1]) + "…"
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// editText lets the user edit text in $VISUAL or $EDITOR, falling back to vi,
+// and returns the result without the trailing newline editors add.
+func editText(pattern, text string) (string, error) {
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.WriteString(f, text+"\n"); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Run the editor through the shell so settings like "code --wait" work.
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor: %w", err)
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
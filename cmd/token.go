@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pmaterer/meta/config"
+	"github.com/pmaterer/meta/internal/migrate"
+	"github.com/pmaterer/meta/slip/service"
+	"github.com/pmaterer/meta/user"
+	userservice "github.com/pmaterer/meta/user/service"
+)
+
+type tokenCommand func(ctx context.Context, s *userservice.Service, args []string) error
+
+var tokenCommands = map[string]tokenCommand{
+	"create": tokenCreate,
+	"ls":     tokenList,
+	"revoke": tokenRevoke,
+}
+
+const tokenUsage = `usage: meta token <command> [arguments]
+
+Commands:
+  create -user NAME [-name LABEL]   create an API token for a user, adding
+                                    the user first if need be
+  ls -user NAME                     list a user's tokens
+  revoke -user NAME ID...           revoke tokens of a user
+
+The commands work on the database configured for meta serve. Clients send
+a token as "Authorization: Bearer TOKEN"; the slip commands send the one in
+META_TOKEN.`
+
+// runToken carries out `meta token`.
+func runToken(args []string) error {
+	if len(args) == 0 {
+		return errors.New(tokenUsage)
+	}
+	command, ok := tokenCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown token command %q\n\n%s", args[0], tokenUsage)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return withDatabase(func(config config.Config, migrator *migrate.Migrator, _ *service.Service, userService *userservice.Service) error {
+		if migrator == nil {
+			return errors.New("the memory database driver forgets tokens when meta exits: use postgres or sqlite")
+		}
+		if err := checkSchema(ctx, migrator, false); err != nil {
+			return err
+		}
+		return command(ctx, userService, args[1:])
+	})
+}
+
+// tokenCreate prints the new token alone on stdout, so that it can be
+// captured by a script, and what it is on stderr.
+func tokenCreate(ctx context.Context, s *userservice.Service, args []string) error {
+	flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+	userName := flags.String("user", "", "the user the token is for")
+	name := flags.String("name", "", "what the token is for, such as the machine it is used on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userName == "" || flags.NArg() > 0 {
+		return errors.New("usage: meta token create -user NAME [-name LABEL]")
+	}
+	u, err := s.EnsureUser(ctx, *userName)
+	if err != nil {
+		return err
+	}
+	created, err := s.CreateToken(ctx, u.ID, *name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(created.Secret)
+	fmt.Fprintf(os.Stderr, "Token %d for %s. It cannot be shown again.\n", created.ID, u.Name)
+	return nil
+}
+
+func tokenList(ctx context.Context, s *userservice.Service, args []string) error {
+	u, rest, err := tokenUser(ctx, s, "ls", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments %q", rest)
+	}
+	tokens, err := s.GetTokens(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tLAST USED\tNAME")
+	for _, t := range tokens {
+		lastUsed := "never"
+		if t.LastUsedAt != nil {
+			lastUsed = t.LastUsedAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.CreatedAt.Local().Format("2006-01-02 15:04"), lastUsed, t.Name)
+	}
+	return w.Flush()
+}
+
+func tokenRevoke(ctx context.Context, s *userservice.Service, args []string) error {
+	u, ids, err := tokenUser(ctx, s, "revoke", args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return errors.New("usage: meta token revoke -user NAME ID...")
+	}
+	for _, arg := range ids {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("token id %q: %w", arg, err)
+		}
+		if err := s.RevokeToken(ctx, u.ID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokenUser parses the -user flag of a token command and looks the user up,
+// returning the arguments after the flags.
+func tokenUser(ctx context.Context, s *userservice.Service, command string, args []string) (user.User, []string, error) {
+	flags := flag.NewFlagSet("token "+command, flag.ContinueOnError)
+	userName := flags.String("user", "", "the user whose tokens to work on")
+	if err := flags.Parse(args); err != nil {
+		return user.User{}, nil, err
+	}
+	if *userName == "" {
+		return user.User{}, nil, fmt.Errorf("meta token %s needs -user NAME", command)
+	}
+	u, err := s.GetUser(ctx, *userName)
+	return u, flags.Args(), err
+}
@@ -1,12 +1,50 @@
 package config
 
+import (
+	"errors"
+	"time"
+)
+
 type Config struct {
 	ServerListenAddress string `default:"localhost"`
 	ServerListenPort    int64  `default:"9999"`
-	DatabaseName        string `required:"true" split_words:"true"`
-	DatabaseUser        string `required:"true" split_words:"true"`
-	DatabasePassword    string `required:"true" split_words:"true"`
-	DatabasePort        int64  `default:"5432"`
-	DatabaseHost        string `default:"localhost"`
-	DatabaseSSLMode     string `default:"disable"`
+	// DatabaseDriver is "postgres", "sqlite" or "memory". Postgres needs the
+	// name, user and password settings below; SQLite only DatabasePath. The
+	// memory driver keeps slips only until the process exits.
+	DatabaseDriver   string `default:"postgres" split_words:"true"`
+	DatabasePath     string `default:"meta.db" split_words:"true"`
+	DatabaseName     string `split_words:"true"`
+	DatabaseUser     string `split_words:"true"`
+	DatabasePassword string `split_words:"true"`
+	DatabasePort     int64  `default:"5432"`
+	DatabaseHost     string `default:"localhost"`
+	DatabaseSSLMode  string `default:"disable"`
+	// MigrateOnStartup applies pending schema migrations before serving.
+	// Without it the server refuses to start against an older schema.
+	MigrateOnStartup bool `split_words:"true"`
+	// QueryTimeout bounds how long a request may spend, database queries
+	// included. Exports, imports and the graph are exempt. Zero means no
+	// limit.
+	QueryTimeout time.Duration `default:"30s" split_words:"true"`
+	// TrashRetention is how long deleted slips stay in the trash before
+	// they are purged. Zero keeps them forever.
+	TrashRetention time.Duration `default:"720h" split_words:"true"`
+	// TrashPurgeInterval is how often the trash is checked for slips to
+	// purge. It must be positive unless TrashRetention is zero.
+	TrashPurgeInterval time.Duration `default:"1h" split_words:"true"`
+	// RequireAuth refuses requests that do not carry an API token. Without
+	// it anyone who can reach the server may use it, so set it before
+	// listening beyond localhost.
+	RequireAuth bool `split_words:"true"`
+}
+
+// Validate rejects settings that cannot work together.
+func (c Config) Validate() error {
+	if c.TrashRetention < 0 {
+		return errors.New("META_TRASH_RETENTION must not be negative; use 0 to keep deleted slips forever")
+	}
+	if c.TrashRetention > 0 && c.TrashPurgeInterval <= 0 {
+		return errors.New("META_TRASH_PURGE_INTERVAL must be positive while META_TRASH_RETENTION is set")
+	}
+	return nil
 }
@@ -0,0 +1,16 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Config{TrashRetention: 720 * time.Hour, TrashPurgeInterval: time.Hour}.Validate())
+	assert.NoError(t, Config{TrashRetention: 0, TrashPurgeInterval: 0}.Validate(), "nothing is purged")
+	assert.Error(t, Config{TrashRetention: time.Hour, TrashPurgeInterval: 0}.Validate())
+	assert.Error(t, Config{TrashRetention: time.Hour, TrashPurgeInterval: -time.Minute}.Validate())
+	assert.Error(t, Config{TrashRetention: -time.Hour, TrashPurgeInterval: time.Hour}.Validate())
+}
@@ -0,0 +1,12 @@
+// Package db holds the database schema migrations, embedded so the meta
+// binary can apply them itself.
+package db
+
+import "embed"
+
+// Migrations contains the Postgres migrations in migrations/ and the SQLite
+// ones in sqlite/, named NNNNNN_description.up.sql and
+// NNNNNN_description.down.sql.
+//
+//go:embed migrations/*.sql sqlite/*.sql
+var Migrations embed.FS
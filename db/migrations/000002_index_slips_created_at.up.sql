@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS slips_created_at_id_idx ON slips (created_at, id);
\ No newline at end of file
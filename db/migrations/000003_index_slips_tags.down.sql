@@ -0,0 +1 @@
+DROP INDEX IF EXISTS slips_tags_idx;
\ No newline at end of file
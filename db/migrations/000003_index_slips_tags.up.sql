@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS slips_tags_idx ON slips USING GIN (tags);
\ No newline at end of file
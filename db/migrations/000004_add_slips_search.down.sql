@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS slips_search_idx;
+ALTER TABLE slips DROP COLUMN IF EXISTS search;
\ No newline at end of file
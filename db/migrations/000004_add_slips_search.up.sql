@@ -0,0 +1,4 @@
+ALTER TABLE slips ADD COLUMN IF NOT EXISTS search TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('english', COALESCE(body, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS slips_search_idx ON slips USING GIN (search);
\ No newline at end of file
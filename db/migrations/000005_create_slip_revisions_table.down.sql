@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS record_revision_on_update ON slips;
+DROP TRIGGER IF EXISTS record_revision_on_insert ON slips;
+DROP FUNCTION IF EXISTS trigger_record_revision();
+DROP TABLE IF EXISTS slip_revisions;
\ No newline at end of file
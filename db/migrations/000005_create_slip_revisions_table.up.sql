@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS slip_revisions (
+    slip_id INTEGER NOT NULL REFERENCES slips (id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    body TEXT,
+    tags TEXT [],
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (slip_id, revision)
+);
+
+INSERT INTO slip_revisions (slip_id, revision, body, tags, created_at)
+SELECT id, 1, body, tags, updated_at FROM slips
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION trigger_record_revision()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO slip_revisions (slip_id, revision, body, tags)
+    SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, NEW.body, NEW.tags
+    FROM slip_revisions
+    WHERE slip_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER record_revision_on_insert
+AFTER INSERT on slips
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_record_revision();
+
+CREATE TRIGGER record_revision_on_update
+AFTER UPDATE on slips
+FOR EACH ROW
+WHEN (OLD.body IS DISTINCT FROM NEW.body OR OLD.tags IS DISTINCT FROM NEW.tags)
+EXECUTE PROCEDURE trigger_record_revision();
\ No newline at end of file
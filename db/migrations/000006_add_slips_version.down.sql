@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS increment_version ON slips;
+DROP FUNCTION IF EXISTS trigger_increment_version();
+ALTER TABLE slips DROP COLUMN IF EXISTS version;
\ No newline at end of file
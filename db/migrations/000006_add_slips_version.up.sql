@@ -0,0 +1,14 @@
+ALTER TABLE slips ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION trigger_increment_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER increment_version
+BEFORE UPDATE on slips
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_increment_version();
\ No newline at end of file
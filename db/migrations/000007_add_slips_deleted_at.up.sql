@@ -0,0 +1,3 @@
+ALTER TABLE slips ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS slips_deleted_at_idx ON slips (deleted_at) WHERE deleted_at IS NOT NULL;
\ No newline at end of file
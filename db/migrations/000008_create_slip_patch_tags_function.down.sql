@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS slip_patch_tags(TEXT [], TEXT [], TEXT []);
\ No newline at end of file
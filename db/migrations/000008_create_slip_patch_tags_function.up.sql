@@ -0,0 +1,17 @@
+CREATE OR REPLACE FUNCTION slip_patch_tags(tags TEXT [], additions TEXT [], removals TEXT [])
+RETURNS TEXT [] AS $$
+DECLARE
+    tag TEXT;
+BEGIN
+    tags := COALESCE(tags, '{}');
+    FOREACH tag IN ARRAY COALESCE(removals, '{}') LOOP
+        tags := array_remove(tags, tag);
+    END LOOP;
+    FOREACH tag IN ARRAY COALESCE(additions, '{}') LOOP
+        IF NOT tag = ANY(tags) THEN
+            tags := array_append(tags, tag);
+        END IF;
+    END LOOP;
+    RETURN tags;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
\ No newline at end of file
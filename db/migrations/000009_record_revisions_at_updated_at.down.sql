@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION trigger_record_revision()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO slip_revisions (slip_id, revision, body, tags)
+    SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, NEW.body, NEW.tags
+    FROM slip_revisions
+    WHERE slip_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
\ No newline at end of file
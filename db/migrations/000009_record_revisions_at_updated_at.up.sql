@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION trigger_record_revision()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO slip_revisions (slip_id, revision, body, tags, created_at)
+    SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, NEW.body, NEW.tags, NEW.updated_at
+    FROM slip_revisions
+    WHERE slip_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
\ No newline at end of file
@@ -0,0 +1,27 @@
+ALTER TABLE slips ADD COLUMN IF NOT EXISTS title TEXT
+    GENERATED ALWAYS AS (rtrim(split_part(ltrim(body, E'# \t\r\n'), E'\n', 1), E' \t\r')) STORED;
+
+CREATE INDEX IF NOT EXISTS slips_title_idx ON slips (lower(title));
+
+CREATE TABLE IF NOT EXISTS slip_links (
+    slip_id INTEGER NOT NULL REFERENCES slips (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    target TEXT NOT NULL,
+    target_id BIGINT,
+    PRIMARY KEY (slip_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS slip_links_target_id_idx ON slip_links (target_id) WHERE target_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS slip_links_target_idx ON slip_links (lower(target)) WHERE target_id IS NULL;
+
+INSERT INTO slip_links (slip_id, position, target, target_id)
+SELECT slip_id, row_number() OVER (PARTITION BY slip_id ORDER BY first) - 1, target,
+    CASE WHEN target ~ '^0*[1-9][0-9]{0,17}$' THEN target::BIGINT END
+FROM (
+    SELECT slips.id AS slip_id, btrim(link.match[1], E' \t\r') AS target, min(link.n) AS first
+    FROM slips, regexp_matches(slips.body, '\[\[([^\[\]\n]+)\]\]', 'g') WITH ORDINALITY AS link (match, n)
+    GROUP BY slips.id, btrim(link.match[1], E' \t\r')
+) links
+WHERE target <> ''
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS slips_title_idx;
+ALTER TABLE slips DROP COLUMN IF EXISTS title;
+ALTER TABLE slips DROP COLUMN IF EXISTS given_title;
+ALTER TABLE slips ADD COLUMN title TEXT
+    GENERATED ALWAYS AS (rtrim(split_part(ltrim(body, E'# \t\r\n'), E'\n', 1), E' \t\r')) STORED;
+
+CREATE INDEX IF NOT EXISTS slips_title_idx ON slips (lower(title));
\ No newline at end of file
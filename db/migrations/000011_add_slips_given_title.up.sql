@@ -0,0 +1,10 @@
+ALTER TABLE slips ADD COLUMN IF NOT EXISTS given_title TEXT;
+
+-- The title a slip was given takes the place of the one its body gives.
+DROP INDEX IF EXISTS slips_title_idx;
+ALTER TABLE slips DROP COLUMN IF EXISTS title;
+ALTER TABLE slips ADD COLUMN title TEXT
+    GENERATED ALWAYS AS (COALESCE(given_title,
+        rtrim(split_part(ltrim(body, E'# \t\r\n'), E'\n', 1), E' \t\r'))) STORED;
+
+CREATE INDEX IF NOT EXISTS slips_title_idx ON slips (lower(title));
\ No newline at end of file
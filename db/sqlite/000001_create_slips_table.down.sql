@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS record_revision_on_update;
+DROP TRIGGER IF EXISTS record_revision_on_insert;
+DROP TABLE IF EXISTS slip_revisions;
+DROP TABLE IF EXISTS slips;
\ No newline at end of file
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS slips (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    body TEXT,
+    tags TEXT CHECK (tags IS NULL OR json_type(tags) = 'array'),
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS slips_created_at_id_idx ON slips (created_at, id);
+
+CREATE INDEX IF NOT EXISTS slips_deleted_at_idx ON slips (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS slip_revisions (
+    slip_id INTEGER NOT NULL REFERENCES slips (id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    body TEXT,
+    tags TEXT,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (slip_id, revision)
+);
+
+CREATE TRIGGER IF NOT EXISTS record_revision_on_insert
+AFTER INSERT ON slips
+FOR EACH ROW
+BEGIN
+    INSERT INTO slip_revisions (slip_id, revision, body, tags, created_at)
+    SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, NEW.body, NEW.tags, NEW.updated_at
+    FROM slip_revisions
+    WHERE slip_id = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS record_revision_on_update
+AFTER UPDATE ON slips
+FOR EACH ROW
+WHEN OLD.body IS NOT NEW.body OR OLD.tags IS NOT NEW.tags
+BEGIN
+    INSERT INTO slip_revisions (slip_id, revision, body, tags, created_at)
+    SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, NEW.body, NEW.tags, NEW.updated_at
+    FROM slip_revisions
+    WHERE slip_id = NEW.id;
+END;
\ No newline at end of file
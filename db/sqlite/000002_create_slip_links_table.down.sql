@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS slip_links;
+DROP INDEX IF EXISTS slips_title_idx;
+ALTER TABLE slips DROP COLUMN title;
\ No newline at end of file
@@ -0,0 +1,50 @@
+ALTER TABLE slips ADD COLUMN title TEXT
+    GENERATED ALWAYS AS (rtrim(substr(ltrim(body, '# ' || char(9, 13, 10)), 1,
+        instr(ltrim(body, '# ' || char(9, 13, 10)) || char(10), char(10)) - 1), ' ' || char(9, 13))) VIRTUAL;
+
+CREATE INDEX IF NOT EXISTS slips_title_idx ON slips (lower(title));
+
+CREATE TABLE IF NOT EXISTS slip_links (
+    slip_id INTEGER NOT NULL REFERENCES slips (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    target TEXT NOT NULL,
+    target_id INTEGER,
+    PRIMARY KEY (slip_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS slip_links_target_id_idx ON slip_links (target_id) WHERE target_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS slip_links_target_idx ON slip_links (lower(target)) WHERE target_id IS NULL;
+
+-- Links in existing slips are found by alternating between looking for the
+-- next [[ (phase 0) and reading up to the ]] after it (phase 1). Text that
+-- cannot be a link sends the search on from the character after the [[.
+WITH RECURSIVE scan (slip_id, step, phase, text, target) AS (
+    SELECT id, 0, 0, body, NULL FROM slips WHERE instr(body, '[[') > 0
+    UNION ALL
+    SELECT slip_id, step + 1, 1 - phase,
+        CASE
+            WHEN phase = 0 THEN substr(text, instr(text, '[[') + 2)
+            WHEN instr(text, ']]') > 1
+                AND substr(text, 1, instr(text, ']]') - 1) NOT GLOB '*[][' || char(10) || ']*'
+                THEN substr(text, instr(text, ']]') + 2)
+            ELSE '[' || text
+        END,
+        CASE
+            WHEN phase = 1 AND instr(text, ']]') > 1
+                AND substr(text, 1, instr(text, ']]') - 1) NOT GLOB '*[][' || char(10) || ']*'
+                THEN trim(substr(text, 1, instr(text, ']]') - 1), ' ' || char(9, 13))
+        END
+    FROM scan
+    WHERE phase = 1 OR instr(text, '[[') > 0
+)
+INSERT OR IGNORE INTO slip_links (slip_id, position, target, target_id)
+SELECT slip_id, row_number() OVER (PARTITION BY slip_id ORDER BY first) - 1, target,
+    CASE WHEN target NOT GLOB '*[^0-9]*' AND length(ltrim(target, '0')) BETWEEN 1 AND 18
+        THEN CAST(target AS INTEGER) END
+FROM (
+    SELECT slip_id, target, min(step) AS first
+    FROM scan
+    WHERE target <> ''
+    GROUP BY slip_id, target
+);
\ No newline at end of file
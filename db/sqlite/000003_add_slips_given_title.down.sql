@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS slips_title_idx;
+ALTER TABLE slips DROP COLUMN title;
+ALTER TABLE slips DROP COLUMN given_title;
+ALTER TABLE slips ADD COLUMN title TEXT
+    GENERATED ALWAYS AS (rtrim(substr(ltrim(body, '# ' || char(9, 13, 10)), 1,
+        instr(ltrim(body, '# ' || char(9, 13, 10)) || char(10), char(10)) - 1), ' ' || char(9, 13))) VIRTUAL;
+
+CREATE INDEX IF NOT EXISTS slips_title_idx ON slips (lower(title));
\ No newline at end of file
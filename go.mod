@@ -3,8 +3,11 @@ module github.com/pmaterer/meta
 go 1.16
 
 require (
-	github.com/gin-gonic/gin v1.6.3 // indirect
-	github.com/kelseyhightower/envconfig v1.4.0 // indirect
-	github.com/lib/pq v1.10.0 // indirect
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/gin-gonic/gin v1.7.7
+	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/lib/pq v1.10.0
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/stretchr/testify v1.7.0
+	github.com/yuin/goldmark v1.4.11
+	gopkg.in/yaml.v2 v2.2.8
 )
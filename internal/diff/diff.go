@@ -0,0 +1,241 @@
+// Package diff produces line-based unified diffs of text.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+// maxEdits bounds the edit distance lines searches for. The frontiers it
+// keeps grow with the square of the distance, so texts further apart than
+// this get a diff that is correct but not the shortest.
+const maxEdits = 1000
+
+type opKind int
+
+const (
+	equal opKind = iota
+	insert
+	remove
+)
+
+type op struct {
+	kind opKind
+	line string
+	// a and b are the line numbers (from zero) in the old and new text.
+	a, b int
+}
+
+// Unified returns a unified diff turning a into b, with the given names in the
+// header. Identical texts give an empty string.
+func Unified(fromName, toName, a, b string) string {
+	ops := lines(splitLines(a), splitLines(b))
+	changed := false
+	for _, o := range ops {
+		if o.kind != equal {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks(ops) {
+		writeHunk(&sb, ops[h[0]:h[1]])
+	}
+	return sb.String()
+}
+
+// splitLines splits s after each newline, so that a missing newline at the
+// end of the text shows up as a difference.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lines computes a shortest edit script from a to b with Myers' algorithm,
+// or falls back to replaceMiddle when that needs more than maxEdits edits.
+func lines(a, b []string) []op {
+	n, m := len(a), len(b)
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+2)
+	// trace[d] holds v[-d..d] as it was before step d, which is all of it
+	// that step could read. Keeping only that window makes the trace grow
+	// with the square of the number of edits rather than with the length
+	// of the texts times it.
+	var trace [][]int
+
+	for d := 0; d <= limit && d <= maxEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return replaceMiddle(a, b)
+}
+
+// replaceMiddle keeps the lines a and b start and end with and replaces all
+// of those in between.
+func replaceMiddle(a, b []string) []op {
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+	aEnd, bEnd := len(a), len(b)
+	for aEnd > start && bEnd > start && a[aEnd-1] == b[bEnd-1] {
+		aEnd--
+		bEnd--
+	}
+	ops := make([]op, 0, len(a)+bEnd-start)
+	for i := 0; i < start; i++ {
+		ops = append(ops, op{kind: equal, line: a[i], a: i, b: i})
+	}
+	for i := start; i < aEnd; i++ {
+		ops = append(ops, op{kind: remove, line: a[i], a: i, b: start})
+	}
+	for j := start; j < bEnd; j++ {
+		ops = append(ops, op{kind: insert, line: b[j], a: aEnd, b: j})
+	}
+	for i, j := aEnd, bEnd; i < len(a); i, j = i+1, j+1 {
+		ops = append(ops, op{kind: equal, line: a[i], a: i, b: j})
+	}
+	return ops
+}
+
+// backtrack walks the saved frontiers from the end of both texts back to the
+// start, recovering the edits in order.
+func backtrack(trace [][]int, a, b []string) []op {
+	x, y := len(a), len(b)
+	var ops []op
+	for d := len(trace) - 1; d >= 0; d-- {
+		// The window for step d starts at diagonal -d. Step 0 has no
+		// previous step; its snake runs back from the start of both texts.
+		v := trace[d]
+		k := x - y
+		prevX, prevY := 0, 0
+		if d > 0 {
+			prevK := k - 1
+			if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+				prevK = k + 1
+			}
+			prevX = v[d+prevK]
+			prevY = prevX - prevK
+		}
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{kind: equal, line: a[x], a: x, b: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, op{kind: insert, line: b[y], a: x, b: y})
+			} else {
+				x--
+				ops = append(ops, op{kind: remove, line: a[x], a: x, b: y})
+			}
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunks groups the changes in ops, with their surrounding context, into
+// [start, end) ranges of ops. Changes separated by no more than twice the
+// context share a hunk.
+func hunks(ops []op) [][2]int {
+	var result [][2]int
+	last := -1
+	for i, o := range ops {
+		if o.kind == equal {
+			continue
+		}
+		if last >= 0 && i-last <= 2*context {
+			result[len(result)-1][1] = min(i+1+context, len(ops))
+		} else {
+			result = append(result, [2]int{max(i-context, 0), min(i+1+context, len(ops))})
+		}
+		last = i
+	}
+	return result
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func writeHunk(sb *strings.Builder, ops []op) {
+	aStart, bStart := ops[0].a, ops[0].b
+	var aLen, bLen int
+	for _, o := range ops {
+		if o.kind != insert {
+			aLen++
+		}
+		if o.kind != remove {
+			bLen++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, o := range ops {
+		prefix := " "
+		switch o.kind {
+		case insert:
+			prefix = "+"
+		case remove:
+			prefix = "-"
+		case equal:
+		}
+		sb.WriteString(prefix + o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a hunk position the way diff -u does: lines count from
+// one, and an empty range names the line before it.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -0,0 +1,108 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			name: "Identical",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo\n",
+		},
+		{
+			name:     "Changed line",
+			a:        "one\ntwo\nthree\n",
+			b:        "one\n2\nthree\n",
+			expected: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n",
+		},
+		{
+			name:     "From empty",
+			a:        "",
+			b:        "hello\n",
+			expected: "--- a\n+++ b\n@@ -0,0 +1 @@\n+hello\n",
+		},
+		{
+			name:     "Missing final newline",
+			a:        "hello\n",
+			b:        "hello",
+			expected: "--- a\n+++ b\n@@ -1 +1 @@\n-hello\n+hello\n\\ No newline at end of file\n",
+		},
+		{
+			name: "Separate hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b:    "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			expected: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Unified("a", "b", tt.a, tt.b))
+		})
+	}
+}
+
+// apply rebuilds the old and new texts from an edit script.
+func apply(ops []op) (string, string) {
+	var a, b strings.Builder
+	for _, o := range ops {
+		if o.kind != insert {
+			a.WriteString(o.line)
+		}
+		if o.kind != remove {
+			b.WriteString(o.line)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func TestLinesFarApart(t *testing.T) {
+	var a, b strings.Builder
+	a.WriteString("same start\n")
+	b.WriteString("same start\n")
+	for i := 0; i < maxEdits; i++ {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+	a.WriteString("same end\n")
+	b.WriteString("same end\n")
+
+	ops := lines(splitLines(a.String()), splitLines(b.String()))
+	gotA, gotB := apply(ops)
+	assert.Equal(t, a.String(), gotA)
+	assert.Equal(t, b.String(), gotB)
+	assert.Equal(t, op{kind: equal, line: "same start\n"}, ops[0])
+	assert.Equal(t, op{kind: remove, line: "old 0\n", a: 1, b: 1}, ops[1])
+	assert.Equal(t, op{kind: insert, line: "new 0\n", a: maxEdits + 1, b: 1}, ops[maxEdits+1])
+	assert.Equal(t, op{kind: equal, line: "same end\n", a: maxEdits + 1, b: maxEdits + 1}, ops[len(ops)-1])
+
+	diff := Unified("a", "b", a.String(), b.String())
+	assert.True(t, strings.HasPrefix(diff, fmt.Sprintf("--- a\n+++ b\n@@ -1,%d +1,%d @@\n same start\n-old 0\n", maxEdits+2, maxEdits+2)), diff[:80])
+}
+
+func TestLinesShortest(t *testing.T) {
+	a := splitLines("a\nb\nc\na\nb\nb\na\n")
+	b := splitLines("c\nb\na\nb\na\nc\n")
+	ops := lines(a, b)
+	edits := 0
+	for _, o := range ops {
+		if o.kind != equal {
+			edits++
+		}
+	}
+	assert.Equal(t, 5, edits)
+	gotA, gotB := apply(ops)
+	assert.Equal(t, strings.Join(a, ""), gotA)
+	assert.Equal(t, strings.Join(b, ""), gotB)
+}
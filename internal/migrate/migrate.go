@@ -0,0 +1,254 @@
+// Package migrate applies the SQL schema migrations embedded in the binary.
+//
+// Progress is kept in a schema_migrations table laid out the way the migrate
+// command line tool keeps it, so databases migrated with either can be
+// carried on with the other.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockID identifies the advisory lock held while migrating, so that two
+// servers starting at once do not both apply the same migration.
+const lockID = 7413920514
+
+var filePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change and the SQL to revert it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Dialect names the kind of database being migrated.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	// SQLite databases are expected to be opened with immediate transactions,
+	// which serialise migrations in place of an advisory lock.
+	SQLite Dialect = "sqlite"
+)
+
+// Migrator moves a database between schema versions.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New reads the migrations in dir of fsys, written for the given dialect.
+func New(db *sql.DB, dialect Dialect, fsys fs.FS, dir string) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrator := &Migrator{db: db, dialect: dialect}
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: needs both an up and a down file", m.Version, m.Name)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+	return migrator, nil
+}
+
+// Migrations lists the known migrations, oldest first.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Latest is the version the newest migration brings the schema to.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version reports the version the schema is at; zero before any migration.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	if err := ensureTable(ctx, m.db); err != nil {
+		return 0, err
+	}
+	return version(ctx, m.db)
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return nil
+	}
+	var previous int64
+	for _, migration := range m.migrations {
+		if migration.Version < current {
+			previous = migration.Version
+		}
+	}
+	return m.Goto(ctx, previous)
+}
+
+// Goto migrates up or down to the given version, zero being the empty
+// schema. Each migration runs in its own transaction together with the
+// version update, so a failure leaves the schema at the last good version.
+func (m *Migrator) Goto(ctx context.Context, target int64) error {
+	if target != 0 && m.find(target) < 0 {
+		return fmt.Errorf("no migration has version %d", target)
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if m.dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID) //nolint:errcheck
+	}
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	current, err := version(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if current != 0 && m.find(current) < 0 {
+		return fmt.Errorf("schema is at version %d, which no migration matches", current)
+	}
+
+	for current != target {
+		var step Migration
+		var statements string
+		var next int64
+		if current < target {
+			step = m.migrations[m.find(current)+1]
+			statements, next = step.Up, step.Version
+		} else {
+			i := m.find(current)
+			step = m.migrations[i]
+			statements = step.Down
+			if i > 0 {
+				next = m.migrations[i-1].Version
+			}
+		}
+		if err := apply(ctx, conn, statements, next); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", step.Version, step.Name, err)
+		}
+		current = next
+	}
+	return nil
+}
+
+// find returns the index of the migration with the given version, or -1.
+// Version zero, the empty schema, sits just before the first migration.
+func (m *Migrator) find(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func ensureTable(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)")
+	return err
+}
+
+// version reads the schema version, refusing to go on if an earlier run of
+// the migrate tool left it dirty.
+func version(ctx context.Context, db execer) (int64, error) {
+	var v int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&v, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return v, fmt.Errorf("schema is dirty at version %d: repair it by hand, then clear schema_migrations.dirty", v)
+	}
+	return v, nil
+}
+
+func apply(ctx context.Context, conn *sql.Conn, statements string, next int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if next != 0 {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)", next); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pmaterer/meta/db"
+	"github.com/pmaterer/meta/internal/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"migrations/000002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/000001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"migrations/000001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"migrations/README":                 {Data: []byte("not a migration")},
+	}
+
+	m, err := New(nil, Postgres, fsys, "migrations")
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "first", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "second", Up: "CREATE TABLE b ();", Down: "DROP TABLE b;"},
+	}, m.Migrations())
+	assert.Equal(t, int64(2), m.Latest())
+}
+
+func TestNewMissingDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/000001_first.up.sql": {Data: []byte("CREATE TABLE a ();")},
+	}
+
+	_, err := New(nil, Postgres, fsys, "migrations")
+	assert.Error(t, err)
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	for _, dir := range []string{"migrations", "sqlite"} {
+		m, err := New(nil, Postgres, db.Migrations, dir)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, m.Migrations(), dir)
+		for i, migration := range m.Migrations() {
+			assert.Equal(t, int64(i+1), migration.Version, "%s migrations are numbered without gaps", dir)
+		}
+	}
+}
+
+func TestSQLiteUpAndDown(t *testing.T) {
+	conn, err := sqlite.Open(filepath.Join(t.TempDir(), "meta.db"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	m, err := New(conn, SQLite, db.Migrations, "sqlite")
+	assert.Nil(t, err)
+
+	assert.Nil(t, m.Up(ctx))
+	version, err := m.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	assert.Nil(t, m.Goto(ctx, 0))
+	version, err = m.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), version)
+	var tables int
+	assert.Nil(t, conn.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'slips'").Scan(&tables))
+	assert.Equal(t, 0, tables)
+}
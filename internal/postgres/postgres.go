@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
 	_ "github.com/lib/pq"
@@ -9,6 +10,9 @@ import (
 )
 
 func NewHandler(config config.Config) (*sql.DB, error) {
+	if config.DatabaseName == "" || config.DatabaseUser == "" || config.DatabasePassword == "" {
+		return nil, errors.New("META_DATABASE_NAME, META_DATABASE_USER and META_DATABASE_PASSWORD must be set")
+	}
 	connectionString := fmt.Sprintf("host=%s port=%d user=%s "+
 		"password=%s dbname=%s sslmode=%s",
 		config.DatabaseHost, config.DatabasePort, config.DatabaseUser,
@@ -0,0 +1,32 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pmaterer/meta/config"
+)
+
+func NewHandler(config config.Config) (*sql.DB, error) {
+	return Open(config.DatabasePath)
+}
+
+// Open opens the database file at path, creating it if need be. Foreign keys
+// are enforced and transactions take the write lock as they begin, so that
+// concurrent read-modify-write transactions wait for each other rather than
+// failing to upgrade their lock.
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{
+		"_foreign_keys": {"1"},
+		"_busy_timeout": {"5000"},
+		"_journal_mode": {"WAL"},
+		"_txlock":       {"immediate"},
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?%s", path, params.Encode()))
+	if err != nil {
+		return db, err
+	}
+	return db, nil
+}
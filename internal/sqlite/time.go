@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// TimeFormat is how timestamps are stored: fixed-width UTC text, which sorts
+// in time order, at the microsecond precision of Postgres timestamps.
+const TimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// Time formats t for storage.
+func Time(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// Now is the current time, formatted for storage.
+func Now() string {
+	return Time(time.Now())
+}
+
+// TimeField scans a timestamp into t. The driver only parses timestamps in
+// columns declared as such, which RETURNING columns are not, so text is
+// parsed here.
+func TimeField(t *time.Time) sql.Scanner {
+	return timeField{t}
+}
+
+type timeField struct {
+	t *time.Time
+}
+
+func (f timeField) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*f.t = v.UTC()
+		return nil
+	case string:
+		return f.parse(v)
+	case []byte:
+		return f.parse(string(v))
+	}
+	return fmt.Errorf("cannot scan %T as a timestamp", src)
+}
+
+func (f timeField) parse(s string) error {
+	t, err := time.Parse(TimeFormat, s)
+	if err != nil {
+		return err
+	}
+	*f.t = t
+	return nil
+}
+
+// NullTimeField scans a timestamp that may be NULL into t.
+func NullTimeField(t **time.Time) sql.Scanner {
+	return nullTimeField{t}
+}
+
+type nullTimeField struct {
+	t **time.Time
+}
+
+func (f nullTimeField) Scan(src interface{}) error {
+	if src == nil {
+		*f.t = nil
+		return nil
+	}
+	var t time.Time
+	if err := (timeField{&t}).Scan(src); err != nil {
+		return err
+	}
+	*f.t = &t
+	return nil
+}
+
+// MapError translates a broken constraint into the caller's error taxonomy:
+// conflict for a unique, primary or foreign key, invalid for a NOT NULL or
+// CHECK. Errors it does not recognise are returned unchanged.
+func MapError(err, conflict, invalid error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey, sqlite3.ErrConstraintForeignKey:
+		return fmt.Errorf("%w: %s", conflict, sqliteErr.Error())
+	case sqlite3.ErrConstraintNotNull, sqlite3.ErrConstraintCheck:
+		return fmt.Errorf("%w: %s", invalid, sqliteErr.Error())
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+// Package archive converts a notebook to and from files, for backups and for
+// moving notes between meta and other tools.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+type lister interface {
+	GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error)
+}
+
+// EachSlip calls fn with every slip, oldest first. Slips are fetched a page
+// at a time, so the whole notebook is never held in memory.
+func EachSlip(ctx context.Context, l lister, fn func(slip.Slip) error) error {
+	opts := slip.ListOptions{Limit: slip.MaxPageLimit}
+	for {
+		page, err := l.GetAllSlips(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, s := range page.Slips {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		if page.Next == nil {
+			return nil
+		}
+		opts.After = page.Next
+	}
+}
+
+// The formats a notebook can be imported from.
+const (
+	// FormatMarkdown is a zip of Markdown files as written by
+	// ExportMarkdownZip, or by other tools with or without front matter.
+	FormatMarkdown = "markdown"
+	// FormatJSON is a JSON array of slips, as listed by GET /slips.
+	FormatJSON = "json"
+	// FormatCSV is CSV with a header row naming the columns body, tags,
+	// created_at and updated_at. Only body is required.
+	FormatCSV = "csv"
+	// FormatENEX is an Evernote export.
+	FormatENEX = "enex"
+	// FormatKeep is a Google Takeout zip holding notes from Keep.
+	FormatKeep = "keep"
+)
+
+// errSkip is returned by a file parser for a file that holds no slip to
+// import, such as a note in the trash.
+var errSkip = errors.New("skip")
+
+// readZip parses every file in a zip archive whose name has the extension
+// ext, in name order. Sources are the names in the archive.
+func readZip(data []byte, ext string, parse func([]byte) (slip.Slip, error)) ([]slip.ImportItem, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, slip.InvalidError("zip: %v", err)
+	}
+	files := make([]*zip.File, 0, len(z.File))
+	for _, f := range z.File {
+		if hasExt(f.Name, ext) && !f.FileInfo().IsDir() {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	items := make([]slip.ImportItem, 0, len(files))
+	for _, f := range files {
+		item := slip.ImportItem{Source: f.Name}
+		data, err := readZipFile(f)
+		if err == nil {
+			item.Slip, err = parse(data)
+		}
+		if errors.Is(err, errSkip) {
+			continue
+		}
+		item.Err = err
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// readDir parses every file under dir whose name has the extension ext, in
+// name order. Sources are paths relative to dir.
+func readDir(dir, ext string, parse func([]byte) (slip.Slip, error)) ([]slip.ImportItem, error) {
+	var items []slip.ImportItem
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !hasExt(path, ext) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		item := slip.ImportItem{Source: filepath.ToSlash(rel)}
+		item.Slip, item.Err = parse(data)
+		if !errors.Is(item.Err, errSkip) {
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+// hasExt reports whether name has the extension ext, leaving out the
+// resource forks macOS adds to zip archives.
+func hasExt(name, ext string) bool {
+	return strings.EqualFold(filepath.Ext(name), ext) &&
+		!strings.HasPrefix(name, "__MACOSX/") && !strings.HasPrefix(filepath.Base(name), "._")
+}
+
+// Read reads the slips in data, which is in the given format. An error is
+// returned only if data as a whole cannot be read; a slip that cannot be
+// read is returned as an ImportItem holding the error.
+func Read(format string, data []byte) ([]slip.ImportItem, error) {
+	switch format {
+	case FormatMarkdown:
+		return ReadMarkdownZip(data)
+	case FormatJSON:
+		return ReadJSON(data)
+	case FormatCSV:
+		return ReadCSV(data)
+	case FormatENEX:
+		return ReadENEX(data)
+	case FormatKeep:
+		return ReadKeepZip(data)
+	}
+	return nil, slip.InvalidError("unknown import format %q", format)
+}
+
+// timeLayouts are the timestamp layouts accepted on import, most precise
+// first.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseTime parses an imported timestamp. An empty one is the zero time,
+// which the service replaces with the time of the import.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", s)
+}
+
+// splitTags splits comma-separated tags, dropping blanks.
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// clampUpdatedAt moves a slip's updated_at up to its created_at. Notes synced
+// from devices with skewed clocks can look edited before they were created,
+// which the service would refuse.
+func clampUpdatedAt(s slip.Slip) slip.Slip {
+	if s.UpdatedAt.Before(s.CreatedAt) {
+		s.UpdatedAt = s.CreatedAt
+	}
+	return s
+}
@@ -0,0 +1,531 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/meta/slip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedLister serves slips a page of two at a time.
+type pagedLister []slip.Slip
+
+func (l pagedLister) GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error) {
+	start := 0
+	if opts.After != nil {
+		for i, s := range l {
+			if s.ID == opts.After.ID {
+				start = i + 1
+			}
+		}
+	}
+	end := start + 2
+	if end >= len(l) {
+		return slip.Page{Slips: l[start:]}, nil
+	}
+	return slip.Page{Slips: l[start:end], Next: slip.CursorAfter(l[end-1])}, nil
+}
+
+var testTime = time.Date(2021, 3, 4, 5, 6, 7, 123456000, time.UTC)
+
+func TestMarkdown(t *testing.T) {
+	data, err := Markdown(slip.Slip{
+		ID:        7,
+		Title:     "Books to read",
+		Body:      "Reading list\n\n- Dune",
+		Tags:      []string{"reading", "yes"},
+		CreatedAt: testTime,
+		UpdatedAt: testTime.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `---
+id: 7
+title: Books to read
+tags: [reading, "yes"]
+created_at: "2021-03-04T05:06:07.123456Z"
+updated_at: "2021-03-04T06:06:07.123456Z"
+---
+
+Reading list
+
+- Dune
+`, string(data))
+
+	data, err = Markdown(slip.Slip{ID: 8, Title: "untagged", Body: "untagged", CreatedAt: testTime, UpdatedAt: testTime})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "tags: []\n")
+	assert.NotContains(t, string(data), "title:")
+}
+
+func TestMarkdownName(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"Reading list\nmore", "000001-reading-list.md"},
+		{"What's up, Doc?", "000001-what-s-up-doc.md"},
+		{"Ünïcode ok", "000001-ünïcode-ok.md"},
+		{"a very long first line that goes on and on well past the limit", "000001-a-very-long-first-line-that-goes-on-and.md"},
+		{"!!!", "000001.md"},
+		{"", "000001.md"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MarkdownName(slip.Slip{ID: 1, Body: tt.body}), tt.body)
+	}
+}
+
+func TestExportMarkdownDir(t *testing.T) {
+	var slips pagedLister
+	for i := int64(1); i <= 5; i++ {
+		slips = append(slips, slip.Slip{ID: i, Body: "note", CreatedAt: testTime, UpdatedAt: testTime})
+	}
+	dir := filepath.Join(t.TempDir(), "notes")
+
+	require.NoError(t, ExportMarkdownDir(context.Background(), slips, dir))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 5)
+	assert.Equal(t, "000001-note.md", files[0].Name())
+	assert.Equal(t, "000005-note.md", files[4].Name())
+	info, err := os.Stat(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(testTime))
+}
+
+func TestParseMarkdown(t *testing.T) {
+	original := slip.Slip{
+		ID:        7,
+		Title:     "Books to read",
+		Body:      "Reading list\n\n---\n\n- Dune",
+		Tags:      []string{"reading", "yes", "1"},
+		CreatedAt: testTime,
+		UpdatedAt: testTime.Add(time.Hour),
+	}
+	data, err := Markdown(original)
+	require.NoError(t, err)
+	parsed, err := ParseMarkdown(data)
+	require.NoError(t, err)
+	original.ID = 0
+	assert.Equal(t, original, parsed)
+
+	for _, body := range []string{"", "Text", "Text\n", "Text\n\n", "\n"} {
+		data, err := Markdown(slip.Slip{Body: body, CreatedAt: testTime, UpdatedAt: testTime})
+		require.NoError(t, err)
+		parsed, err := ParseMarkdown(data)
+		require.NoError(t, err)
+		assert.Equal(t, body, parsed.Body, "%q survives the round trip", body)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want slip.Slip
+	}{
+		{"No front matter", "Just text\n", slip.Slip{Body: "Just text"}},
+		{"Empty front matter", "---\n---\nText", slip.Slip{Body: "Text"}},
+		{"Only front matter", "---\ntags: [a]\n---", slip.Slip{Tags: []string{"a"}}},
+		{"CRLF", "---\r\ntags: [a]\r\n---\r\n\r\nText\r\n", slip.Slip{Body: "Text", Tags: []string{"a"}}},
+		{
+			"Other tools",
+			"---\ntitle: From elsewhere\ntags: go, notes\ncreated_at: 2020-01-02\nupdated_at: 2020-01-03 04:05:06\n---\nText",
+			slip.Slip{
+				Title:     "From elsewhere",
+				Body:      "Text",
+				Tags:      []string{"go", "notes"},
+				CreatedAt: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+				UpdatedAt: time.Date(2020, 1, 3, 4, 5, 6, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMarkdown([]byte(tt.text))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, text := range []string{
+		"---\ntags: [a]\nText",
+		"---\ntags: [a\n---\nText",
+		"---\ncreated_at: yesterday\n---\nText",
+	} {
+		_, err := ParseMarkdown([]byte(text))
+		assert.True(t, errors.Is(err, slip.ErrInvalid), "%q: %v", text, err)
+	}
+}
+
+func TestReadMarkdownZip(t *testing.T) {
+	slips := pagedLister{
+		{ID: 1, Body: "one", Tags: []string{"a"}, CreatedAt: testTime, UpdatedAt: testTime},
+		{ID: 2, Body: "two", Tags: []string{}, CreatedAt: testTime, UpdatedAt: testTime},
+		{ID: 3, Body: "three", Tags: []string{"b"}, CreatedAt: testTime, UpdatedAt: testTime},
+	}
+	var b bytes.Buffer
+	require.NoError(t, ExportMarkdownZip(context.Background(), slips, &b))
+
+	items, err := ReadMarkdownZip(b.Bytes())
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	for i, item := range items {
+		assert.Equal(t, MarkdownName(slips[i]), item.Source)
+		assert.NoError(t, item.Err)
+		assert.Equal(t, slips[i].Body, item.Slip.Body)
+		assert.Equal(t, slips[i].Tags, item.Slip.Tags)
+		assert.True(t, item.Slip.CreatedAt.Equal(testTime))
+	}
+
+	_, err = ReadMarkdownZip([]byte("not a zip"))
+	assert.True(t, errors.Is(err, slip.ErrInvalid))
+}
+
+func TestReadMarkdownDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.md"), []byte("b"), 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "a.md"), []byte("---\nbroken"), 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("skipped"), 0o644))
+
+	items, err := ReadMarkdownDir(dir)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "b.md", items[0].Source)
+	assert.Equal(t, "b", items[0].Slip.Body)
+	assert.Equal(t, "sub/a.md", items[1].Source)
+	assert.Error(t, items[1].Err)
+}
+
+func TestReadJSON(t *testing.T) {
+	items, err := Read(FormatJSON, []byte(`[
+		{"id": 9, "title": "A", "body": "a", "tags": ["x"], "version": 4, "created_at": "2021-03-04T05:06:07.123456Z"},
+		{"body": 5},
+		{"body": "c"}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	assert.Equal(t, slip.ImportItem{
+		Source: "item 1",
+		Slip:   slip.Slip{Title: "A", Body: "a", Tags: []string{"x"}, CreatedAt: testTime},
+	}, items[0])
+	assert.Equal(t, "item 2", items[1].Source)
+	assert.Error(t, items[1].Err)
+	assert.Equal(t, "c", items[2].Slip.Body)
+
+	_, err = Read(FormatJSON, []byte(`{"body": "a"}`))
+	assert.True(t, errors.Is(err, slip.ErrInvalid))
+}
+
+func TestReadCSV(t *testing.T) {
+	items, err := Read(FormatCSV, []byte("id,Body,tags,created_at,title\n"+
+		"1,\"first, with a comma\",\"a, b\",2021-03-04T05:06:07.123456Z,First\n"+
+		"2,second,,\n"+
+		"3,third,,last week\n"))
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	assert.Equal(t, slip.ImportItem{
+		Source: "row 1",
+		Slip:   slip.Slip{Title: "First", Body: "first, with a comma", Tags: []string{"a", "b"}, CreatedAt: testTime},
+	}, items[0])
+	assert.Equal(t, slip.ImportItem{Source: "row 2", Slip: slip.Slip{Body: "second"}}, items[1])
+	assert.Equal(t, "row 3", items[2].Source)
+	assert.True(t, errors.Is(items[2].Err, slip.ErrInvalid))
+
+	for _, data := range []string{"", "title,tags\nx,y\n", "body\n\"unclosed\n"} {
+		_, err := Read(FormatCSV, []byte(data))
+		assert.True(t, errors.Is(err, slip.ErrInvalid), "%q: %v", data, err)
+	}
+}
+
+func TestENMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		enml string
+		want string
+	}{
+		{
+			"Lines",
+			`<en-note><div>one</div><div>two</div><div><br/></div><div>three</div></en-note>`,
+			"one\ntwo\n\nthree",
+		},
+		{
+			"Paragraphs and headings",
+			`<en-note><h2>Title</h2><p>First   para
+			graph.</p><p>Second&nbsp;one &amp; more.</p></en-note>`,
+			"## Title\n\nFirst para graph.\n\nSecond one & more.",
+		},
+		{
+			"Inline formatting",
+			`<en-note><div>Some <b>bold</b>, <i>italic </i>and <s>struck</s> text with <code>code</code>, <a href="https://example.com">a link</a><b> </b>and <span style="color:red">colour</span>.</div></en-note>`,
+			"Some **bold**, _italic_ and ~~struck~~ text with `code`, [a link](https://example.com) and colour.",
+		},
+		{
+			"Lists",
+			`<en-note><ul><li>a</li><li>b<ol><li>b1</li><li>b2</li></ol></li></ul><div>after</div></en-note>`,
+			"- a\n- b\n  1. b1\n  2. b2\n\nafter",
+		},
+		{
+			"Checkboxes",
+			`<en-note><div><en-todo checked="true"/>milk</div><div><en-todo checked="false"/>eggs</div></en-note>`,
+			"- [x] milk\n- [ ] eggs",
+		},
+		{
+			"Quotes, code and rules",
+			`<en-note><blockquote><div>quoted</div><div>twice</div></blockquote><hr/><pre>x := 1
+y := 2</pre></en-note>`,
+			"> quoted\n> twice\n\n---\n\n```\nx := 1\ny := 2\n```",
+		},
+		{
+			"Tables and media",
+			`<en-note><table><tr><td>a</td><td>b</td></tr><tr><td>c</td><td>d</td></tr></table><en-media type="image/png" hash="abc"/></en-note>`,
+			"| a | b |\n| --- | --- |\n| c | d |",
+		},
+		{
+			"Escaped text",
+			`<en-note><div># not a heading</div><div>1. not a list</div><div>a *b* _c_ [[d]] &lt;e&gt; x|y</div><div><code>*as is*</code></div></en-note>`,
+			"\\# not a heading\n1\\. not a list\na \\*b\\* \\_c\\_ \\[\\[d\\]\\] \\<e> x\\|y\n`*as is*`",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enmlToMarkdown(tt.enml)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+const testENEX = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="20210304T050607Z" application="Evernote" version="10">
+  <note>
+    <title>Groceries</title>
+    <created>20210304T050607Z</created>
+    <updated>20210305T050607Z</updated>
+    <tag>home</tag>
+    <tag>lists</tag>
+    <content><![CDATA[<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><div><en-todo checked="true"/>milk</div><div><en-todo/>eggs</div></en-note>]]></content>
+    <resource><data encoding="base64">aGVsbG8=</data><mime>image/png</mime></resource>
+  </note>
+  <note>
+    <title></title>
+    <content><![CDATA[<en-note>Untitled</en-note>]]></content>
+    <created>20210304T050607Z</created>
+    <updated>20200101T000000Z</updated>
+  </note>
+  <note>
+    <title>Bad date</title>
+    <content><![CDATA[<en-note/>]]></content>
+    <created>yesterday</created>
+  </note>
+</en-export>`
+
+func TestReadENEX(t *testing.T) {
+	items, err := Read(FormatENEX, []byte(testENEX))
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+
+	created := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, slip.ImportItem{
+		Source: "note 1 Groceries",
+		Slip: slip.Slip{
+			Body:      "# Groceries\n\n- [x] milk\n- [ ] eggs",
+			Tags:      []string{"home", "lists"},
+			CreatedAt: created,
+			UpdatedAt: created.Add(24 * time.Hour),
+		},
+	}, items[0])
+	assert.Equal(t, slip.ImportItem{
+		Source: "note 2",
+		Slip:   slip.Slip{Body: "Untitled", CreatedAt: created, UpdatedAt: created},
+	}, items[1], "an update before creation is moved up to it")
+	assert.Equal(t, "note 3 Bad date", items[2].Source)
+	assert.True(t, errors.Is(items[2].Err, slip.ErrInvalid))
+
+	for _, data := range []string{"<en-export></en-export>", "<en-export><note>"} {
+		_, err := Read(FormatENEX, []byte(data))
+		assert.True(t, errors.Is(err, slip.ErrInvalid), "%q: %v", data, err)
+	}
+}
+
+func TestReadKeepZip(t *testing.T) {
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for name, content := range map[string]string{
+		"Takeout/Keep/Shopping.json": `{"title":"Shopping","isTrashed":false,
+			"createdTimestampUsec":1614834367000000,"userEditedTimestampUsec":1614920767000000,
+			"labels":[{"name":"home"}],
+			"listContent":[{"text":"milk","isChecked":true},{"text":"eggs","isChecked":false}]}`,
+		"Takeout/Keep/Idea.json":       `{"title":"","textContent":"Just a thought","createdTimestampUsec":1614834367000000}`,
+		"Takeout/Keep/Old.json":        `{"title":"Old","textContent":"gone","isTrashed":true}`,
+		"Takeout/Keep/Shopping.html":   `<html></html>`,
+		"Takeout/archive_browser.json": `{"products":[]}`,
+		"Takeout/Keep/Broken.json":     `{`,
+	} {
+		f, err := z.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, z.Close())
+
+	items, err := Read(FormatKeep, b.Bytes())
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	assert.Equal(t, "Takeout/Keep/Broken.json", items[0].Source)
+	assert.True(t, errors.Is(items[0].Err, slip.ErrInvalid))
+	created := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, slip.ImportItem{
+		Source: "Takeout/Keep/Idea.json",
+		Slip:   slip.Slip{Body: "Just a thought", CreatedAt: created, UpdatedAt: created},
+	}, items[1])
+	assert.Equal(t, slip.ImportItem{
+		Source: "Takeout/Keep/Shopping.json",
+		Slip: slip.Slip{
+			Body:      "# Shopping\n\n- [x] milk\n- [ ] eggs",
+			Tags:      []string{"home"},
+			CreatedAt: created,
+			UpdatedAt: created.Add(24 * time.Hour),
+		},
+	}, items[2])
+}
+
+func TestGraphWriter(t *testing.T) {
+	slips := []slip.GraphSlip{
+		{ID: 1, Title: `Say "hi" & <wave>`, Tags: []string{"x"}, Links: []int64{}},
+		{ID: 2, Tags: []string{"x", "y"}, Links: []int64{1}},
+	}
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: GraphJSON,
+			expected: `{"nodes":[` +
+				`{"id":"slip:1","kind":"slip","label":"Say \"hi\" \u0026 \u003cwave\u003e","slip_id":1},` +
+				`{"id":"tag:x","kind":"tag","label":"x"},` +
+				`{"id":"slip:2","kind":"slip","label":"#2","slip_id":2},` +
+				`{"id":"tag:y","kind":"tag","label":"y"}],` +
+				`"edges":[` +
+				`{"source":"slip:1","target":"tag:x","kind":"tag"},` +
+				`{"source":"slip:2","target":"tag:x","kind":"tag"},` +
+				`{"source":"slip:2","target":"tag:y","kind":"tag"},` +
+				`{"source":"slip:2","target":"slip:1","kind":"link"}]}` + "\n",
+		},
+		{
+			format: GraphDOT,
+			expected: `digraph meta {
+  "slip:1" [label="Say \"hi\" & <wave>", shape=box];
+  "tag:x" [label="x", shape=ellipse];
+  "slip:1" -> "tag:x" [style=dashed];
+  "slip:2" [label="#2", shape=box];
+  "slip:2" -> "tag:x" [style=dashed];
+  "tag:y" [label="y", shape=ellipse];
+  "slip:2" -> "tag:y" [style=dashed];
+  "slip:2" -> "slip:1";
+}
+`,
+		},
+		{
+			format: GraphGraphML,
+			expected: `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="kind" for="all" attr.name="kind" attr.type="string"/>
+  <key id="label" for="node" attr.name="label" attr.type="string"/>
+  <graph id="meta" edgedefault="directed">
+    <node id="slip:1"><data key="kind">slip</data><data key="label">Say &#34;hi&#34; &amp; &lt;wave&gt;</data></node>
+    <node id="tag:x"><data key="kind">tag</data><data key="label">x</data></node>
+    <edge source="slip:1" target="tag:x"><data key="kind">tag</data></edge>
+    <node id="slip:2"><data key="kind">slip</data><data key="label">#2</data></node>
+    <edge source="slip:2" target="tag:x"><data key="kind">tag</data></edge>
+    <node id="tag:y"><data key="kind">tag</data><data key="label">y</data></node>
+    <edge source="slip:2" target="tag:y"><data key="kind">tag</data></edge>
+    <edge source="slip:2" target="slip:1"><data key="kind">link</data></edge>
+  </graph>
+</graphml>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b bytes.Buffer
+			w, err := NewGraphWriter(tt.format, &b)
+			require.NoError(t, err)
+			for _, s := range slips {
+				require.NoError(t, w.WriteSlip(s))
+			}
+			require.NoError(t, w.Close())
+			assert.Equal(t, tt.expected, b.String())
+		})
+	}
+
+	var b bytes.Buffer
+	w, err := NewGraphWriter(GraphJSON, &b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, `{"nodes":[],"edges":[]}`+"\n", b.String())
+
+	_, err = NewGraphWriter("svg", &b)
+	assert.True(t, errors.Is(err, slip.ErrInvalid))
+}
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "Heading and emphasis",
+			body:     "# Reading list\n\nSome *good* ~~bad~~ books.",
+			expected: "<h1>Reading list</h1>\n<p>Some <em>good</em> <del>bad</del> books.</p>\n",
+		},
+		{
+			name: "Table",
+			body: "| a | b |\n|---|---|\n| 1 | 2 |",
+			expected: "<table>\n<thead>\n<tr>\n<th>a</th>\n<th>b</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td>1</td>\n<td>2</td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		{
+			name: "Task list",
+			body: "- [x] done\n- [ ] to do",
+			expected: "<ul>\n<li><input checked=\"\" disabled=\"\" type=\"checkbox\"> done</li>\n" +
+				"<li><input disabled=\"\" type=\"checkbox\"> to do</li>\n</ul>\n",
+		},
+		{
+			name:     "Fenced code",
+			body:     "```go\nfmt.Println(\"<hi>\")\n```",
+			expected: "<pre><code class=\"language-go\">fmt.Println(&quot;&lt;hi&gt;&quot;)\n</code></pre>\n",
+		},
+		{
+			name:     "Raw HTML",
+			body:     "<script>alert(1)</script>\n\nText <b onclick=\"x()\">bold</b>",
+			expected: "<!-- raw HTML omitted -->\n<p>Text <!-- raw HTML omitted -->bold<!-- raw HTML omitted --></p>\n",
+		},
+		{
+			name:     "Unsafe link",
+			body:     "[click](javascript:alert(1)) and https://example.com",
+			expected: "<p><a href=\"\">click</a> and <a href=\"https://example.com\">https://example.com</a></p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := HTML(tt.body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, html)
+		})
+	}
+}
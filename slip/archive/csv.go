@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// ReadCSV reads slips from CSV whose first row names the columns. body is
+// required; title, tags, comma-separated within the cell, created_at and
+// updated_at are optional, and other columns, such as id, are ignored. Sources are
+// "row N", counting from the first row after the header.
+func ReadCSV(data []byte) ([]slip.ImportItem, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, slip.InvalidError("csv: no header row")
+	}
+	if err != nil {
+		return nil, slip.InvalidError("csv: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["body"]; !ok {
+		return nil, slip.InvalidError("csv: no body column")
+	}
+
+	var items []slip.ImportItem
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, slip.InvalidError("csv: %v", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		item := slip.ImportItem{Source: fmt.Sprintf("row %d", row)}
+		item.Slip.Title = field("title")
+		item.Slip.Body = field("body")
+		item.Slip.Tags = splitTags(field("tags"))
+		if item.Slip.CreatedAt, err = parseTime(field("created_at")); err != nil {
+			item.Err = slip.InvalidError("created_at: %v", err)
+		} else if item.Slip.UpdatedAt, err = parseTime(field("updated_at")); err != nil {
+			item.Err = slip.InvalidError("updated_at: %v", err)
+		}
+		items = append(items, item)
+	}
+}
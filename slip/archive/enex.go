@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// enexTimeFormat is how ENEX files write dates, always in UTC.
+const enexTimeFormat = "20060102T150405Z"
+
+// enexNote is a <note> element of an Evernote export. Attachments, which
+// follow as <resource> elements, are not imported.
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Updated string   `xml:"updated"`
+	Tags    []string `xml:"tag"`
+}
+
+// ReadENEX reads the notes of an Evernote export. Each note becomes a slip
+// whose body is the note's title as a heading followed by its content
+// converted to Markdown. Evernote tags become tags. Sources are "note N",
+// counting from 1, followed by the note's title.
+func ReadENEX(data []byte) ([]slip.ImportItem, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	var items []slip.ImportItem
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, slip.InvalidError("enex: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+		var note enexNote
+		if err := d.DecodeElement(&note, &start); err != nil {
+			return nil, slip.InvalidError("enex: %v", err)
+		}
+		item := slip.ImportItem{Source: fmt.Sprintf("note %d", len(items)+1)}
+		if title := strings.TrimSpace(note.Title); title != "" {
+			item.Source += " " + title
+		}
+		item.Slip, item.Err = note.slip()
+		items = append(items, item)
+	}
+	if items == nil {
+		return nil, slip.InvalidError("enex: no notes found")
+	}
+	return items, nil
+}
+
+func (n enexNote) slip() (slip.Slip, error) {
+	var s slip.Slip
+	body, err := enmlToMarkdown(n.Content)
+	if err != nil {
+		return s, slip.InvalidError("%v", err)
+	}
+	if title := strings.TrimSpace(n.Title); title != "" {
+		body = strings.TrimRight("# "+title+"\n\n"+body, "\n")
+	}
+	s.Body = body
+	s.Tags = n.Tags
+	if s.CreatedAt, err = parseENEXTime(n.Created); err != nil {
+		return s, slip.InvalidError("created: %v", err)
+	}
+	if s.UpdatedAt, err = parseENEXTime(n.Updated); err != nil {
+		return s, slip.InvalidError("updated: %v", err)
+	}
+	return clampUpdatedAt(s), nil
+}
+
+func parseENEXTime(s string) (time.Time, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(enexTimeFormat, s)
+}
@@ -0,0 +1,349 @@
+package archive
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// enmlToMarkdown converts ENML, the XHTML dialect Evernote stores notes in,
+// to Markdown. Formatting Markdown has no equivalent for, such as colours
+// and fonts, is dropped, as are attachments.
+func enmlToMarkdown(enml string) (string, error) {
+	d := xml.NewDecoder(strings.NewReader(enml))
+	// ENML is meant to be strict XHTML, but notes clipped from the web
+	// often carry HTML entities and unclosed tags.
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var w markdownWriter
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("enml: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			w.start(t)
+		case xml.EndElement:
+			w.end(t.Name.Local)
+		case xml.CharData:
+			w.text(string(t))
+		}
+	}
+	return w.String(), nil
+}
+
+// markdownWriter builds Markdown from a stream of HTML elements. Blocks are
+// separated lazily: an element asks for a line break or a blank line, and
+// the break is written only once more text follows.
+type markdownWriter struct {
+	b strings.Builder
+	// breaks is how many newlines to write before the next text, at most
+	// two.
+	breaks int
+	// marker is written at the start of the next line of text, such as
+	// "- " for a list item.
+	marker string
+	// inline holds the formatting open around the current text.
+	inline []inlineFormat
+	// pending is the opening of formatting that has no text in it yet.
+	pending string
+	// space is set when white space separates the last text written
+	// from the next.
+	space bool
+	// cells counts the cells of the current row of each open table, and
+	// rows its rows, so that the header row is followed by a delimiter row.
+	tables []table
+	lists  []list
+	quotes int
+	pre    int
+	// code counts the <code> elements open outside <pre>, whose text is
+	// written as it is.
+	code int
+}
+
+type inlineFormat struct {
+	open, close string
+	written     bool
+}
+
+type table struct {
+	rows, cells int
+}
+
+type list struct {
+	ordered bool
+	n       int
+}
+
+func (w *markdownWriter) start(e xml.StartElement) {
+	switch name := e.Name.Local; name {
+	case "p", "table", "blockquote", "hr":
+		w.block(2)
+		if name == "table" {
+			w.tables = append(w.tables, table{})
+		}
+		if name == "blockquote" {
+			w.quotes++
+		}
+		if name == "hr" {
+			w.raw("---")
+			w.block(2)
+		}
+	case "div":
+		w.block(1)
+	case "tr":
+		w.block(1)
+		if len(w.tables) > 0 {
+			w.tables[len(w.tables)-1].cells = 0
+		}
+	case "br":
+		w.breaks++
+		if w.breaks > 2 {
+			w.breaks = 2
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.block(2)
+		w.marker = strings.Repeat("#", int(name[1]-'0')) + " "
+	case "ul", "ol":
+		if len(w.lists) == 0 {
+			w.block(2)
+		}
+		w.lists = append(w.lists, list{ordered: name == "ol"})
+	case "li":
+		w.block(1)
+		w.marker = strings.Repeat("  ", len(w.lists)-1) + "- "
+		if len(w.lists) == 0 {
+			w.marker = "- "
+		} else if l := &w.lists[len(w.lists)-1]; l.ordered {
+			l.n++
+			w.marker = fmt.Sprintf("%s%d. ", strings.Repeat("  ", len(w.lists)-1), l.n)
+		}
+	case "en-todo":
+		box := "[ ] "
+		if attr(e, "checked") == "true" {
+			box = "[x] "
+		}
+		if w.marker == "" {
+			w.block(1)
+			w.marker = "- "
+		}
+		w.marker += box
+	case "td", "th":
+		if len(w.tables) > 0 {
+			t := &w.tables[len(w.tables)-1]
+			w.space = t.cells > 0
+			w.raw("|")
+			w.space = true
+			t.cells++
+		}
+	case "pre":
+		w.block(2)
+		w.raw("```")
+		w.block(1)
+		w.pre++
+	case "b", "strong":
+		w.open("**", "**")
+	case "i", "em":
+		w.open("_", "_")
+	case "s", "strike", "del":
+		w.open("~~", "~~")
+	case "code":
+		if w.pre == 0 {
+			w.open("`", "`")
+			w.code++
+		}
+	case "a":
+		if href := attr(e, "href"); href != "" {
+			w.open("[", "]("+href+")")
+		} else {
+			w.open("", "")
+		}
+	case "img":
+		if src := attr(e, "src"); src != "" {
+			w.raw(fmt.Sprintf("![%s](%s)", markdownEscaper.Replace(attr(e, "alt")), src))
+		}
+	}
+}
+
+func (w *markdownWriter) end(name string) {
+	switch name {
+	case "p", "h1", "h2", "h3", "h4", "h5", "h6":
+		w.block(2)
+	case "table":
+		if len(w.tables) > 0 {
+			w.tables = w.tables[:len(w.tables)-1]
+		}
+		w.block(2)
+	case "blockquote":
+		w.block(2)
+		if w.quotes > 0 {
+			w.quotes--
+		}
+	case "tr":
+		if len(w.tables) > 0 && w.tables[len(w.tables)-1].cells > 0 {
+			t := &w.tables[len(w.tables)-1]
+			w.space = true
+			w.raw("|")
+			if t.rows == 0 {
+				w.block(1)
+				w.raw("|" + strings.Repeat(" --- |", t.cells))
+			}
+			t.rows++
+		}
+		w.block(1)
+	case "div", "li":
+		w.block(1)
+	case "ul", "ol":
+		if len(w.lists) > 0 {
+			w.lists = w.lists[:len(w.lists)-1]
+		}
+		if len(w.lists) == 0 {
+			w.block(2)
+		} else {
+			w.block(1)
+		}
+	case "pre":
+		if w.pre > 0 {
+			w.pre--
+		}
+		w.block(1)
+		w.raw("```")
+		w.block(2)
+	case "b", "strong", "i", "em", "s", "strike", "del", "a":
+		w.close()
+	case "code":
+		if w.pre == 0 {
+			w.close()
+			if w.code > 0 {
+				w.code--
+			}
+		}
+	}
+}
+
+// text writes character data, collapsing white space as a browser would
+// outside <pre> and escaping what would read as Markdown outside code.
+func (w *markdownWriter) text(s string) {
+	if w.pre > 0 {
+		w.raw(s)
+		return
+	}
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		w.space = w.space || s != ""
+		return
+	}
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		w.space = true
+	}
+	text := strings.Join(words, " ")
+	if w.code == 0 {
+		lineStart := (w.b.Len() == 0 || w.breaks > 0) && w.pending == ""
+		text = escapeMarkdown(text, lineStart)
+	}
+	w.raw(text)
+	w.space = strings.TrimRight(s, " \t\r\n") != s
+}
+
+// markdownEscaper backslash-escapes the characters that read as Markdown
+// formatting, links or HTML wherever they are.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`,
+	"[", `\[`, "]", `\]`, "<", `\<`, "|", `\|`,
+)
+
+// escapeMarkdown escapes text so that it reads as itself. At the start of a
+// line, what would begin a heading, quote, list or rule is escaped too.
+func escapeMarkdown(text string, lineStart bool) string {
+	text = markdownEscaper.Replace(text)
+	if !lineStart || text == "" {
+		return text
+	}
+	if strings.ContainsRune("#>-+=", rune(text[0])) {
+		return `\` + text
+	}
+	digits := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' })
+	if digits > 0 && (text[digits] == '.' || text[digits] == ')') {
+		return text[:digits] + `\` + text[digits:]
+	}
+	return text
+}
+
+// raw writes s after any pending breaks, space, marker and formatting.
+func (w *markdownWriter) raw(s string) {
+	if w.b.Len() == 0 || w.breaks > 0 {
+		if w.b.Len() > 0 {
+			w.b.WriteString(strings.Repeat("\n"+strings.Repeat("> ", w.quotes), w.breaks))
+		} else {
+			w.b.WriteString(strings.Repeat("> ", w.quotes))
+		}
+		w.breaks = 0
+		w.space = false
+	}
+	if w.space {
+		w.b.WriteString(" ")
+		w.space = false
+	}
+	w.b.WriteString(w.marker)
+	w.marker = ""
+	w.b.WriteString(w.pending)
+	w.pending = ""
+	for i := range w.inline {
+		w.inline[i].written = true
+	}
+	w.b.WriteString(s)
+}
+
+// block asks for at least n newlines before the next text.
+func (w *markdownWriter) block(n int) {
+	if n > w.breaks {
+		w.breaks = n
+	}
+}
+
+func (w *markdownWriter) open(open, close string) {
+	w.inline = append(w.inline, inlineFormat{open: open, close: close})
+	w.pending += open
+}
+
+// close ends the innermost formatting, dropping it altogether if it held no
+// text.
+func (w *markdownWriter) close() {
+	if len(w.inline) == 0 {
+		return
+	}
+	f := w.inline[len(w.inline)-1]
+	w.inline = w.inline[:len(w.inline)-1]
+	if f.written {
+		w.b.WriteString(f.close)
+	} else {
+		w.pending = strings.TrimSuffix(w.pending, f.open)
+	}
+}
+
+// String returns the Markdown written, without trailing white space on any
+// line.
+func (w *markdownWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
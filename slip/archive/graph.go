@@ -0,0 +1,260 @@
+package archive
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// Formats a graph of the notebook can be written in.
+const (
+	GraphJSON    = "json"
+	GraphDOT     = "dot"
+	GraphGraphML = "graphml"
+)
+
+// GraphContentTypes maps each graph format to its media type.
+var GraphContentTypes = map[string]string{
+	GraphJSON:    "application/json",
+	GraphDOT:     "text/vnd.graphviz",
+	GraphGraphML: "application/graphml+xml",
+}
+
+// GraphWriter writes a graph of slips, their tags and the links between them
+// a slip at a time. Slips and tags are nodes, with ids such as "slip:7" and
+// "tag:reading"; edges join each slip to its tags and to the slips it links
+// to. Close finishes the graph. Nothing is written before the first slip or
+// Close, so a failure before then can still be reported in its place.
+type GraphWriter interface {
+	WriteSlip(s slip.GraphSlip) error
+	Close() error
+}
+
+// NewGraphWriter returns a writer for the given format.
+func NewGraphWriter(format string, w io.Writer) (GraphWriter, error) {
+	switch format {
+	case GraphJSON:
+		return &jsonGraphWriter{w: w, tags: map[string]bool{}}, nil
+	case GraphDOT:
+		return &dotGraphWriter{w: w, tags: map[string]bool{}}, nil
+	case GraphGraphML:
+		return &graphMLWriter{w: w, tags: map[string]bool{}}, nil
+	}
+	return nil, slip.InvalidError("unknown graph format %q", format)
+}
+
+// Kinds of node and edge.
+const (
+	kindSlip = "slip"
+	kindTag  = "tag"
+	kindLink = "link"
+)
+
+func slipNode(id int64) string {
+	return "slip:" + strconv.FormatInt(id, 10)
+}
+
+func tagNode(tag string) string {
+	return "tag:" + tag
+}
+
+// slipLabel is the title of a slip, or its id if it has none.
+func slipLabel(s slip.GraphSlip) string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return "#" + strconv.FormatInt(s.ID, 10)
+}
+
+// graphNode and graphEdge are the JSON forms of nodes and edges, laid out for
+// D3's force layout once edges are renamed links.
+type graphNode struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Label  string `json:"label"`
+	SlipID int64  `json:"slip_id,omitempty"`
+}
+
+type graphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+// jsonGraphWriter streams the nodes and holds the edges back until the end,
+// as they follow the nodes in the document.
+type jsonGraphWriter struct {
+	w     io.Writer
+	tags  map[string]bool
+	edges []graphEdge
+	count int
+}
+
+func (g *jsonGraphWriter) node(n graphNode) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if g.count == 0 {
+		sep = `{"nodes":[`
+	}
+	g.count++
+	_, err = fmt.Fprintf(g.w, "%s%s", sep, data)
+	return err
+}
+
+func (g *jsonGraphWriter) WriteSlip(s slip.GraphSlip) error {
+	if err := g.node(graphNode{ID: slipNode(s.ID), Kind: kindSlip, Label: slipLabel(s), SlipID: s.ID}); err != nil {
+		return err
+	}
+	for _, tag := range s.Tags {
+		if !g.tags[tag] {
+			g.tags[tag] = true
+			if err := g.node(graphNode{ID: tagNode(tag), Kind: kindTag, Label: tag}); err != nil {
+				return err
+			}
+		}
+		g.edges = append(g.edges, graphEdge{Source: slipNode(s.ID), Target: tagNode(tag), Kind: kindTag})
+	}
+	for _, id := range s.Links {
+		g.edges = append(g.edges, graphEdge{Source: slipNode(s.ID), Target: slipNode(id), Kind: kindLink})
+	}
+	return nil
+}
+
+func (g *jsonGraphWriter) Close() error {
+	start := "],"
+	if g.count == 0 {
+		start = `{"nodes":[],`
+	}
+	edges := g.edges
+	if edges == nil {
+		edges = []graphEdge{}
+	}
+	data, err := json.Marshal(edges)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(g.w, `%s"edges":%s}`+"\n", start, data)
+	return err
+}
+
+// dotGraphWriter writes Graphviz's DOT language, drawing slips as boxes and
+// tags as ellipses joined by dashed edges.
+type dotGraphWriter struct {
+	w       io.Writer
+	tags    map[string]bool
+	started bool
+}
+
+// dotQuote quotes s as a DOT identifier.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func (g *dotGraphWriter) start() error {
+	if g.started {
+		return nil
+	}
+	g.started = true
+	_, err := io.WriteString(g.w, "digraph meta {\n")
+	return err
+}
+
+func (g *dotGraphWriter) WriteSlip(s slip.GraphSlip) error {
+	if err := g.start(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	node := dotQuote(slipNode(s.ID))
+	fmt.Fprintf(&b, "  %s [label=%s, shape=box];\n", node, dotQuote(slipLabel(s)))
+	for _, tag := range s.Tags {
+		if !g.tags[tag] {
+			g.tags[tag] = true
+			fmt.Fprintf(&b, "  %s [label=%s, shape=ellipse];\n", dotQuote(tagNode(tag)), dotQuote(tag))
+		}
+		fmt.Fprintf(&b, "  %s -> %s [style=dashed];\n", node, dotQuote(tagNode(tag)))
+	}
+	for _, id := range s.Links {
+		fmt.Fprintf(&b, "  %s -> %s;\n", node, dotQuote(slipNode(id)))
+	}
+	_, err := io.WriteString(g.w, b.String())
+	return err
+}
+
+func (g *dotGraphWriter) Close() error {
+	if err := g.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(g.w, "}\n")
+	return err
+}
+
+// graphMLWriter writes GraphML, which Gephi and yEd read. Each node and edge
+// carries its kind, and each node its label, as data.
+type graphMLWriter struct {
+	w       io.Writer
+	tags    map[string]bool
+	started bool
+}
+
+const graphMLHeader = xml.Header + `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="kind" for="all" attr.name="kind" attr.type="string"/>
+  <key id="label" for="node" attr.name="label" attr.type="string"/>
+  <graph id="meta" edgedefault="directed">
+`
+
+// xmlEscape escapes s for use in XML text or a quoted attribute.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (g *graphMLWriter) start() error {
+	if g.started {
+		return nil
+	}
+	g.started = true
+	_, err := io.WriteString(g.w, graphMLHeader)
+	return err
+}
+
+func (g *graphMLWriter) WriteSlip(s slip.GraphSlip) error {
+	if err := g.start(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	node := xmlEscape(slipNode(s.ID))
+	fmt.Fprintf(&b, "    <node id=\"%s\"><data key=\"kind\">%s</data><data key=\"label\">%s</data></node>\n",
+		node, kindSlip, xmlEscape(slipLabel(s)))
+	for _, tag := range s.Tags {
+		if !g.tags[tag] {
+			g.tags[tag] = true
+			fmt.Fprintf(&b, "    <node id=\"%s\"><data key=\"kind\">%s</data><data key=\"label\">%s</data></node>\n",
+				xmlEscape(tagNode(tag)), kindTag, xmlEscape(tag))
+		}
+		fmt.Fprintf(&b, "    <edge source=\"%s\" target=\"%s\"><data key=\"kind\">%s</data></edge>\n",
+			node, xmlEscape(tagNode(tag)), kindTag)
+	}
+	for _, id := range s.Links {
+		fmt.Fprintf(&b, "    <edge source=\"%s\" target=\"%s\"><data key=\"kind\">%s</data></edge>\n",
+			node, xmlEscape(slipNode(id)), kindLink)
+	}
+	_, err := io.WriteString(g.w, b.String())
+	return err
+}
+
+func (g *graphMLWriter) Close() error {
+	if err := g.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(g.w, "  </graph>\n</graphml>\n")
+	return err
+}
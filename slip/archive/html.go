@@ -0,0 +1,24 @@
+package archive
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdown converts with GitHub's extensions: tables, task lists,
+// strikethrough and bare URLs as links. Left at its defaults it omits raw
+// HTML and drops link and image URLs with schemes such as javascript:.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// HTML renders a slip's Markdown body as HTML that is safe to show as it is:
+// raw HTML in the body is left out and unsafe URLs are dropped. Fenced code
+// blocks carry a language-NAME class for syntax highlighters to pick up.
+func HTML(body string) (string, error) {
+	var b bytes.Buffer
+	if err := markdown.Convert([]byte(body), &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
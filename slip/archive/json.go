@@ -0,0 +1,28 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// ReadJSON reads a JSON array of slips. Ids, versions and deletion times are
+// ignored. Sources are "item N", counting from 1.
+func ReadJSON(data []byte) ([]slip.ImportItem, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, slip.InvalidError("json: %v", err)
+	}
+	items := make([]slip.ImportItem, len(raw))
+	for i, message := range raw {
+		items[i].Source = fmt.Sprintf("item %d", i+1)
+		var s slip.Slip
+		if err := json.Unmarshal(message, &s); err != nil {
+			items[i].Err = slip.InvalidError("%v", err)
+			continue
+		}
+		items[i].Slip = slip.Slip{Title: s.Title, Body: s.Body, Tags: s.Tags, CreatedAt: s.CreatedAt, UpdatedAt: s.UpdatedAt}
+	}
+	return items, nil
+}
@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// keepNote is a note as Google Takeout exports it from Keep, one JSON file
+// per note. Attachments and annotations are not imported.
+type keepNote struct {
+	Title                   string `json:"title"`
+	TextContent             string `json:"textContent"`
+	IsTrashed               bool   `json:"isTrashed"`
+	CreatedTimestampUsec    int64  `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64  `json:"userEditedTimestampUsec"`
+	Labels                  []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+}
+
+// ReadKeepZip reads the notes in a Google Takeout zip, skipping those in
+// Keep's trash. Labels become tags and checklists become Markdown task lists.
+// Sources are the names of the notes' files in the archive.
+func ReadKeepZip(data []byte) ([]slip.ImportItem, error) {
+	return readZip(data, ".json", ParseKeepNote)
+}
+
+// ReadKeepDir reads the notes in an unpacked Takeout directory, such as
+// Takeout/Keep, as ReadKeepZip does.
+func ReadKeepDir(dir string) ([]slip.ImportItem, error) {
+	return readDir(dir, ".json", ParseKeepNote)
+}
+
+// ParseKeepNote reads a slip from a note exported from Keep. The body is the
+// note's title as a heading followed by its text or checklist.
+func ParseKeepNote(data []byte) (slip.Slip, error) {
+	var note keepNote
+	if err := json.Unmarshal(data, &note); err != nil {
+		return slip.Slip{}, slip.InvalidError("keep: %v", err)
+	}
+	if note.IsTrashed {
+		return slip.Slip{}, errSkip
+	}
+
+	var parts []string
+	if title := strings.TrimSpace(note.Title); title != "" {
+		parts = append(parts, "# "+title)
+	}
+	if text := strings.TrimSpace(note.TextContent); text != "" {
+		parts = append(parts, text)
+	}
+	if len(note.ListContent) > 0 {
+		items := make([]string, len(note.ListContent))
+		for i, item := range note.ListContent {
+			box := "[ ]"
+			if item.IsChecked {
+				box = "[x]"
+			}
+			items[i] = "- " + box + " " + strings.TrimSpace(item.Text)
+		}
+		parts = append(parts, strings.Join(items, "\n"))
+	}
+
+	s := slip.Slip{Body: strings.Join(parts, "\n\n")}
+	if s.Body == "" && note.CreatedTimestampUsec == 0 && note.UserEditedTimestampUsec == 0 {
+		// Not a note: Takeout puts other JSON files in the archive too.
+		return slip.Slip{}, errSkip
+	}
+	for _, label := range note.Labels {
+		s.Tags = append(s.Tags, label.Name)
+	}
+	if note.CreatedTimestampUsec != 0 {
+		s.CreatedAt = time.Unix(0, note.CreatedTimestampUsec*int64(time.Microsecond)).UTC()
+	}
+	if note.UserEditedTimestampUsec != 0 {
+		s.UpdatedAt = time.Unix(0, note.UserEditedTimestampUsec*int64(time.Microsecond)).UTC()
+	}
+	return clampUpdatedAt(s), nil
+}
@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pmaterer/meta/slip"
+	"gopkg.in/yaml.v2"
+)
+
+// frontMatter is the YAML block at the top of an exported Markdown file.
+type frontMatter struct {
+	ID        int64    `yaml:"id"`
+	Title     string   `yaml:"title,omitempty"`
+	Tags      []string `yaml:"tags,flow"`
+	CreatedAt string   `yaml:"created_at"`
+	UpdatedAt string   `yaml:"updated_at"`
+}
+
+// importFrontMatter is the front matter read back on import. Other tools
+// often write tags as a single comma-separated string and timestamps without
+// quotes, so both are accepted.
+type importFrontMatter struct {
+	Title     string  `yaml:"title"`
+	Tags      tagList `yaml:"tags"`
+	CreatedAt string  `yaml:"created_at"`
+	UpdatedAt string  `yaml:"updated_at"`
+}
+
+// tagList is a YAML list of tags or a string of comma-separated ones.
+type tagList []string
+
+func (t *tagList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*t = list
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	*t = splitTags(s)
+	return nil
+}
+
+// MarkdownName is the file name a slip is exported under: its id, which keeps
+// names unique and in creation order, then a few words of its first line.
+func MarkdownName(s slip.Slip) string {
+	if slug := slugify(s.Body, 40); slug != "" {
+		return fmt.Sprintf("%06d-%s.md", s.ID, slug)
+	}
+	return fmt.Sprintf("%06d.md", s.ID)
+}
+
+// Markdown renders a slip as Markdown with YAML front matter holding its id,
+// its title if it was given one, its tags and its timestamps:
+//
+//	---
+//	id: 7
+//	title: Books to read
+//	tags: [reading, books]
+//	created_at: "2021-03-04T05:06:07.123456Z"
+//	updated_at: "2021-03-04T05:06:07.123456Z"
+//	---
+//
+//	The body.
+func Markdown(s slip.Slip) ([]byte, error) {
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	header, err := yaml.Marshal(frontMatter{
+		ID:        s.ID,
+		Title:     s.GivenTitle(),
+		Tags:      tags,
+		CreatedAt: s.CreatedAt.UTC().Format(time.RFC3339Nano),
+		UpdatedAt: s.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	b.Write(header)
+	b.WriteString("---\n\n")
+	b.WriteString(s.Body)
+	// ParseMarkdown takes this newline off again, so a body keeps any of
+	// its own.
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// ExportMarkdownZip writes every slip as a Markdown file into a zip archive
+// streamed to w.
+func ExportMarkdownZip(ctx context.Context, l lister, w io.Writer) error {
+	z := zip.NewWriter(w)
+	err := EachSlip(ctx, l, func(s slip.Slip) error {
+		data, err := Markdown(s)
+		if err != nil {
+			return err
+		}
+		f, err := z.CreateHeader(&zip.FileHeader{
+			Name:     MarkdownName(s),
+			Method:   zip.Deflate,
+			Modified: s.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// ExportMarkdownDir writes every slip as a Markdown file into dir, creating
+// it if need be. Files are given the slip's last update as their
+// modification time.
+func ExportMarkdownDir(ctx context.Context, l lister, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return EachSlip(ctx, l, func(s slip.Slip) error {
+		data, err := Markdown(s)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, MarkdownName(s))
+		if err := ioutil.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+		return os.Chtimes(path, s.UpdatedAt, s.UpdatedAt)
+	})
+}
+
+// slugify turns the first line of text into lower case words joined by
+// hyphens, at most max bytes long.
+func slugify(text string, max int) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(strings.Join(append(words, word), "-")) > max {
+			break
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, "-")
+}
+
+// ParseMarkdown reads a slip from Markdown as written by Markdown. The front
+// matter is optional, and its id is ignored: an imported slip gets a new one.
+func ParseMarkdown(data []byte) (slip.Slip, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	var s slip.Slip
+	if strings.HasPrefix(text, "---\n") {
+		// rest starts with the newline ending the opening ---, so an empty
+		// header is found too.
+		rest, header := text[3:], ""
+		if i := strings.Index(rest, "\n---\n"); i >= 0 {
+			header, text = rest[:i+1], strings.TrimPrefix(rest[i+5:], "\n")
+		} else if strings.HasSuffix(rest, "\n---") {
+			header, text = rest[:len(rest)-3], ""
+		} else {
+			return s, slip.InvalidError("front matter is not closed by ---")
+		}
+		var fm importFrontMatter
+		if err := yaml.Unmarshal([]byte(header), &fm); err != nil {
+			return s, slip.InvalidError("front matter: %v", err)
+		}
+		var err error
+		if s.CreatedAt, err = parseTime(fm.CreatedAt); err != nil {
+			return s, slip.InvalidError("created_at: %v", err)
+		}
+		if s.UpdatedAt, err = parseTime(fm.UpdatedAt); err != nil {
+			return s, slip.InvalidError("updated_at: %v", err)
+		}
+		s.Title, s.Tags = fm.Title, fm.Tags
+	}
+	s.Body = strings.TrimSuffix(text, "\n")
+	return s, nil
+}
+
+// ReadMarkdownZip reads every .md file in a zip archive, in name order.
+func ReadMarkdownZip(data []byte) ([]slip.ImportItem, error) {
+	return readZip(data, ".md", ParseMarkdown)
+}
+
+// ReadMarkdownDir reads every .md file under dir, in name order. Sources are
+// paths relative to dir.
+func ReadMarkdownDir(dir string) ([]slip.ImportItem, error) {
+	return readDir(dir, ".md", ParseMarkdown)
+}
@@ -0,0 +1,111 @@
+package slip
+
+// MaxBatchSize is the most operations a batch may hold.
+const MaxBatchSize = 1000
+
+// The kinds of Operation.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Operation is one change in a Batch. ID names the slip to update or delete,
+// and a non-zero Version makes the change conditional on the slip still
+// being at that version. Title, Body and Tags are the content to create or
+// update the slip with.
+type Operation struct {
+	Op      string   `json:"op"`
+	ID      int64    `json:"id,omitempty"`
+	Version int64    `json:"version,omitempty"`
+	Title   string   `json:"title,omitempty"`
+	Body    string   `json:"body,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	// Links are the targets of the links in Body, as for Slip.
+	Links []string `json:"-"`
+}
+
+// Slip is the slip an update or create operation would store.
+func (o Operation) Slip() Slip {
+	return Slip{ID: o.ID, Version: o.Version, Title: o.Title, Body: o.Body, Tags: o.Tags, Links: o.Links}
+}
+
+// Validate checks that an operation is complete.
+func (o Operation) Validate() error {
+	switch o.Op {
+	case OpCreate:
+		if o.ID != 0 {
+			return InvalidError("create takes no id")
+		}
+		return o.Slip().Validate()
+	case OpUpdate:
+		if o.ID == 0 {
+			return InvalidError("update needs an id")
+		}
+		return o.Slip().Validate()
+	case OpDelete:
+		if o.ID == 0 {
+			return InvalidError("delete needs an id")
+		}
+		return nil
+	}
+	return InvalidError("unknown operation %q", o.Op)
+}
+
+// Batch is a list of operations applied in order, as one: if any fails, none
+// is kept. With ContinueOnError an operation that fails is undone on its own
+// and the others are kept.
+type Batch struct {
+	Operations      []Operation `json:"operations"`
+	ContinueOnError bool        `json:"continue_on_error"`
+}
+
+// Validate checks the size of a batch. Operations are checked one by one, so
+// that each can be reported on.
+func (b Batch) Validate() error {
+	if len(b.Operations) == 0 {
+		return InvalidError("empty batch")
+	}
+	if len(b.Operations) > MaxBatchSize {
+		return InvalidError("a batch holds at most %d operations, not %d", MaxBatchSize, len(b.Operations))
+	}
+	return nil
+}
+
+// What became of an operation in a batch.
+const (
+	// StatusApplied operations were kept.
+	StatusApplied = "applied"
+	// StatusFailed operations were refused, with the reason in Err.
+	StatusFailed = "failed"
+	// StatusRolledBack operations succeeded but were undone because a
+	// later one failed.
+	StatusRolledBack = "rolled_back"
+	// StatusSkipped operations were not tried because an earlier one
+	// failed.
+	StatusSkipped = "skipped"
+)
+
+// BatchResult is the outcome of one operation of a batch.
+type BatchResult struct {
+	Status string
+	// Slip is the slip as created or updated by an applied operation.
+	Slip *Slip
+	Err  error
+}
+
+// AbandonBatch records that the operation at index failed with err, undoing
+// the batch: the operations before it are rolled back and those after it
+// skipped.
+func AbandonBatch(results []BatchResult, index int, err error) {
+	for i := range results {
+		switch {
+		case i < index:
+			results[i] = BatchResult{Status: StatusRolledBack}
+		case i == index:
+			results[i] = BatchResult{Status: StatusFailed, Err: err}
+		default:
+			results[i] = BatchResult{Status: StatusSkipped}
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package client talks to a meta server's slip API over HTTP.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// Client is a slip API client. Its methods mirror those of the slip service,
+// so the two can be used interchangeably.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient returns a client for the server at baseURL, such as
+// http://localhost:9999.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// WithToken returns a copy of the client that sends token, from meta token
+// create or POST /tokens, with every request. An empty token sends none.
+func (c *Client) WithToken(token string) *Client {
+	copied := *c
+	copied.token = token
+	return &copied
+}
+
+// Error is an error response from the server. It unwraps to the matching
+// slip error, so callers can test it with errors.Is like a service error.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case "not_found":
+		return slip.ErrNotFound
+	case "invalid":
+		return slip.ErrInvalid
+	case "conflict":
+		return slip.ErrConflict
+	case "precondition_failed":
+		return slip.ErrVersionMismatch
+	}
+	return nil
+}
+
+func (c *Client) CreateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	var created slip.Slip
+	_, err := c.do(ctx, http.MethodPost, "/slips", nil, s, &created)
+	return created, err
+}
+
+func (c *Client) GetSlip(ctx context.Context, id int64) (slip.Slip, error) {
+	var s slip.Slip
+	_, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/slips/%d", id), nil, nil, &s)
+	return s, err
+}
+
+// GetAllSlips fetches one page of slips, taking the cursor of the next page
+// from the Link header.
+func (c *Client) GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error) {
+	q := url.Values{}
+	if opts.Limit != 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.After != nil {
+		q.Set("cursor", opts.After.String())
+	}
+	q["tag"] = opts.Tags
+	q["any"] = opts.AnyTags
+	q["not"] = opts.NotTags
+
+	var page slip.Page
+	header, err := c.do(ctx, http.MethodGet, "/slips?"+q.Encode(), nil, nil, &page.Slips)
+	if err != nil {
+		return page, err
+	}
+	page.Next, err = nextCursor(header.Get("Link"))
+	return page, err
+}
+
+// UpdateSlip replaces a slip. A non-zero version is sent as If-Match.
+func (c *Client) UpdateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	var updated slip.Slip
+	_, err := c.do(ctx, http.MethodPut, fmt.Sprintf("/slips/%d", s.ID), ifMatch(s.Version), s, &updated)
+	return updated, err
+}
+
+// DeleteSlip moves a slip to the trash. A non-zero version is sent as
+// If-Match.
+func (c *Client) DeleteSlip(ctx context.Context, id, version int64) error {
+	_, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/slips/%d", id), ifMatch(version), nil, nil)
+	return err
+}
+
+// ImportSlips sends the slips of items to be imported as JSON. Items that
+// could not be read are reported as failed without being sent, and since an
+// import is all or nothing the rest are then only checked, as in a dry run.
+func (c *Client) ImportSlips(ctx context.Context, items []slip.ImportItem, dryRun bool) (slip.ImportReport, error) {
+	report := slip.ImportReport{DryRun: dryRun, Results: make([]slip.ImportResult, len(items))}
+	slips := make([]slip.Slip, 0, len(items))
+	sent := make([]int, 0, len(items))
+	for i, item := range items {
+		report.Results[i].Source = item.Source
+		if item.Err != nil {
+			report.Results[i].Error = item.Err.Error()
+			report.Failed++
+			continue
+		}
+		slips = append(slips, item.Slip)
+		sent = append(sent, i)
+	}
+	if len(slips) == 0 && len(items) > 0 {
+		return report, nil
+	}
+
+	q := url.Values{"format": {"json"}}
+	if dryRun || report.Failed > 0 {
+		q.Set("dry_run", "true")
+	}
+	resp, data, err := c.send(ctx, http.MethodPost, "/import?"+q.Encode(), nil, slips)
+	if err != nil {
+		return slip.ImportReport{}, err
+	}
+	// A refused import is answered 400 with a report rather than an error.
+	var answer slip.ImportReport
+	if err := json.Unmarshal(data, &answer); err != nil || len(answer.Results) != len(slips) {
+		return slip.ImportReport{}, apiError(resp, data)
+	}
+	for j, result := range answer.Results {
+		i := sent[j]
+		report.Results[i].ID = result.ID
+		report.Results[i].Error = result.Error
+	}
+	report.Failed += answer.Failed
+	report.Imported = answer.Imported
+	return report, nil
+}
+
+func ifMatch(version int64) http.Header {
+	if version == 0 {
+		return nil
+	}
+	return http.Header{"If-Match": {fmt.Sprintf(`"%d"`, version)}}
+}
+
+// nextCursor reads the cursor out of a Link header's rel="next" URL.
+func nextCursor(link string) (*slip.Cursor, error) {
+	for _, part := range strings.Split(link, ",") {
+		i := strings.Index(part, ";")
+		if i < 0 || !strings.Contains(part[i:], `rel="next"`) {
+			continue
+		}
+		u, err := url.Parse(strings.Trim(strings.TrimSpace(part[:i]), "<>"))
+		if err != nil {
+			return nil, err
+		}
+		return slip.ParseCursor(u.Query().Get("cursor"))
+	}
+	return nil, nil
+}
+
+// do sends a request with body encoded as JSON and decodes a successful
+// response into out. Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, body, out interface{}) (http.Header, error) {
+	resp, data, err := c.send(ctx, method, path, header, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, apiError(resp, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
+
+// send sends a request with body encoded as JSON and returns the response
+// with its body read, whatever its status.
+func (c *Client) send(ctx context.Context, method, path string, header http.Header, body interface{}) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// apiError turns an error response into *Error.
+func apiError(resp *http.Response, data []byte) error {
+	var e struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &e); err != nil || e.Error.Message == "" {
+		return &Error{Status: resp.StatusCode, Message: resp.Status}
+	}
+	return &Error{Status: resp.StatusCode, Code: e.Error.Code, Message: e.Error.Message}
+}
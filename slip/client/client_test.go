@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/meta/slip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAllSlips(t *testing.T) {
+	next := slip.Cursor{CreatedAt: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), ID: 7}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/slips", r.URL.Path)
+		assert.Equal(t, []string{"a", "b"}, r.URL.Query()["tag"])
+		assert.Equal(t, "2", r.URL.Query().Get("limit"))
+		w.Header().Set("Link", `</slips?cursor=`+next.String()+`&limit=2&tag=a&tag=b>; rel="next"`)
+		w.Write([]byte(`[{"id":8,"body":"eight"},{"id":7,"body":"seven"}]`))
+	}))
+	defer server.Close()
+
+	page, err := NewClient(server.URL, nil).GetAllSlips(context.Background(), slip.ListOptions{Limit: 2, Tags: []string{"a", "b"}})
+	assert.NoError(t, err)
+	assert.Len(t, page.Slips, 2)
+	assert.Equal(t, int64(8), page.Slips[0].ID)
+	if assert.NotNil(t, page.Next) {
+		assert.Equal(t, next.ID, page.Next.ID)
+		assert.True(t, next.CreatedAt.Equal(page.Next.CreatedAt))
+	}
+}
+
+func TestUpdateSlipSendsIfMatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/slips/3", r.URL.Path)
+		assert.Equal(t, `"2"`, r.Header.Get("If-Match"))
+		w.Write([]byte(`{"id":3,"body":"new","version":3}`))
+	}))
+	defer server.Close()
+
+	updated, err := NewClient(server.URL, nil).UpdateSlip(context.Background(), slip.Slip{ID: 3, Body: "new", Version: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+}
+
+func TestWithTokenSendsAuthorization(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id":3,"body":"three"}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	_, err := c.WithToken("meta_secret").GetSlip(context.Background(), 3)
+	assert.NoError(t, err)
+	_, err = c.GetSlip(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bearer meta_secret", ""}, got)
+}
+
+func TestErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":"not_found","message":"slip 9: not found"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, nil).GetSlip(context.Background(), 9)
+	assert.True(t, errors.Is(err, slip.ErrNotFound))
+	assert.EqualError(t, err, "slip 9: not found")
+}
+
+func TestImportSlips(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/import", r.URL.Path)
+		assert.Equal(t, "json", r.URL.Query().Get("format"))
+		assert.Equal(t, "true", r.URL.Query().Get("dry_run"), "with an unreadable item nothing may be imported")
+		var slips []slip.Slip
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&slips))
+		assert.Len(t, slips, 2)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"dry_run":true,"imported":0,"failed":1,"results":[{"source":"item 1"},{"source":"item 2","error":"invalid: duplicate tag \"x\""}]}`))
+	}))
+	defer server.Close()
+
+	report, err := NewClient(server.URL, nil).ImportSlips(context.Background(), []slip.ImportItem{
+		{Source: "a.md", Slip: slip.Slip{Body: "a"}},
+		{Source: "b.md", Err: errors.New("unreadable")},
+		{Source: "c.md", Slip: slip.Slip{Body: "c", Tags: []string{"x", "x"}}},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, slip.ImportReport{
+		Failed: 2,
+		Results: []slip.ImportResult{
+			{Source: "a.md"},
+			{Source: "b.md", Error: "unreadable"},
+			{Source: "c.md", Error: `invalid: duplicate tag "x"`},
+		},
+	}, report)
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/slip"
+)
+
+// errorBody is the JSON shape of every error response:
+//
+//	{"error": {"code": "not_found", "message": "slip 7: not found"}}
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// statusClientClosedRequest is the nginx convention for a request the client
+// gave up on before it was answered.
+const statusClientClosedRequest = 499
+
+// writeError maps err onto a status code using the slip error taxonomy and
+// writes it as an errorBody. Anything unrecognised is a 500.
+func writeError(g *gin.Context, err error) {
+	status, detail := describeError(g, err)
+	g.JSON(status, errorBody{Error: detail})
+}
+
+// describeError maps err onto a status code and an errorDetail.
+func describeError(g *gin.Context, err error) (int, errorDetail) {
+	// The database driver does not always report a cancelled query as a
+	// context error, so ask the request's context why it ended.
+	if ctxErr := g.Request.Context().Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		err = fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	status, code := http.StatusInternalServerError, "internal"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		status, code = http.StatusGatewayTimeout, "timeout"
+	case errors.Is(err, context.Canceled):
+		status, code = statusClientClosedRequest, "canceled"
+	case errors.Is(err, slip.ErrNotFound):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, slip.ErrInvalid):
+		status, code = http.StatusBadRequest, "invalid"
+	case errors.Is(err, slip.ErrConflict):
+		status, code = http.StatusConflict, "conflict"
+	case errors.Is(err, slip.ErrVersionMismatch):
+		status, code = http.StatusPreconditionFailed, "precondition_failed"
+	}
+	return status, errorDetail{Code: code, Message: err.Error()}
+}
+
+// badRequest reports malformed input, such as an unparsable id or body.
+func badRequest(g *gin.Context, err error) {
+	writeError(g, slip.InvalidError("%v", err))
+}
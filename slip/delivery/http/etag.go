@@ -0,0 +1,83 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/slip"
+)
+
+// etag formats a slip version as a strong entity tag.
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// renderedETag is the entity tag of a slip version rendered as render. It
+// differs from the slip's own, so that a client holding one representation
+// is not told the other is unchanged.
+func renderedETag(version int64, render string) string {
+	return fmt.Sprintf(`"%d-%s"`, version, render)
+}
+
+// ifMatchVersion returns the version of slip id required by the If-Match
+// header, or zero when there is no header or it is "*". Tags this API never
+// sends, weak ones included, fail the strong comparison RFC 7232 requires,
+// so a header naming none of the slip's versions is ErrVersionMismatch; one
+// that cannot be parsed is invalid. When the header names several versions,
+// the slip's current one is picked if it is among them.
+func (h *Handler) ifMatchVersion(g *gin.Context, id int64) (int64, error) {
+	header := strings.TrimSpace(g.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	var versions []int64
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		weak := strings.HasPrefix(tag, "W/")
+		tag = strings.TrimPrefix(tag, "W/")
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' || strings.Contains(tag[1:len(tag)-1], `"`) {
+			return 0, slip.InvalidError("If-Match must be * or a list of entity tags")
+		}
+		version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+		if !weak && err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return 0, fmt.Errorf("slip %d: If-Match names none of its versions: %w", id, slip.ErrVersionMismatch)
+	case 1:
+		return versions[0], nil
+	}
+	current, err := h.service.GetSlip(g.Request.Context(), id)
+	if err != nil {
+		return 0, err
+	}
+	for _, version := range versions {
+		if version == current.Version {
+			return version, nil
+		}
+	}
+	return 0, slip.VersionMismatchError(id, versions[0], current.Version)
+}
+
+// noneMatch reports whether the If-None-Match header matches the entity tag,
+// using the weak comparison RFC 7232 prescribes for it.
+func noneMatch(g *gin.Context, etag string) bool {
+	header := g.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
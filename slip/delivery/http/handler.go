@@ -1,19 +1,42 @@
 package http
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pmaterer/meta/slip"
+	"github.com/pmaterer/meta/slip/archive"
 )
 
 type service interface {
-	CreateSlip(slip slip.Slip) error
-	GetSlip(id int64) (slip.Slip, error)
-	GetAllSlips() ([]slip.Slip, error)
-	UpdateSlip(slip slip.Slip) error
-	DeleteSlip(id int64) error
+	CreateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	ImportSlips(ctx context.Context, items []slip.ImportItem, dryRun bool) (slip.ImportReport, error)
+	GetSlip(ctx context.Context, id int64) (slip.Slip, error)
+	GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error)
+	SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error)
+	UpdateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error)
+	DeleteSlip(ctx context.Context, id, version int64) error
+	ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error)
+	GetTrash(ctx context.Context) ([]slip.Slip, error)
+	RestoreSlip(ctx context.Context, id int64) error
+	PurgeSlip(ctx context.Context, id int64) error
+	GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error)
+	GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error)
+	RestoreRevision(ctx context.Context, id, rev int64) error
+	DiffRevisions(ctx context.Context, id, from, to int64) (slip.RevisionDiff, error)
+	GetLinks(ctx context.Context, id int64) ([]slip.Link, error)
+	GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error)
+	Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error
+	GetTags(ctx context.Context) ([]slip.Tag, error)
+	RenameTag(ctx context.Context, from, to string) (int64, error)
+	MergeTags(ctx context.Context, m slip.TagMerge) (int64, error)
 }
 
 type Handler struct {
@@ -26,74 +49,604 @@ func NewHandler(s service) *Handler {
 	}
 }
 
+// CreateSlip stores a new slip and answers 201 Created with the slip and its
+// URL in the Location header.
 func (h *Handler) CreateSlip(g *gin.Context) {
 	var slip slip.Slip
 	if err := g.ShouldBindJSON(&slip); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(g, err)
 		return
 	}
-	if err := h.service.CreateSlip(slip); err != nil {
-		g.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	created, err := h.service.CreateSlip(g.Request.Context(), slip)
+	if err != nil {
+		writeError(g, err)
 		return
 	}
-	g.JSON(http.StatusOK, gin.H{"message": "OK"})
+	g.Header("Location", fmt.Sprintf("/slips/%d", created.ID))
+	g.Header("ETag", etag(created.Version))
+	g.JSON(http.StatusCreated, created)
 }
 
+// GetSlip returns a slip with its version as the ETag, answering 304 Not
+// Modified when If-None-Match already names that version. With ?render=html
+// the slip also carries its body rendered as HTML, for clients that cannot
+// render Markdown themselves, under an ETag of its own.
 func (h *Handler) GetSlip(g *gin.Context) {
-	// TODO: handle slip not found
 	paramID := g.Param("id")
 	id, err := strconv.Atoi(paramID)
 	if err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(g, err)
+		return
+	}
+	render := g.Query("render")
+	if render != "" && render != "html" {
+		writeError(g, slip.InvalidError("unknown rendering %q", render))
+		return
+	}
+	s, err := h.service.GetSlip(g.Request.Context(), int64(id))
+	if err != nil {
+		writeError(g, err)
 		return
 	}
-	slip, err := h.service.GetSlip(int64(id))
+	tag := etag(s.Version)
+	if render != "" {
+		tag = renderedETag(s.Version, render)
+	}
+	g.Header("ETag", tag)
+	if noneMatch(g, tag) {
+		g.Status(http.StatusNotModified)
+		return
+	}
+	if render == "" {
+		g.JSON(http.StatusOK, s)
+		return
+	}
+	html, err := archive.HTML(s.Body)
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(g, err)
 		return
 	}
-	g.JSON(http.StatusOK, slip)
+	g.JSON(http.StatusOK, renderedSlip{Slip: s, HTML: html})
+}
+
+// renderedSlip is a slip with its body rendered.
+type renderedSlip struct {
+	slip.Slip
+	HTML string `json:"html"`
 }
 
+// GetAllSlips lists one page of slips. The page size is set with ?limit= and
+// the following page, if any, is advertised in a Link header whose URL carries
+// an opaque ?cursor=. Repeated ?tag= (all of), ?any= (any of) and ?not=
+// (none of) parameters filter on tags.
 func (h *Handler) GetAllSlips(g *gin.Context) {
-	slips, err := h.service.GetAllSlips()
+	opts := slip.ListOptions{
+		Tags:    g.QueryArray("tag"),
+		AnyTags: g.QueryArray("any"),
+		NotTags: g.QueryArray("not"),
+	}
+	if limit := g.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			badRequest(g, err)
+			return
+		}
+		opts.Limit = n
+	}
+	if cursor := g.Query("cursor"); cursor != "" {
+		after, err := slip.ParseCursor(cursor)
+		if err != nil {
+			writeError(g, err)
+			return
+		}
+		opts.After = after
+	}
+
+	page, err := h.service.GetAllSlips(g.Request.Context(), opts)
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(g, err)
+		return
 	}
-	g.JSON(http.StatusOK, slips)
+	if page.Next != nil {
+		g.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL(g.Request.URL, page.Next)))
+	}
+	g.JSON(http.StatusOK, page.Slips)
+}
+
+// nextURL is the request URL with its cursor moved to next, keeping every
+// other query parameter.
+func nextURL(u *url.URL, next *slip.Cursor) string {
+	q := u.Query()
+	q.Set("cursor", next.String())
+	return u.Path + "?" + q.Encode()
+}
+
+// SearchSlips runs the full-text query in ?q= and returns the best matches,
+// at most ?limit= of them.
+func (h *Handler) SearchSlips(g *gin.Context) {
+	opts := slip.SearchOptions{Query: g.Query("q")}
+	if limit := g.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			badRequest(g, err)
+			return
+		}
+		opts.Limit = n
+	}
+
+	results, err := h.service.SearchSlips(g.Request.Context(), opts)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, results)
 }
 
+// UpdateSlip replaces a slip and returns it as stored. With an If-Match
+// header the update only happens if the slip is still at that version, else
+// 412 Precondition Failed.
 func (h *Handler) UpdateSlip(g *gin.Context) {
 	paramID := g.Param("id")
 	id, err := strconv.Atoi(paramID)
 	if err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(g, err)
 		return
 	}
 
 	var slip slip.Slip
 	if err := g.ShouldBindJSON(&slip); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(g, err)
 		return
 	}
 	slip.ID = int64(id)
-	if err := h.service.UpdateSlip(slip); err != nil {
-		g.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	slip.Version, err = h.ifMatchVersion(g, int64(id))
+	if err != nil {
+		writeError(g, err)
 		return
 	}
-	g.JSON(http.StatusOK, gin.H{"message": "OK"})
+	updated, err := h.service.UpdateSlip(g.Request.Context(), slip)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.Header("ETag", etag(updated.Version))
+	g.JSON(http.StatusOK, updated)
 }
 
+// PatchSlip partially updates a slip from a JSON Merge Patch of its body and
+// tags, which may also carry add_tags and remove_tags lists. If-Match is
+// honoured like UpdateSlip.
+func (h *Handler) PatchSlip(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	data, err := g.GetRawData()
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	patch, err := slip.ParsePatch(data)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	patch.Version, err = h.ifMatchVersion(g, id)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	patched, err := h.service.PatchSlip(g.Request.Context(), id, patch)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.Header("ETag", etag(patched.Version))
+	g.JSON(http.StatusOK, patched)
+}
+
+// DeleteSlip moves a slip to the trash, honouring If-Match like UpdateSlip.
 func (h *Handler) DeleteSlip(g *gin.Context) {
 	paramID := g.Param("id")
 	id, err := strconv.Atoi(paramID)
 	if err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(g, err)
 		return
 	}
-	err = h.service.DeleteSlip(int64(id))
+	version, err := h.ifMatchVersion(g, int64(id))
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(g, err)
+		return
+	}
+	err = h.service.DeleteSlip(g.Request.Context(), int64(id), version)
+	if err != nil {
+		writeError(g, err)
+		return
 	}
 	g.JSON(http.StatusOK, gin.H{"message": "OK"})
 }
+
+// batchResponse is the JSON answer to a batch: whether its changes were kept
+// and what became of each operation, in order.
+type batchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+type batchResult struct {
+	Op     string       `json:"op"`
+	ID     int64        `json:"id,omitempty"`
+	Status string       `json:"status"`
+	Slip   *slip.Slip   `json:"slip,omitempty"`
+	Error  *errorDetail `json:"error,omitempty"`
+}
+
+// BatchSlips applies a list of create, update and delete operations as one.
+// If all succeed, or the batch continues on error, the answer is 200 OK;
+// otherwise nothing is kept and the status is that of the failure, such as
+// 412 Precondition Failed for an update of a stale version. Either way the
+// body reports on each operation.
+func (h *Handler) BatchSlips(g *gin.Context) {
+	var batch slip.Batch
+	if err := g.ShouldBindJSON(&batch); err != nil {
+		badRequest(g, err)
+		return
+	}
+	results, err := h.service.ApplyBatch(g.Request.Context(), batch)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+
+	status := http.StatusOK
+	response := batchResponse{Committed: true, Results: make([]batchResult, len(results))}
+	for i, result := range results {
+		op := batch.Operations[i]
+		r := batchResult{Op: op.Op, ID: op.ID, Status: result.Status, Slip: result.Slip}
+		if result.Slip != nil {
+			r.ID = result.Slip.ID
+		}
+		if result.Err != nil {
+			errStatus, detail := describeError(g, result.Err)
+			r.Error = &detail
+			if !batch.ContinueOnError {
+				status, response.Committed = errStatus, false
+			}
+		}
+		response.Results[i] = r
+	}
+	g.JSON(status, response)
+}
+
+// GetTrash lists deleted slips that have not been purged yet.
+func (h *Handler) GetTrash(g *gin.Context) {
+	slips, err := h.service.GetTrash(g.Request.Context())
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, slips)
+}
+
+func (h *Handler) RestoreSlip(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	if err := h.service.RestoreSlip(g.Request.Context(), id); err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// PurgeSlip permanently deletes a slip from the trash.
+func (h *Handler) PurgeSlip(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	if err := h.service.PurgeSlip(g.Request.Context(), id); err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+func (h *Handler) GetRevisions(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	revisions, err := h.service.GetRevisions(g.Request.Context(), id)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, revisions)
+}
+
+func (h *Handler) GetRevision(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	rev, err := int64Param(g, "rev")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	revision, err := h.service.GetRevision(g.Request.Context(), id, rev)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, revision)
+}
+
+// DiffRevisions compares revision ?from= of a slip with revision ?to=, or
+// with the latest revision when ?to= is left out.
+func (h *Handler) DiffRevisions(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	from, err := strconv.ParseInt(g.Query("from"), 10, 64)
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	var to int64
+	if param := g.Query("to"); param != "" {
+		to, err = strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			badRequest(g, err)
+			return
+		}
+	}
+	d, err := h.service.DiffRevisions(g.Request.Context(), id, from, to)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, d)
+}
+
+// GetLinks lists the [[links]] in a slip, each with the slip it leads to, or
+// null where none does.
+func (h *Handler) GetLinks(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	links, err := h.service.GetLinks(g.Request.Context(), id)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, links)
+}
+
+// GetBacklinks lists the slips that link to a slip.
+func (h *Handler) GetBacklinks(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	slips, err := h.service.GetBacklinks(g.Request.Context(), id)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, slips)
+}
+
+func (h *Handler) RestoreRevision(g *gin.Context) {
+	id, err := int64Param(g, "id")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	rev, err := int64Param(g, "rev")
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	if err := h.service.RestoreRevision(g.Request.Context(), id, rev); err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+func (h *Handler) GetTags(g *gin.Context) {
+	tags, err := h.service.GetTags(g.Request.Context())
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, tags)
+}
+
+// RenameTag renames the tag in the path to the "name" given in the body on
+// every slip.
+func (h *Handler) RenameTag(g *gin.Context) {
+	var body struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := g.ShouldBindJSON(&body); err != nil {
+		badRequest(g, err)
+		return
+	}
+	n, err := h.service.RenameTag(g.Request.Context(), g.Param("name"), body.Name)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"updated": n})
+}
+
+func (h *Handler) MergeTags(g *gin.Context) {
+	var merge slip.TagMerge
+	if err := g.ShouldBindJSON(&merge); err != nil {
+		badRequest(g, err)
+		return
+	}
+	n, err := h.service.MergeTags(g.Request.Context(), merge)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"updated": n})
+}
+
+// Export streams the whole notebook as a zip of Markdown files, one per slip,
+// each with its id, tags and timestamps as YAML front matter. markdown is the
+// only ?format= so far.
+func (h *Handler) Export(g *gin.Context) {
+	format := g.DefaultQuery("format", "markdown")
+	if format != "markdown" {
+		writeError(g, slip.InvalidError("unknown export format %q", format))
+		return
+	}
+	g.Header("Content-Type", "application/zip")
+	g.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="meta-%s.zip"`, time.Now().Format("20060102")))
+	err := archive.ExportMarkdownZip(g.Request.Context(), h.service, g.Writer)
+	if err != nil && !g.Writer.Written() {
+		g.Writer.Header().Del("Content-Type")
+		g.Writer.Header().Del("Content-Disposition")
+		writeError(g, err)
+		return
+	}
+	if err != nil {
+		// Too late to change the status. The archive is left without its
+		// central directory, so the client cannot mistake it for a whole one.
+		_ = g.Error(err)
+	}
+}
+
+// Graph writes the graph of slips, tags and links in ?format=json (the
+// default), dot or graphml. ?tag=, ?any= and ?not= filter slips as in a
+// listing; ?root= limits the graph to slips within ?depth= links of a slip,
+// one unless given.
+func (h *Handler) Graph(g *gin.Context) {
+	format := g.DefaultQuery("format", archive.GraphJSON)
+	opts := slip.GraphOptions{
+		Tags:    g.QueryArray("tag"),
+		AnyTags: g.QueryArray("any"),
+		NotTags: g.QueryArray("not"),
+	}
+	if root := g.Query("root"); root != "" {
+		id, err := strconv.ParseInt(root, 10, 64)
+		if err != nil {
+			badRequest(g, err)
+			return
+		}
+		opts.Root, opts.Depth = id, 1
+	}
+	if depth := g.Query("depth"); depth != "" {
+		n, err := strconv.Atoi(depth)
+		if err != nil {
+			badRequest(g, err)
+			return
+		}
+		opts.Depth = n
+	}
+	w, err := archive.NewGraphWriter(format, g.Writer)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+
+	g.Header("Content-Type", archive.GraphContentTypes[format])
+	err = h.service.Graph(g.Request.Context(), opts, w.WriteSlip)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil && !g.Writer.Written() {
+		g.Writer.Header().Del("Content-Type")
+		writeError(g, err)
+		return
+	}
+	if err != nil {
+		// Too late to change the status; the graph is left unfinished.
+		_ = g.Error(err)
+	}
+}
+
+// maxImportBytes caps the size of an import upload, which is read into
+// memory whole.
+const maxImportBytes = 64 << 20
+
+// importFormats maps the content types an import may be sent as to formats,
+// for requests without ?format=.
+var importFormats = map[string]string{
+	"application/zip":      archive.FormatMarkdown,
+	"application/json":     archive.FormatJSON,
+	"text/csv":             archive.FormatCSV,
+	"application/enex+xml": archive.FormatENEX,
+	"application/xml":      archive.FormatENEX,
+	"text/xml":             archive.FormatENEX,
+}
+
+// Import stores every slip in the request body at once, or none of them if
+// any is refused. The body is a zip of Markdown files, a JSON array of slips,
+// CSV, an Evernote export or a Google Takeout zip of Keep notes, named by
+// ?format= or the Content-Type. Keep's zip must be named as ?format=keep.
+// With ?dry_run=true nothing is stored. The response is a slip.ImportReport:
+// 201 Created if the slips were stored, 200 OK for a clean dry run and 400
+// Bad Request if any item was refused.
+func (h *Handler) Import(g *gin.Context) {
+	format := g.Query("format")
+	if format == "" {
+		format = importFormats[g.ContentType()]
+	}
+	if format == "" {
+		writeError(g, slip.InvalidError("give the import format as ?format=markdown, json, csv, enex or keep"))
+		return
+	}
+	dryRun := false
+	if param := g.Query("dry_run"); param != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(param); err != nil {
+			badRequest(g, err)
+			return
+		}
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(g.Writer, g.Request.Body, maxImportBytes))
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	items, err := archive.Read(format, data)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	report, err := h.service.ImportSlips(g.Request.Context(), items, dryRun)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	status := http.StatusCreated
+	switch {
+	case report.Failed > 0:
+		status = http.StatusBadRequest
+	case dryRun:
+		status = http.StatusOK
+	}
+	g.JSON(status, report)
+}
+
+// int64Param parses the named path parameter as an integer.
+func int64Param(g *gin.Context, name string) (int64, error) {
+	return strconv.ParseInt(g.Param(name), 10, 64)
+}
@@ -1,7 +1,11 @@
 package http
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,350 +14,830 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/pmaterer/meta/slip"
+	"github.com/pmaterer/meta/slip/repository"
+	slipservice "github.com/pmaterer/meta/slip/service"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
 	testSlipPayload          = `{"body":"Lorem ipsum","tags":["tag1","tag2","tag3"]}`
 	testSlipPayloadMalformed = `"body":"Lorem ipsum","tags":["tag1","tag2","tag3"]}`
-	testSlipJSONResponse     = `{"id":1,"body":"Lorem ipsum","tags":["tag1","tag2","tag3"],"created_at":"2000-02-01T12:13:14.000000015Z","updated_at":"2000-02-01T12:13:14.000000015Z"}`
-	testSlip                 = slip.Slip{
-		ID:   1,
-		Body: "Lorem ipsum",
-		Tags: []string{
-			"tag1",
-			"tag2",
-			"tag3",
-		},
-		CreatedAt: time.Date(2000, 2, 1, 12, 13, 14, 15, time.UTC),
-		UpdatedAt: time.Date(2000, 2, 1, 12, 13, 14, 15, time.UTC),
-	}
-	testSlipsJSONResponse = `[{"id":2,"body":"Lorem ipsum","tags":["tag1","tag2","tag3"],"created_at":"2000-02-01T12:13:14.000000015Z","updated_at":"2000-02-01T12:13:14.000000015Z"},{"id":3,"body":"nothing to see here","tags":["a","b","c"],"created_at":"2000-02-01T12:13:14.000000015Z","updated_at":"2000-02-01T12:13:14.000000015Z"}]`
-	testSlips             = []slip.Slip{
-		{
-			ID:   2,
-			Body: "Lorem ipsum",
-			Tags: []string{
-				"tag1",
-				"tag2",
-				"tag3",
-			},
-			CreatedAt: time.Date(2000, 2, 1, 12, 13, 14, 15, time.UTC),
-			UpdatedAt: time.Date(2000, 2, 1, 12, 13, 14, 15, time.UTC),
-		},
-		{
-			ID:   3,
-			Body: "nothing to see here",
-			Tags: []string{
-				"a",
-				"b",
-				"c",
-			},
-			CreatedAt: time.Date(2000, 2, 1, 12, 13, 14, 15, time.UTC),
-			UpdatedAt: time.Date(2000, 2, 1, 12, 13, 14, 15, time.UTC),
-		},
-	}
+	testSlipJSONPrefix       = `{"id":1,"title":"Lorem ipsum","body":"Lorem ipsum","tags":["tag1","tag2","tag3"],"version":1,`
 )
 
-type mockService struct {
-	CreateSlipFunc  func(s slip.Slip) error
-	GetSlipFunc     func(id int64) (slip.Slip, error)
-	GetAllSlipsFunc func() ([]slip.Slip, error)
-	UpdateSlipFunc  func(s slip.Slip) error
-	DeleteSlipFunc  func(id int64) error
+// newTestRouter serves the API the way cmd/serve.go routes it, over a real
+// service and an empty in-memory repository, so that requests see each
+// other's effects.
+func newTestRouter() *gin.Engine {
+	h := NewHandler(slipservice.NewService(repository.NewMemoryRepository()))
+	r := gin.Default()
+	r.POST("/slips", h.CreateSlip)
+	r.POST("/slips/batch", h.BatchSlips)
+	r.GET("/slips/search", h.SearchSlips)
+	r.GET("/slips/:id", h.GetSlip)
+	r.GET("/slips", h.GetAllSlips)
+	r.PUT("/slips/:id", h.UpdateSlip)
+	r.PATCH("/slips/:id", h.PatchSlip)
+	r.DELETE("/slips/:id", h.DeleteSlip)
+	r.GET("/slips/:id/revisions", h.GetRevisions)
+	r.GET("/slips/:id/revisions/:rev", h.GetRevision)
+	r.POST("/slips/:id/revisions/:rev/restore", h.RestoreRevision)
+	r.GET("/slips/:id/diff", h.DiffRevisions)
+	r.GET("/slips/:id/links", h.GetLinks)
+	r.GET("/slips/:id/backlinks", h.GetBacklinks)
+	r.GET("/trash", h.GetTrash)
+	r.POST("/trash/:id/restore", h.RestoreSlip)
+	r.DELETE("/trash/:id", h.PurgeSlip)
+	r.GET("/export", h.Export)
+	r.POST("/import", h.Import)
+	r.GET("/graph", h.Graph)
+	r.GET("/tags", h.GetTags)
+	r.POST("/tags/merge", h.MergeTags)
+	r.POST("/tags/:name/rename", h.RenameTag)
+	return r
 }
 
-func (r *mockService) CreateSlip(s slip.Slip) error        { return r.CreateSlipFunc(s) }
-func (r *mockService) GetSlip(id int64) (slip.Slip, error) { return r.GetSlipFunc(id) }
-func (r *mockService) GetAllSlips() ([]slip.Slip, error)   { return r.GetAllSlipsFunc() }
-func (r *mockService) UpdateSlip(s slip.Slip) error        { return r.UpdateSlipFunc(s) }
-func (r *mockService) DeleteSlip(id int64) error           { return r.DeleteSlipFunc(id) }
+// do sends a request to r, with headers given as name, value pairs.
+func do(r http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
 
 func TestCreateSlip(t *testing.T) {
 	tests := []struct {
-		name             string
-		errExpected      bool
-		malformedPayload bool
-		method           func(slip.Slip) error
+		name    string
+		payload string
+		status  int
 	}{
-		{
-			name:             "Create slip OK",
-			errExpected:      false,
-			malformedPayload: false,
-			method: func(s slip.Slip) error {
-				return nil
-			},
-		},
-		{
-			name:             "Create slip malformed",
-			errExpected:      true,
-			malformedPayload: true,
-			method: func(s slip.Slip) error {
-				return nil
-			},
-		},
-		{
-			name:             "Create slip error",
-			errExpected:      true,
-			malformedPayload: false,
-			method: func(s slip.Slip) error {
-				return errors.New("kabam")
-			},
-		},
+		{name: "Create slip OK", payload: testSlipPayload, status: http.StatusCreated},
+		{name: "Create slip malformed", payload: testSlipPayloadMalformed, status: http.StatusBadRequest},
+		{name: "Create slip invalid", payload: `{"body":"x","tags":["a","a"]}`, status: http.StatusBadRequest},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &mockService{
-				CreateSlipFunc: tt.method,
+			w := do(newTestRouter(), "POST", "/slips", tt.payload)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusCreated {
+				assert.Equal(t, "/slips/1", w.Header().Get("Location"))
+				assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+				assert.True(t, strings.HasPrefix(w.Body.String(), testSlipJSONPrefix), w.Body.String())
 			}
-			h := NewHandler(s)
+		})
+	}
+}
 
-			r := gin.Default()
-			r.POST("/slips", h.CreateSlip)
+func TestGetSlip(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", testSlipPayload)
 
-			w := httptest.NewRecorder()
-			if tt.malformedPayload {
-				req, _ := http.NewRequest("POST", "/slips", strings.NewReader(testSlipPayloadMalformed))
-				r.ServeHTTP(w, req)
-			} else {
-				req, _ := http.NewRequest("POST", "/slips", strings.NewReader(testSlipPayload))
-				r.ServeHTTP(w, req)
-			}
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{name: "Get slip OK", url: "/slips/1", status: http.StatusOK},
+		{name: "Get slip missing", url: "/slips/2", status: http.StatusNotFound},
+		{name: "Get slip malformed", url: "/slips/x", status: http.StatusBadRequest},
+	}
 
-			if tt.errExpected {
-				if tt.malformedPayload {
-					assert.Equal(t, http.StatusBadRequest, w.Code)
-				} else {
-					assert.Equal(t, http.StatusInternalServerError, w.Code)
-				}
-			} else {
-				assert.Equal(t, http.StatusOK, w.Code)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(r, "GET", tt.url, "")
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+				assert.True(t, strings.HasPrefix(w.Body.String(), testSlipJSONPrefix), w.Body.String())
 			}
+		})
+	}
+}
+
+func TestGetSlipRendered(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"# Reading list\n\n- [ ] *Dune*\n\n<script>x()</script>"}`)
+
+	w := do(r, "GET", "/slips/1?render=html", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1-html"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `{"id":1,"title":"Reading list","body":"# Reading list`)
+	assert.Contains(t, w.Body.String(), `"html":"\u003ch1\u003eReading list\u003c/h1\u003e\n\u003cul\u003e\n\u003cli\u003e\u003cinput disabled=\"\" type=\"checkbox\"\u003e \u003cem\u003eDune\u003c/em\u003e\u003c/li\u003e\n\u003c/ul\u003e\n\u003c!-- raw HTML omitted --\u003e\n"}`)
+
+	// Neither representation stands in for the other.
+	w = do(r, "GET", "/slips/1?render=html", "", "If-None-Match", `"1"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(r, "GET", "/slips/1", "", "If-None-Match", `"1-html"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(r, "GET", "/slips/1?render=html", "", "If-None-Match", `"1-html"`)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = do(r, "GET", "/slips/1?render=pdf", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetAllSlips(t *testing.T) {
+	r := newTestRouter()
+	w := do(r, "GET", "/slips", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `[]`, w.Body.String())
+
+	do(r, "POST", "/slips", testSlipPayload)
+	do(r, "POST", "/slips", `{"body":"nothing to see here","tags":["a","b","c"]}`)
+
+	w = do(r, "GET", "/slips", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "["+testSlipJSONPrefix), body)
+	assert.Contains(t, body, `{"id":2,"title":"nothing to see here","body":"nothing to see here","tags":["a","b","c"],"version":1,`)
+	assert.Empty(t, w.Header().Get("Link"))
+}
+
+func TestGetAllSlipsPagination(t *testing.T) {
+	r := newTestRouter()
+	for _, body := range []string{"one", "two", "three"} {
+		do(r, "POST", "/slips", `{"body":"`+body+`"}`)
+	}
+
+	w := do(r, "GET", "/slips?limit=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"two"`)
+	assert.NotContains(t, w.Body.String(), `"body":"three"`)
+	link := w.Header().Get("Link")
+	assert.True(t, strings.HasPrefix(link, `</slips?cursor=`), link)
+	assert.True(t, strings.HasSuffix(link, `&limit=2>; rel="next"`), link)
+
+	next := strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<")
+	w = do(r, "GET", next, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"three"`)
+	assert.NotContains(t, w.Body.String(), `"body":"two"`)
+	assert.Empty(t, w.Header().Get("Link"))
+}
+
+func TestGetAllSlipsTagFilters(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"match","tags":["go","notes","work"]}`)
+	do(r, "POST", "/slips", `{"body":"archived","tags":["go","notes","home","archived"]}`)
+	do(r, "POST", "/slips", `{"body":"no notes","tags":["go","home"]}`)
+	do(r, "POST", "/slips", `{"body":"neither","tags":["go","notes"]}`)
+
+	w := do(r, "GET", "/slips?tag=go&tag=notes&any=work&any=home&not=archived", "")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"match"`)
+	assert.Equal(t, 1, strings.Count(w.Body.String(), `"id":`), w.Body.String())
+}
+
+func TestGetAllSlipsMalformed(t *testing.T) {
+	r := newTestRouter()
+
+	for _, query := range []string{"limit=x", "cursor=%21%21"} {
+		t.Run(query, func(t *testing.T) {
+			w := do(r, "GET", "/slips?"+query, "")
 
+			assert.Equal(t, http.StatusBadRequest, w.Code)
 		})
 	}
 }
 
-func TestGetSlip(t *testing.T) {
+func TestSearchSlips(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"Lorem ipsum dolor"}`)
+	do(r, "POST", "/slips", `{"body":"Lorem ipsum, lorem ipsum"}`)
+	do(r, "POST", "/slips", `{"body":"Lorem sit amet"}`)
+
 	tests := []struct {
-		name             string
-		errExpected      bool
-		malformedRequest bool
-		method           func(id int64) (slip.Slip, error)
+		name   string
+		url    string
+		status int
 	}{
-		{
-			name:             "Get slip OK",
-			errExpected:      false,
-			malformedRequest: false,
-			method: func(id int64) (slip.Slip, error) {
-				return testSlip, nil
-			},
-		},
-		{
-			name:             "Get slip error",
-			errExpected:      true,
-			malformedRequest: false,
-			method: func(id int64) (slip.Slip, error) {
-				return testSlip, errors.New("bad times")
-			},
-		},
-		{
-			name:             "Get slip malformed",
-			errExpected:      true,
-			malformedRequest: true,
-			method: func(id int64) (slip.Slip, error) {
-				return testSlip, errors.New("bad times")
-			},
-		},
+		{name: "Search slips OK", url: "/slips/search?q=%22lorem+ipsum%22+-dolor&limit=5", status: http.StatusOK},
+		{name: "Search slips malformed limit", url: "/slips/search?q=lorem&limit=x", status: http.StatusBadRequest},
+		{name: "Search slips invalid", url: "/slips/search", status: http.StatusBadRequest},
+		{name: "Search slips without words", url: "/slips/search?q=*", status: http.StatusBadRequest},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &mockService{
-				GetSlipFunc: tt.method,
+			w := do(r, "GET", tt.url, "")
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"body":"Lorem ipsum, lorem ipsum"`)
+				assert.Contains(t, w.Body.String(), `"snippet":"\u003cb\u003eLorem`)
+				assert.Equal(t, 1, strings.Count(w.Body.String(), `"id":`), w.Body.String())
 			}
-			h := NewHandler(s)
+		})
+	}
+}
 
-			r := gin.Default()
-			r.GET("/slips/:id", h.GetSlip)
-			w := httptest.NewRecorder()
+func TestUpdateSlip(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", testSlipPayload)
 
-			if tt.malformedRequest {
-				req, _ := http.NewRequest("GET", "/slips/x", nil)
-				r.ServeHTTP(w, req)
-			} else {
-				req, _ := http.NewRequest("GET", "/slips/1", nil)
-				r.ServeHTTP(w, req)
+	tests := []struct {
+		name    string
+		url     string
+		payload string
+		status  int
+	}{
+		{name: "Update slip OK", url: "/slips/1", payload: `{"body":"Dolor sit amet","tags":["tag1"]}`, status: http.StatusOK},
+		{name: "Update slip missing", url: "/slips/2", payload: testSlipPayload, status: http.StatusNotFound},
+		{name: "Update slip invalid", url: "/slips/1", payload: `{"body":"x","tags":[""]}`, status: http.StatusBadRequest},
+		{name: "Update slip malformed payload", url: "/slips/1", payload: testSlipPayloadMalformed, status: http.StatusBadRequest},
+		{name: "Update slip malformed id", url: "/slips/x", payload: testSlipPayload, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(r, "PUT", tt.url, tt.payload)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+				assert.Contains(t, w.Body.String(), `"body":"Dolor sit amet","tags":["tag1"],"version":2`)
 			}
+		})
+	}
+}
+
+func TestDeleteSlip(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", testSlipPayload)
+
+	// Each case runs against what the ones before it left behind.
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{name: "Delete slip OK", url: "/slips/1", status: http.StatusOK},
+		{name: "Delete slip again", url: "/slips/1", status: http.StatusNotFound},
+		{name: "Delete slip malformed", url: "/slips/x", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(r, "DELETE", tt.url, "")
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestSlipNotFound(t *testing.T) {
+	r := newTestRouter()
+
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{method: "GET"},
+		{method: "PUT", body: testSlipPayload},
+		{method: "DELETE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			w := do(r, tt.method, "/slips/7", tt.body)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Equal(t, `{"error":{"code":"not_found","message":"slip 7: not found"}}`, w.Body.String())
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "Not found", err: slip.NotFoundError(1), status: http.StatusNotFound, code: "not_found"},
+		{name: "Invalid", err: slip.InvalidError("bad tag"), status: http.StatusBadRequest, code: "invalid"},
+		{name: "Conflict", err: fmt.Errorf("%w: duplicate key", slip.ErrConflict), status: http.StatusConflict, code: "conflict"},
+		{name: "Timeout", err: context.DeadlineExceeded, status: http.StatusGatewayTimeout, code: "timeout"},
+		{name: "Canceled", err: context.Canceled, status: statusClientClosedRequest, code: "canceled"},
+		{name: "Other", err: errors.New("boom"), status: http.StatusInternalServerError, code: "internal"},
+	}
 
-			if tt.malformedRequest {
-				assert.Equal(t, http.StatusBadRequest, w.Code)
-			} else if tt.errExpected {
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
-			} else {
-				assert.Equal(t, http.StatusOK, w.Code)
-				assert.Equal(t, testSlipJSONResponse, w.Body.String())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			g, _ := gin.CreateTestContext(w)
+			g.Request = httptest.NewRequest("GET", "/", nil)
+			writeError(g, tt.err)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Contains(t, w.Body.String(), `"code":"`+tt.code+`"`)
+		})
+	}
+}
+
+func TestGetTags(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"a","tags":["go","notes"]}`)
+	do(r, "POST", "/slips", `{"body":"b","tags":["go"]}`)
+
+	w := do(r, "GET", "/tags", "")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `[{"name":"go","count":2},{"name":"notes","count":1}]`, w.Body.String())
+}
+
+func TestRenameAndMergeTags(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"a","tags":["golang"]}`)
+	do(r, "POST", "/slips", `{"body":"b","tags":["golang","go-lang"]}`)
+	do(r, "POST", "/slips", `{"body":"c","tags":["taken"]}`)
+
+	// Each case runs against what the ones before it left behind.
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+		result string
+	}{
+		{name: "Rename malformed", url: "/tags/golang/rename", body: `{}`, status: http.StatusBadRequest},
+		{name: "Rename conflict", url: "/tags/golang/rename", body: `{"name":"taken"}`, status: http.StatusConflict},
+		{name: "Rename missing", url: "/tags/nope/rename", body: `{"name":"go"}`, status: http.StatusNotFound},
+		{name: "Rename OK", url: "/tags/golang/rename", body: `{"name":"go"}`, status: http.StatusOK, result: `{"updated":2}`},
+		{name: "Merge OK", url: "/tags/merge", body: `{"from":["go-lang"],"into":"go"}`, status: http.StatusOK, result: `{"updated":1}`},
+		{name: "Merge malformed", url: "/tags/merge", body: `{"from":`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(r, "POST", tt.url, tt.body)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.result != "" {
+				assert.Equal(t, tt.result, w.Body.String())
 			}
 		})
 	}
+
+	w := do(r, "GET", "/tags", "")
+	assert.Equal(t, `[{"name":"go","count":2},{"name":"taken","count":1}]`, w.Body.String())
 }
 
-func TestGetAllSlips(t *testing.T) {
+func TestRevisions(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"Lorem ipsum","tags":["tag1"]}`)
+	do(r, "PUT", "/slips/1", `{"body":"Dolor sit amet","tags":["tag1"]}`)
+
 	tests := []struct {
-		name        string
-		errExpected bool
-		method      func() ([]slip.Slip, error)
+		name   string
+		method string
+		url    string
+		status int
+		body   string
 	}{
 		{
-			name:        "Get all slips OK",
-			errExpected: false,
-			method: func() ([]slip.Slip, error) {
-				return testSlips, nil
-			},
+			name:   "List revisions",
+			method: "GET",
+			url:    "/slips/1/revisions",
+			status: http.StatusOK,
+			body:   `{"slip_id":1,"revision":2,"body":"Dolor sit amet","tags":["tag1"],`,
 		},
+		{name: "List revisions malformed", method: "GET", url: "/slips/x/revisions", status: http.StatusBadRequest},
+		{name: "Get revision", method: "GET", url: "/slips/1/revisions/1", status: http.StatusOK, body: `"body":"Lorem ipsum"`},
+		{name: "Get revision missing", method: "GET", url: "/slips/1/revisions/5", status: http.StatusNotFound},
+		{name: "Get revision malformed", method: "GET", url: "/slips/1/revisions/x", status: http.StatusBadRequest},
 		{
-			name:        "Get all slips error",
-			errExpected: true,
-			method: func() ([]slip.Slip, error) {
-				return testSlips, errors.New("uh oh")
-			},
+			name:   "Diff revisions",
+			method: "GET",
+			url:    "/slips/1/diff?from=1",
+			status: http.StatusOK,
+			body:   `{"from":1,"to":2,"added_tags":[],"removed_tags":[],"body":"`,
 		},
+		{name: "Diff revisions malformed", method: "GET", url: "/slips/1/diff?from=1&to=x", status: http.StatusBadRequest},
+		{name: "Restore revision", method: "POST", url: "/slips/1/revisions/1/restore", status: http.StatusOK},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &mockService{
-				GetAllSlipsFunc: tt.method,
+			w := do(r, tt.method, tt.url, "")
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Contains(t, w.Body.String(), tt.body)
+		})
+	}
+
+	w := do(r, "GET", "/slips/1", "")
+	assert.Contains(t, w.Body.String(), `"body":"Lorem ipsum"`)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+}
+
+func TestConditionalRequests(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", testSlipPayload)
+
+	// Each case runs against what the ones before it left behind, so the
+	// slip's version goes up with every update that succeeds.
+	tests := []struct {
+		name    string
+		method  string
+		headers []string
+		status  int
+		etag    string
+	}{
+		{name: "Get modified", method: "GET", headers: []string{"If-None-Match", `"0"`}, status: http.StatusOK, etag: `"1"`},
+		{name: "Get not modified", method: "GET", headers: []string{"If-None-Match", `"0", W/"1"`}, status: http.StatusNotModified, etag: `"1"`},
+		{name: "Get any", method: "GET", headers: []string{"If-None-Match", "*"}, status: http.StatusNotModified, etag: `"1"`},
+		{name: "Update current", method: "PUT", headers: []string{"If-Match", `"1"`}, status: http.StatusOK, etag: `"2"`},
+		{name: "Update unconditional", method: "PUT", status: http.StatusOK, etag: `"3"`},
+		{name: "Update any", method: "PUT", headers: []string{"If-Match", "*"}, status: http.StatusOK, etag: `"4"`},
+		{name: "Update stale", method: "PUT", headers: []string{"If-Match", `"2"`}, status: http.StatusPreconditionFailed},
+		{name: "Update weak", method: "PUT", headers: []string{"If-Match", `W/"4"`}, status: http.StatusPreconditionFailed},
+		{name: "Update foreign tag", method: "PUT", headers: []string{"If-Match", `"four"`}, status: http.StatusPreconditionFailed},
+		{name: "Update malformed", method: "PUT", headers: []string{"If-Match", `four`}, status: http.StatusBadRequest},
+		{name: "Update listed", method: "PUT", headers: []string{"If-Match", `"2", "4"`}, status: http.StatusOK, etag: `"5"`},
+		{name: "Update listed stale", method: "PUT", headers: []string{"If-Match", `"2", W/"5", "3"`}, status: http.StatusPreconditionFailed},
+		{name: "Delete stale", method: "DELETE", headers: []string{"If-Match", `"1"`}, status: http.StatusPreconditionFailed},
+		{name: "Delete current", method: "DELETE", headers: []string{"If-Match", `"5"`}, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(r, tt.method, "/slips/1", testSlipPayload, tt.headers...)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.etag != "" {
+				assert.Equal(t, tt.etag, w.Header().Get("ETag"))
+			}
+			if tt.status == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
 			}
-			h := NewHandler(s)
+		})
+	}
+}
 
-			r := gin.Default()
-			r.GET("/slips", h.GetAllSlips)
+func TestTrash(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", testSlipPayload)
+	do(r, "POST", "/slips", `{"body":"kept"}`)
+	do(r, "DELETE", "/slips/1", "")
 
-			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/slips", nil)
-			r.ServeHTTP(w, req)
-
-			if tt.errExpected {
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
-			} else {
-				assert.Equal(t, http.StatusOK, w.Code)
-				assert.Equal(t, testSlipsJSONResponse, w.Body.String())
+	// Each case runs against what the ones before it left behind.
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+	}{
+		{name: "List trash", method: "GET", url: "/trash", status: http.StatusOK},
+		{name: "Restore", method: "POST", url: "/trash/1/restore", status: http.StatusOK},
+		{name: "Restore missing", method: "POST", url: "/trash/2/restore", status: http.StatusNotFound},
+		{name: "Restore malformed", method: "POST", url: "/trash/x/restore", status: http.StatusBadRequest},
+		{name: "Purge live", method: "DELETE", url: "/trash/1", status: http.StatusNotFound},
+		{name: "Delete", method: "DELETE", url: "/slips/1", status: http.StatusOK},
+		{name: "Purge", method: "DELETE", url: "/trash/1", status: http.StatusOK},
+		{name: "Purge missing", method: "DELETE", url: "/trash/1", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(r, tt.method, tt.url, "")
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.url == "/trash" {
+				assert.Contains(t, w.Body.String(), `[{"id":1,"title":"Lorem ipsum",`)
+				assert.Contains(t, w.Body.String(), `"deleted_at":"`)
+				assert.NotContains(t, w.Body.String(), `"body":"kept"`)
 			}
 		})
 	}
+
+	w := do(r, "GET", "/trash", "")
+	assert.Equal(t, `[]`, w.Body.String())
 }
 
-func TestUpdateSlip(t *testing.T) {
+func TestPatchSlip(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", testSlipPayload)
+
+	// Each case runs against what the ones before it left behind.
 	tests := []struct {
-		name             string
-		errExpected      bool
-		malformedPayload bool
-		method           func(slip slip.Slip) error
+		name    string
+		payload string
+		ifMatch string
+		status  int
+		body    string
 	}{
 		{
-			name:             "Update slip OK",
-			errExpected:      false,
-			malformedPayload: false,
-			method: func(s slip.Slip) error {
-				return nil
-			},
+			name:    "Patch tags",
+			payload: `{"add_tags":["tag4"],"remove_tags":["tag1"]}`,
+			status:  http.StatusOK,
+			body:    `"tags":["tag2","tag3","tag4"]`,
 		},
 		{
-			name:             "Update slip error",
-			errExpected:      true,
-			malformedPayload: false,
-			method: func(s slip.Slip) error {
-				return errors.New("boom")
-			},
-		},
-		{
-			name:             "Update slip malformed payload",
-			errExpected:      true,
-			malformedPayload: true,
-			method: func(s slip.Slip) error {
-				return errors.New("boom")
-			},
+			name:    "Patch body",
+			payload: `{"body":"Dolor sit amet"}`,
+			ifMatch: `"2"`,
+			status:  http.StatusOK,
+			body:    `"body":"Dolor sit amet"`,
 		},
+		{name: "Patch stale", payload: `{"body":"x"}`, ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "Patch read-only", payload: `{"created_at":"2001-01-01T00:00:00Z"}`, status: http.StatusBadRequest},
+		{name: "Patch malformed", payload: testSlipPayloadMalformed, status: http.StatusBadRequest},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &mockService{
-				UpdateSlipFunc: tt.method,
+			headers := []string{"Content-Type", "application/merge-patch+json"}
+			if tt.ifMatch != "" {
+				headers = append(headers, "If-Match", tt.ifMatch)
 			}
-			h := NewHandler(s)
+			w := do(r, "PATCH", "/slips/1", tt.payload, headers...)
 
-			r := gin.Default()
-			r.PUT("/slips/:id", h.UpdateSlip)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Contains(t, w.Body.String(), tt.body)
+		})
+	}
+}
 
-			w := httptest.NewRecorder()
+func TestTimeout(t *testing.T) {
+	r := gin.Default()
+	r.Use(Timeout(time.Millisecond))
+	r.GET("/slow", func(g *gin.Context) {
+		// The driver reports a query cancelled by the deadline as an
+		// error of its own.
+		<-g.Request.Context().Done()
+		writeError(g, errors.New("pq: canceling statement due to user request"))
+	})
 
-			if tt.malformedPayload {
-				req, _ := http.NewRequest("PUT", "/slips/1", strings.NewReader(testSlipPayloadMalformed))
-				r.ServeHTTP(w, req)
-			} else {
-				req, _ := http.NewRequest("PUT", "/slips/1", strings.NewReader(testSlipPayload))
-				r.ServeHTTP(w, req)
-			}
+	w := do(r, "GET", "/slow", "")
 
-			if tt.errExpected {
-				if tt.malformedPayload {
-					assert.Equal(t, http.StatusBadRequest, w.Code)
-				} else {
-					assert.Equal(t, http.StatusInternalServerError, w.Code)
-				}
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"timeout"`)
+}
 
-			} else {
-				assert.Equal(t, http.StatusOK, w.Code)
-			}
-		})
+func TestSlipLifecycle(t *testing.T) {
+	r := newTestRouter()
+
+	w := do(r, "POST", "/slips", `{"body":"first","tags":["a","b"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/slips/1", w.Header().Get("Location"))
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	w = do(r, "POST", "/slips", `{"body":"second","tags":["b"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/slips/2", w.Header().Get("Location"))
+
+	w = do(r, "GET", "/slips?tag=a", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"first"`)
+	assert.NotContains(t, w.Body.String(), `"body":"second"`)
+	w = do(r, "GET", "/slips?limit=1", "")
+	assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+
+	w = do(r, "PATCH", "/slips/1", `{"add_tags":["c"],"remove_tags":["a"]}`, "If-Match", `"1"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"tags":["b","c"]`)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	w = do(r, "PATCH", "/slips/1", `{"body":"stale"}`, "If-Match", `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = do(r, "GET", "/slips/1", "", "If-None-Match", `"2"`)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	w = do(r, "GET", "/slips/1/revisions", "")
+	assert.Contains(t, w.Body.String(), `"revision":2`)
+
+	w = do(r, "DELETE", "/slips/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(r, "GET", "/slips/1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(r, "GET", "/trash", "")
+	assert.Contains(t, w.Body.String(), `"id":1`)
+	w = do(r, "POST", "/trash/1/restore", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(r, "GET", "/slips/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestExport(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", testSlipPayload)
+	do(r, "POST", "/slips", `{"body":"nothing to see here","tags":["a","b","c"]}`)
+
+	w := do(r, "GET", "/export?format=markdown", "")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	z, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(t, err)
+	if assert.Len(t, z.File, 2) {
+		assert.Equal(t, "000001-lorem-ipsum.md", z.File[0].Name)
+		assert.Equal(t, "000002-nothing-to-see-here.md", z.File[1].Name)
 	}
+
+	w = do(r, "GET", "/export?format=pdf", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
 }
 
-func TestDeleteSlip(t *testing.T) {
+func TestImport(t *testing.T) {
+	r := newTestRouter()
+
 	tests := []struct {
 		name        string
-		errExpected bool
-		method      func(id int64) error
+		query       string
+		contentType string
+		body        string
+		wantStatus  int
+		wantReport  string
 	}{
 		{
-			name:        "Delete slip OK",
-			errExpected: false,
-			method: func(id int64) error {
-				return nil
-			},
+			name:        "JSON by content type",
+			contentType: "application/json",
+			body:        `[{"body":"a"},{"body":"b","tags":["x"]}]`,
+			wantStatus:  http.StatusCreated,
+			wantReport:  `"dry_run":false,"imported":2,"failed":0`,
+		},
+		{
+			name:       "CSV dry run",
+			query:      "?format=csv&dry_run=true",
+			body:       "body,tags\nhello,\"a,b\"\n",
+			wantStatus: http.StatusOK,
+			wantReport: `"dry_run":true,"imported":0,"failed":0`,
+		},
+		{
+			name:       "Refused items",
+			query:      "?format=json",
+			body:       `[{"body":"a"},{"body":"b","tags":["x","x"]}]`,
+			wantStatus: http.StatusBadRequest,
+			wantReport: `"dry_run":false,"imported":0,"failed":1`,
+		},
+		{
+			name:       "Unknown format",
+			query:      "?format=xml",
+			wantStatus: http.StatusBadRequest,
 		},
 		{
-			name:        "Delete slip error",
-			errExpected: true,
-			method: func(id int64) error {
-				return errors.New("boom")
-			},
+			name:       "No format",
+			body:       `[]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Malformed JSON",
+			query:      "?format=json",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Malformed dry_run",
+			query:      "?format=json&dry_run=maybe",
+			body:       `[]`,
+			wantStatus: http.StatusBadRequest,
 		},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &mockService{
-				DeleteSlipFunc: tt.method,
+			var headers []string
+			if tt.contentType != "" {
+				headers = []string{"Content-Type", tt.contentType}
 			}
-			h := NewHandler(s)
+			w := do(r, "POST", "/import"+tt.query, tt.body, headers...)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantReport)
+		})
+	}
 
-			r := gin.Default()
-			r.DELETE("/slips/:id", h.DeleteSlip)
+	// Only the first import stored anything.
+	w := do(r, "GET", "/slips", "")
+	assert.Equal(t, 2, strings.Count(w.Body.String(), `"id":`), w.Body.String())
+}
 
-			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("DELETE", "/slips/1", nil)
-			r.ServeHTTP(w, req)
+func TestExportImportRoundTrip(t *testing.T) {
+	from, to := newTestRouter(), newTestRouter()
 
-			if tt.errExpected {
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
-			} else {
-				assert.Equal(t, http.StatusOK, w.Code)
-			}
-		})
+	for _, body := range []string{
+		`{"body":"first\n\nwith a paragraph","tags":["a","b c"]}`,
+		`{"body":"second","tags":["c"]}`,
+	} {
+		w := do(from, "POST", "/slips", body)
+		assert.Equal(t, http.StatusCreated, w.Code)
 	}
+	exported := do(from, "GET", "/export", "").Body.String()
 
+	w := do(to, "POST", "/import", exported, "Content-Type", "application/zip")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"imported":2`)
+
+	// The slips come back with new ids but their original content and
+	// timestamps.
+	assert.Equal(t, do(from, "GET", "/slips", "").Body.String(), do(to, "GET", "/slips", "").Body.String())
+}
+
+func TestBatchSlips(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"one"}`)
+	do(r, "POST", "/slips", `{"body":"two"}`)
+
+	// The stale update fails, so the create before it is undone and the
+	// delete after it never runs.
+	w := do(r, "POST", "/slips/batch", `{"operations":[
+		{"op":"create","body":"three"},
+		{"op":"update","id":1,"version":7,"body":"stale"},
+		{"op":"delete","id":2}
+	]}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `{"committed":false,"results":[`+
+		`{"op":"create","status":"rolled_back"},`+
+		`{"op":"update","id":1,"status":"failed","error":{"code":"precondition_failed","message":"slip 1 is at version 1, not 7: version mismatch"}},`+
+		`{"op":"delete","id":2,"status":"skipped"}]}`, w.Body.String())
+	w = do(r, "GET", "/slips", "")
+	assert.Contains(t, w.Body.String(), `"body":"two"`)
+	assert.NotContains(t, w.Body.String(), `"body":"three"`)
+
+	w = do(r, "POST", "/slips/batch", `{"continue_on_error":true,"operations":[
+		{"op":"create","body":"three","tags":["x"]},
+		{"op":"update","id":9,"body":"missing"},
+		{"op":"update","id":1,"version":1,"body":"one, edited"},
+		{"op":"delete","id":2}
+	]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `{"committed":true,"results":[{"op":"create","id":3,"status":"applied","slip":{"id":3,"title":"three","body":"three","tags":["x"]`)
+	assert.Contains(t, w.Body.String(), `{"op":"update","id":9,"status":"failed","error":{"code":"not_found"`)
+	assert.Contains(t, w.Body.String(), `{"op":"delete","id":2,"status":"applied"}`)
+	w = do(r, "GET", "/slips", "")
+	assert.Contains(t, w.Body.String(), `"body":"one, edited"`)
+	assert.NotContains(t, w.Body.String(), `"body":"two"`)
+
+	for _, body := range []string{`{"operations":[]}`, `{"operations":`, `{"operations":[{"op":"frobnicate"}]}`} {
+		w = do(r, "POST", "/slips/batch", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"# Reading list\n\n- Dune"}`)
+	do(r, "POST", "/slips", `{"body":"See [[reading list]] and [[Nowhere]]."}`)
+
+	w := do(r, "GET", "/slips/2/links", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `[{"target":"reading list","slip":{"id":1,"title":"Reading list","body":"# Reading list\n\n- Dune"`)
+	assert.Contains(t, w.Body.String(), `{"target":"Nowhere","slip":null}]`)
+	w = do(r, "GET", "/slips/1/backlinks", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `[{"id":2,"title":"See [[reading list]] and [[Nowhere]].","body":"See [[reading list]] and [[Nowhere]]."`)
+
+	// Editing the links out of a slip removes its backlinks.
+	do(r, "PATCH", "/slips/2", `{"body":"No links now."}`)
+	w = do(r, "GET", "/slips/1/backlinks", "")
+	assert.Equal(t, `[]`, w.Body.String())
+	w = do(r, "GET", "/slips/2/links", "")
+	assert.Equal(t, `[]`, w.Body.String())
+
+	w = do(r, "GET", "/slips/9/links", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(r, "GET", "/slips/x/backlinks", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGraph(t *testing.T) {
+	r := newTestRouter()
+	do(r, "POST", "/slips", `{"body":"Dune","tags":["books"]}`)
+	do(r, "POST", "/slips", `{"body":"Reading list\n\n[[Dune]]"}`)
+	do(r, "POST", "/slips", `{"body":"Unrelated","tags":["books"]}`)
+
+	w := do(r, "GET", "/graph", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `{"source":"slip:2","target":"slip:1","kind":"link"}`)
+
+	w = do(r, "GET", "/graph?format=dot&root=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/vnd.graphviz", w.Header().Get("Content-Type"))
+	assert.Equal(t, `digraph meta {
+  "slip:1" [label="Dune", shape=box];
+  "tag:books" [label="books", shape=ellipse];
+  "slip:1" -> "tag:books" [style=dashed];
+  "slip:2" [label="Reading list", shape=box];
+  "slip:2" -> "slip:1";
+}
+`, w.Body.String())
+
+	w = do(r, "GET", "/graph?format=graphml&tag=books", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"slip:2"`)
+
+	for _, path := range []string{"/graph?format=svg", "/graph?depth=2", "/graph?root=x", "/graph?depth=x&root=1"} {
+		w = do(r, "GET", path, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+	w = do(r, "GET", "/graph?format=dot&root=9", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
 }
@@ -0,0 +1,24 @@
+package http
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout bounds how long a request may take, including the database
+// queries it runs. A request running out of time is answered with 504
+// Gateway Timeout. A zero duration means no limit.
+func Timeout(d time.Duration) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if d <= 0 {
+			g.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(g.Request.Context(), d)
+		defer cancel()
+		g.Request = g.Request.WithContext(ctx)
+		g.Next()
+	}
+}
@@ -0,0 +1,524 @@
+// Package web serves pages for reading and writing slips in a browser. The
+// pages are rendered on the server and work with plain links and forms, no
+// JavaScript needed.
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/slip"
+	"github.com/pmaterer/meta/slip/archive"
+)
+
+type service interface {
+	CreateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	GetSlip(ctx context.Context, id int64) (slip.Slip, error)
+	GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error)
+	SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error)
+	UpdateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	DeleteSlip(ctx context.Context, id, version int64) error
+	GetTags(ctx context.Context) ([]slip.Tag, error)
+}
+
+//go:embed templates static
+var files embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"markdown": markdown,
+	"snippet":  snippet,
+	"date":     date,
+	"join":     strings.Join,
+}).ParseFS(files, "templates/*.html"))
+
+// Static serves the stylesheet the pages use.
+func Static() http.FileSystem {
+	static, err := fs.Sub(files, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(static)
+}
+
+type Handler struct {
+	service service
+}
+
+func NewHandler(s service) *Handler {
+	return &Handler{
+		service: s,
+	}
+}
+
+// layout is what every page shows around its content.
+type layout struct {
+	// Title names the page in the browser.
+	Title string
+	// Query fills the search box.
+	Query string
+	// CSRF is the token the forms on the page post back.
+	CSRF string
+}
+
+// formLayout is the layout of a page with a form on it.
+func formLayout(g *gin.Context, title string) layout {
+	return layout{Title: title, CSRF: g.GetString(csrfKey)}
+}
+
+// facet is a tag to filter the list by, or to stop filtering by once
+// Selected.
+type facet struct {
+	slip.Tag
+	Selected bool
+	URL      string
+}
+
+type listPage struct {
+	layout
+	Facets   []facet
+	Selected []string
+	Slips    []slip.Slip
+	Results  []slip.SearchResult
+	Next     string
+}
+
+type slipPage struct {
+	layout
+	Slip slip.Slip
+}
+
+type formPage struct {
+	layout
+	// Action is where the form is posted.
+	Action  string
+	Slip    slip.Slip
+	Tags    string
+	Preview bool
+	Error   string
+}
+
+type errorPage struct {
+	layout
+	Status  int
+	Message string
+}
+
+// Home sends visitors to the list of slips.
+func (h *Handler) Home(g *gin.Context) {
+	g.Redirect(http.StatusFound, "/ui/")
+}
+
+// List shows the slips, oldest first, filtered by the tags picked from the
+// tag list beside them, or the results of a search with ?q=.
+func (h *Handler) List(g *gin.Context) {
+	ctx := g.Request.Context()
+	page := listPage{
+		layout:   layout{Title: "Slips", Query: strings.TrimSpace(g.Query("q"))},
+		Selected: g.QueryArray("tag"),
+	}
+	tags, err := h.service.GetTags(ctx)
+	if err != nil {
+		h.fail(g, err)
+		return
+	}
+	page.Facets = facets(tags, page.Selected)
+
+	if page.Query != "" {
+		page.Title = page.Query
+		page.Results, err = h.service.SearchSlips(ctx, slip.SearchOptions{Query: page.Query})
+		if err != nil {
+			h.fail(g, err)
+			return
+		}
+		h.render(g, http.StatusOK, "list.html", page)
+		return
+	}
+
+	opts := slip.ListOptions{Tags: page.Selected}
+	if cursor := g.Query("cursor"); cursor != "" {
+		opts.After, err = slip.ParseCursor(cursor)
+		if err != nil {
+			h.fail(g, err)
+			return
+		}
+	}
+	slips, err := h.service.GetAllSlips(ctx, opts)
+	if err != nil {
+		h.fail(g, err)
+		return
+	}
+	page.Slips = slips.Slips
+	if slips.Next != nil {
+		page.Next = listURL(page.Selected, slips.Next)
+	}
+	h.render(g, http.StatusOK, "list.html", page)
+}
+
+// facets lists every tag, each linking to the list with that tag added to
+// the selection or, if it is already selected, taken out of it.
+func facets(tags []slip.Tag, selected []string) []facet {
+	facets := make([]facet, len(tags))
+	for i, tag := range tags {
+		facets[i].Tag = tag
+		var others []string
+		for _, name := range selected {
+			if name == tag.Name {
+				facets[i].Selected = true
+			} else {
+				others = append(others, name)
+			}
+		}
+		if !facets[i].Selected {
+			others = append(others, tag.Name)
+		}
+		facets[i].URL = listURL(others, nil)
+	}
+	return facets
+}
+
+// listURL is the list filtered by tags, starting after the cursor if there
+// is one.
+func listURL(tags []string, after *slip.Cursor) string {
+	q := url.Values{}
+	for _, tag := range tags {
+		q.Add("tag", tag)
+	}
+	if after != nil {
+		q.Set("cursor", after.String())
+	}
+	if len(q) == 0 {
+		return "/ui/"
+	}
+	return "/ui/?" + q.Encode()
+}
+
+// Show shows a slip with its body rendered.
+func (h *Handler) Show(g *gin.Context) {
+	s, ok := h.slip(g)
+	if !ok {
+		return
+	}
+	h.render(g, http.StatusOK, "slip.html", slipPage{layout: layout{Title: s.Title}, Slip: s})
+}
+
+// New shows an empty form for a new slip.
+func (h *Handler) New(g *gin.Context) {
+	h.render(g, http.StatusOK, "form.html", formPage{layout: formLayout(g, "New slip"), Action: "/ui/slips"})
+}
+
+// Create adds the slip posted from the new slip form and shows it, or shows
+// the form again with a preview or with what was wrong.
+func (h *Handler) Create(g *gin.Context) {
+	page := formPage{layout: formLayout(g, "New slip"), Action: "/ui/slips"}
+	if !h.readForm(g, &page) {
+		return
+	}
+	created, err := h.service.CreateSlip(g.Request.Context(), page.Slip)
+	if err != nil {
+		h.refuse(g, page, err)
+		return
+	}
+	g.Redirect(http.StatusSeeOther, slipURL(created.ID))
+}
+
+// Edit shows the form for changing a slip.
+func (h *Handler) Edit(g *gin.Context) {
+	s, ok := h.slip(g)
+	if !ok {
+		return
+	}
+	h.render(g, http.StatusOK, "form.html", formPage{
+		layout: formLayout(g, "Edit slip"),
+		Action: slipURL(s.ID),
+		Slip:   s,
+		Tags:   strings.Join(s.Tags, ", "),
+	})
+}
+
+// Update saves the slip posted from the edit form and shows it, or shows the
+// form again with a preview or with what was wrong. The change is refused
+// if the slip was changed elsewhere after the form was opened.
+func (h *Handler) Update(g *gin.Context) {
+	id, ok := h.id(g)
+	if !ok {
+		return
+	}
+	page := formPage{layout: formLayout(g, "Edit slip"), Action: slipURL(id), Slip: slip.Slip{ID: id}}
+	if !h.readForm(g, &page) {
+		return
+	}
+	updated, err := h.service.UpdateSlip(g.Request.Context(), page.Slip)
+	if err != nil {
+		h.refuse(g, page, err)
+		return
+	}
+	g.Redirect(http.StatusSeeOther, slipURL(updated.ID))
+}
+
+// ConfirmDelete asks whether to move a slip to the trash.
+func (h *Handler) ConfirmDelete(g *gin.Context) {
+	s, ok := h.slip(g)
+	if !ok {
+		return
+	}
+	h.render(g, http.StatusOK, "delete.html", slipPage{layout: formLayout(g, "Delete slip"), Slip: s})
+}
+
+// Delete moves a slip to the trash, unless it was changed after the
+// confirmation was shown, and goes back to the list.
+func (h *Handler) Delete(g *gin.Context) {
+	id, ok := h.id(g)
+	if !ok {
+		return
+	}
+	version, err := formVersion(g)
+	if err != nil {
+		h.fail(g, err)
+		return
+	}
+	if err := h.service.DeleteSlip(g.Request.Context(), id, version); err != nil {
+		h.fail(g, err)
+		return
+	}
+	g.Redirect(http.StatusSeeOther, "/ui/")
+}
+
+// csrfCookie holds the token every form posts back, proving it came from one
+// of these pages: another site can make a browser post to them, but cannot
+// read the cookie to fill the token in.
+const csrfCookie = "meta_csrf"
+
+// csrfKey is where CheckForgery keeps the token in the gin context.
+const csrfKey = "meta.csrf"
+
+// CheckForgery refuses form posts sent from pages on other sites, which
+// could otherwise use a visitor's browser, and the credentials it sends by
+// itself, to change their slips. A post must carry the token from the
+// cookie set on every page, and must not name another site as where it came
+// from.
+func (h *Handler) CheckForgery(g *gin.Context) {
+	token, issued := csrfToken(g)
+	g.Set(csrfKey, token)
+	if g.Request.Method != http.MethodPost {
+		return
+	}
+	if from, ok := crossSite(g.Request); ok {
+		h.fail(g, fmt.Errorf("%w: form posted from %s", errForbidden, from))
+		g.Abort()
+		return
+	}
+	if issued || subtle.ConstantTimeCompare([]byte(g.PostForm("csrf")), []byte(token)) != 1 {
+		h.fail(g, fmt.Errorf("%w: the form has expired, go back and reload it", errForbidden))
+		g.Abort()
+	}
+}
+
+// csrfToken is the token in the request's cookie or, if it has none, a new
+// one set in a cookie on the response.
+func csrfToken(g *gin.Context) (token string, issued bool) {
+	if c, err := g.Request.Cookie(csrfCookie); err == nil && c.Value != "" {
+		return c.Value, false
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(g.Writer, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/ui",
+		Secure:   g.Request.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, true
+}
+
+// crossSite reports whether a request came from a page on another site, and
+// which, going by Origin, or else Sec-Fetch-Site, or else Referer. A request
+// naming none of them is not taken to be cross-site.
+func crossSite(r *http.Request) (string, bool) {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return origin, err != nil || u.Host != r.Host
+	}
+	switch site := r.Header.Get("Sec-Fetch-Site"); site {
+	case "same-origin", "none":
+		return "", false
+	case "":
+	default:
+		return "a " + site + " page", true
+	}
+	if referer := r.Referer(); referer != "" {
+		u, err := url.Parse(referer)
+		return referer, err != nil || u.Host != r.Host
+	}
+	return "", false
+}
+
+// errForbidden is a request refused whatever it asks for.
+var errForbidden = errors.New("forbidden")
+
+// readForm reads the posted slip into the page. When the form asked for a
+// preview, or cannot be read, it answers the request and returns false.
+func (h *Handler) readForm(g *gin.Context, page *formPage) bool {
+	version, err := formVersion(g)
+	if err != nil {
+		h.fail(g, err)
+		return false
+	}
+	page.Slip.Version = version
+	page.Slip.Title = g.PostForm("title")
+	// Browsers end the lines of a textarea with CRLF.
+	page.Slip.Body = strings.ReplaceAll(g.PostForm("body"), "\r\n", "\n")
+	page.Tags = g.PostForm("tags")
+	page.Slip.Tags = parseTags(page.Tags)
+	if g.PostForm("action") == "preview" {
+		page.Preview = true
+		h.render(g, http.StatusOK, "form.html", page)
+		return false
+	}
+	return true
+}
+
+// refuse shows the form again after the service refused the slip in it.
+func (h *Handler) refuse(g *gin.Context, page formPage, err error) {
+	switch {
+	case errors.Is(err, slip.ErrInvalid):
+		page.Error = strings.TrimPrefix(err.Error(), slip.ErrInvalid.Error()+": ")
+		h.render(g, http.StatusBadRequest, "form.html", page)
+	case errors.Is(err, slip.ErrVersionMismatch):
+		page.Error = "This slip was changed elsewhere after you opened it. Copy your changes, then reload the slip to see the latest."
+		h.render(g, http.StatusConflict, "form.html", page)
+	default:
+		h.fail(g, err)
+	}
+}
+
+// parseTags splits comma-separated tags, dropping blanks and repeats.
+func parseTags(s string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// formVersion is the version of the slip the form was filled in from, zero
+// for a new slip.
+func formVersion(g *gin.Context) (int64, error) {
+	field := g.PostForm("version")
+	if field == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return 0, slip.InvalidError("version %q is not a number", field)
+	}
+	return version, nil
+}
+
+// slip fetches the slip named in the URL, or answers the request and
+// returns false.
+func (h *Handler) slip(g *gin.Context) (slip.Slip, bool) {
+	id, ok := h.id(g)
+	if !ok {
+		return slip.Slip{}, false
+	}
+	s, err := h.service.GetSlip(g.Request.Context(), id)
+	if err != nil {
+		h.fail(g, err)
+		return s, false
+	}
+	return s, true
+}
+
+// id is the slip id in the URL. There is no slip to show for one that is
+// not a number.
+func (h *Handler) id(g *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(g.Param("id"), 10, 64)
+	if err != nil {
+		h.fail(g, fmt.Errorf("slip %q: %w", g.Param("id"), slip.ErrNotFound))
+		return 0, false
+	}
+	return id, true
+}
+
+func slipURL(id int64) string {
+	return fmt.Sprintf("/ui/slips/%d", id)
+}
+
+// fail shows an error page, its status following the slip error taxonomy.
+func (h *Handler) fail(g *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, slip.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, slip.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, slip.ErrConflict), errors.Is(err, slip.ErrVersionMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, errForbidden):
+		status = http.StatusForbidden
+	}
+	_ = g.Error(err)
+	h.render(g, status, "error.html", errorPage{
+		layout:  layout{Title: http.StatusText(status)},
+		Status:  status,
+		Message: err.Error(),
+	})
+}
+
+// render executes a template into a buffer first, so that a template error
+// does not leave half a page behind.
+func (h *Handler) render(g *gin.Context, status int, name string, data interface{}) {
+	var b bytes.Buffer
+	if err := templates.ExecuteTemplate(&b, name, data); err != nil {
+		_ = g.Error(err)
+		g.String(http.StatusInternalServerError, "rendering %s: %v", name, err)
+		return
+	}
+	g.Data(status, "text/html; charset=utf-8", b.Bytes())
+}
+
+// markdown renders a slip body for a page. archive.HTML leaves raw HTML
+// out, so what it returns can be trusted.
+func markdown(body string) (template.HTML, error) {
+	html, err := archive.HTML(body)
+	return template.HTML(html), err
+}
+
+// snippet marks up a search excerpt. Excerpts wrap matches in <b></b> but
+// are otherwise the body as it is, so everything else is escaped.
+func snippet(s string) template.HTML {
+	escaped := template.HTMLEscapeString(s)
+	escaped = strings.NewReplacer("&lt;b&gt;", "<b>", "&lt;/b&gt;", "</b>").Replace(escaped)
+	return template.HTML(escaped)
+}
+
+func date(t time.Time) string {
+	return t.Local().Format("2 Jan 2006 15:04")
+}
@@ -0,0 +1,275 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/slip/repository"
+	slipservice "github.com/pmaterer/meta/slip/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter() *gin.Engine {
+	h := NewHandler(slipservice.NewService(repository.NewMemoryRepository()))
+	r := gin.Default()
+	r.GET("/", h.Home)
+	ui := r.Group("/ui", h.CheckForgery)
+	ui.StaticFS("/static", Static())
+	ui.GET("/", h.List)
+	ui.GET("/slips/new", h.New)
+	ui.POST("/slips", h.Create)
+	ui.GET("/slips/:id", h.Show)
+	ui.POST("/slips/:id", h.Update)
+	ui.GET("/slips/:id/edit", h.Edit)
+	ui.GET("/slips/:id/delete", h.ConfirmDelete)
+	ui.POST("/slips/:id/delete", h.Delete)
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// post sends form as if from one of the pages, with the token they carry.
+func post(r *gin.Engine, path string, form url.Values) *httptest.ResponseRecorder {
+	form.Set("csrf", "test")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: "test"})
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHome(t *testing.T) {
+	w := get(newTestRouter(), "/")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/ui/", w.Header().Get("Location"))
+}
+
+func TestCreateAndShow(t *testing.T) {
+	r := newTestRouter()
+
+	w := get(r, "/ui/slips/new")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `<form class="slip" action="/ui/slips" method="post">`)
+
+	w = post(r, "/ui/slips", url.Values{
+		"body":   {"# Dune\r\n\r\nRead *twice*.\r\n\r\n<script>alert(1)</script>"},
+		"tags":   {"books, scifi, , books"},
+		"action": {"save"},
+	})
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/ui/slips/1", w.Header().Get("Location"))
+
+	w = get(r, "/ui/slips/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "<title>Dune · meta</title>")
+	assert.Contains(t, body, "<p>Read <em>twice</em>.</p>")
+	assert.NotContains(t, body, "<script>")
+	assert.Contains(t, body, `<a href="/ui/?tag=books">books</a>`)
+	assert.Contains(t, body, `<a href="/ui/?tag=scifi">scifi</a>`)
+}
+
+func TestCreateInvalid(t *testing.T) {
+	r := newTestRouter()
+
+	w := post(r, "/ui/slips", url.Values{"title": {"Two\nlines"}, "body": {"Dune"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `<p class="error" role="alert">`)
+	assert.Contains(t, w.Body.String(), "title must be a single line")
+	assert.Contains(t, w.Body.String(), ">Dune</textarea>")
+
+	w = post(r, "/ui/slips", url.Values{"body": {"Dune"}, "version": {"x"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPreview(t *testing.T) {
+	r := newTestRouter()
+
+	w := post(r, "/ui/slips", url.Values{"body": {"Read **this** <i>now</i>"}, "action": {"preview"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<section class="preview" aria-label="Preview">`)
+	assert.Contains(t, body, "<strong>this</strong>")
+	assert.Contains(t, body, ">Read **this** &lt;i&gt;now&lt;/i&gt;</textarea>")
+
+	// Nothing was saved.
+	w = get(r, "/ui/slips/1")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestList(t *testing.T) {
+	r := newTestRouter()
+	post(r, "/ui/slips", url.Values{"body": {"Dune"}, "tags": {"books, scifi"}})
+	post(r, "/ui/slips", url.Values{"body": {"Emma"}, "tags": {"books"}})
+	post(r, "/ui/slips", url.Values{"body": {"Alien"}, "tags": {"films, scifi"}})
+
+	w := get(r, "/ui/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "<h1>All slips</h1>")
+	for _, title := range []string{"Dune", "Emma", "Alien"} {
+		assert.Contains(t, body, ">"+title+"</a></h2>")
+	}
+	assert.Contains(t, body, `<li><a href="/ui/?tag=books">books</a> <span class="count">2</span></li>`)
+
+	w = get(r, "/ui/?tag=scifi")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body = w.Body.String()
+	assert.Contains(t, body, "<h1>Slips tagged scifi</h1>")
+	assert.Contains(t, body, ">Dune</a></h2>")
+	assert.Contains(t, body, ">Alien</a></h2>")
+	assert.NotContains(t, body, ">Emma</a></h2>")
+	assert.Contains(t, body, `<li class="selected"><a href="/ui/">scifi</a>`)
+	assert.Contains(t, body, `<li><a href="/ui/?tag=scifi&amp;tag=books">books</a>`)
+
+	w = get(r, "/ui/?tag=scifi&tag=books")
+	assert.Contains(t, w.Body.String(), ">Dune</a></h2>")
+	assert.NotContains(t, w.Body.String(), ">Alien</a></h2>")
+
+	w = get(r, "/ui/?cursor=nonsense")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSearch(t *testing.T) {
+	r := newTestRouter()
+	post(r, "/ui/slips", url.Values{"body": {"Dune <b>is</b> a novel"}})
+	post(r, "/ui/slips", url.Values{"body": {"Emma"}})
+
+	w := get(r, "/ui/?q=novel")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `value="novel"`)
+	assert.Contains(t, body, "<h1>Slips matching “novel”</h1>")
+	assert.Contains(t, body, "<b>novel</b>")
+	assert.Contains(t, body, "&lt;b&gt;is&lt;/b&gt;")
+	assert.NotContains(t, body, ">Emma</a></h2>")
+
+	w = get(r, "/ui/?q=nothing")
+	assert.Contains(t, w.Body.String(), "<p>No slips match.</p>")
+
+	w = get(r, "/ui/?q=*")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestEdit(t *testing.T) {
+	r := newTestRouter()
+	post(r, "/ui/slips", url.Values{"title": {"Dune"}, "body": {"A novel"}, "tags": {"books"}})
+
+	w := get(r, "/ui/slips/1/edit")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<form class="slip" action="/ui/slips/1" method="post">`)
+	assert.Contains(t, body, `<input type="hidden" name="version" value="1">`)
+	assert.Contains(t, body, `value="Dune"`)
+	assert.Contains(t, body, `<input id="tags" name="tags" value="books">`)
+
+	w = post(r, "/ui/slips/1", url.Values{"version": {"1"}, "title": {"Dune"}, "body": {"A novel by Herbert"}, "tags": {"books, scifi"}})
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/ui/slips/1", w.Header().Get("Location"))
+	w = get(r, "/ui/slips/1")
+	assert.Contains(t, w.Body.String(), "<p>A novel by Herbert</p>")
+	assert.Contains(t, w.Body.String(), `<a href="/ui/?tag=scifi">scifi</a>`)
+
+	// The form was opened before the change above.
+	w = post(r, "/ui/slips/1", url.Values{"version": {"1"}, "body": {"Stale"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "This slip was changed elsewhere")
+	assert.Contains(t, w.Body.String(), ">Stale</textarea>")
+}
+
+func TestDelete(t *testing.T) {
+	r := newTestRouter()
+	post(r, "/ui/slips", url.Values{"body": {"Dune"}})
+
+	w := get(r, "/ui/slips/1/delete")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<form action="/ui/slips/1/delete" method="post">`)
+	assert.Contains(t, w.Body.String(), `<input type="hidden" name="version" value="1">`)
+
+	w = post(r, "/ui/slips/1/delete", url.Values{"version": {"2"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = post(r, "/ui/slips/1/delete", url.Values{"version": {"1"}})
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/ui/", w.Header().Get("Location"))
+
+	w = get(r, "/ui/slips/1")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNotFound(t *testing.T) {
+	r := newTestRouter()
+	for _, path := range []string{"/ui/slips/9", "/ui/slips/x", "/ui/slips/9/edit", "/ui/slips/9/delete"} {
+		w := get(r, path)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"), path)
+	}
+}
+
+func TestCheckForgery(t *testing.T) {
+	r := newTestRouter()
+
+	w := get(r, "/ui/slips/new")
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, csrfCookie, cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+		assert.Contains(t, w.Body.String(), `<input type="hidden" name="csrf" value="`+cookies[0].Value+`">`)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		cookie  string
+		headers []string
+		status  int
+	}{
+		{name: "Token", token: "t", cookie: "t", status: http.StatusSeeOther},
+		{name: "No token", cookie: "t", status: http.StatusForbidden},
+		{name: "Wrong token", token: "u", cookie: "t", status: http.StatusForbidden},
+		{name: "No cookie", token: "t", status: http.StatusForbidden},
+		{name: "Same origin", token: "t", cookie: "t", headers: []string{"Origin", "http://meta.example"}, status: http.StatusSeeOther},
+		{name: "Other origin", token: "t", cookie: "t", headers: []string{"Origin", "http://evil.example"}, status: http.StatusForbidden},
+		{name: "Same site fetch", token: "t", cookie: "t", headers: []string{"Sec-Fetch-Site", "same-origin"}, status: http.StatusSeeOther},
+		{name: "Cross site fetch", token: "t", cookie: "t", headers: []string{"Sec-Fetch-Site", "cross-site"}, status: http.StatusForbidden},
+		{name: "Same referer", token: "t", cookie: "t", headers: []string{"Referer", "http://meta.example/ui/slips/new"}, status: http.StatusSeeOther},
+		{name: "Other referer", token: "t", cookie: "t", headers: []string{"Referer", "http://evil.example/"}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"body": {"Dune"}, "csrf": {tt.token}}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "http://meta.example/ui/slips", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			for i := 0; i+1 < len(tt.headers); i += 2 {
+				req.Header.Set(tt.headers[i], tt.headers[i+1])
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	w = get(r, "/ui/slips/1/delete")
+	assert.Contains(t, w.Body.String(), `<input type="hidden" name="csrf" value="`)
+}
+
+func TestStatic(t *testing.T) {
+	w := get(newTestRouter(), "/ui/static/style.css")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/css")
+}
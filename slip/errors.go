@@ -0,0 +1,52 @@
+package slip
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors describing why an operation on a slip failed. Repositories and the
+// service wrap them with detail, so callers should test with errors.Is.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid")
+	ErrConflict = errors.New("conflict")
+	// ErrVersionMismatch means a conditional change was refused because
+	// the slip has changed since the client last saw it.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// NotFoundError reports that the slip with the given id does not exist.
+func NotFoundError(id int64) error {
+	return fmt.Errorf("slip %d: %w", id, ErrNotFound)
+}
+
+// VersionMismatchError reports that the slip is at version current rather
+// than the expected one.
+func VersionMismatchError(id, expected, current int64) error {
+	return fmt.Errorf("slip %d is at version %d, not %d: %w", id, current, expected, ErrVersionMismatch)
+}
+
+// InvalidError wraps a description of bad input as ErrInvalid.
+func InvalidError(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, a...))
+}
+
+// Validate checks the fields a client is allowed to set.
+func (s Slip) Validate() error {
+	if strings.ContainsAny(s.Title, "\r\n") {
+		return InvalidError("title must be a single line")
+	}
+	seen := make(map[string]bool, len(s.Tags))
+	for _, tag := range s.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return InvalidError("tags must not be blank")
+		}
+		if seen[tag] {
+			return InvalidError("duplicate tag %q", tag)
+		}
+		seen[tag] = true
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package slip
+
+import "strings"
+
+// MaxGraphDepth is the furthest a graph may reach from its root, in links.
+const MaxGraphDepth = 10
+
+// GraphOptions selects the slips a graph of the notebook covers.
+type GraphOptions struct {
+	// Tags, AnyTags and NotTags filter slips as they do when listing.
+	Tags    []string
+	AnyTags []string
+	NotTags []string
+	// Root, when set, limits the graph to slips within Depth links of it,
+	// following links either way. The tag filters then choose among those,
+	// always keeping the root.
+	Root  int64
+	Depth int
+}
+
+// Validate checks the options.
+func (o GraphOptions) Validate() error {
+	for _, tags := range [][]string{o.Tags, o.AnyTags, o.NotTags} {
+		for _, tag := range tags {
+			if strings.TrimSpace(tag) == "" {
+				return InvalidError("tag filters must not be blank")
+			}
+		}
+	}
+	if o.Depth < 0 || o.Depth > MaxGraphDepth {
+		return InvalidError("depth must be between 0 and %d", MaxGraphDepth)
+	}
+	if o.Depth > 0 && o.Root == 0 {
+		return InvalidError("depth needs a root slip")
+	}
+	return nil
+}
+
+// GraphSlip is a slip as a graph shows it: a node with edges to its tags and
+// to the slips it links to, of those in the graph.
+type GraphSlip struct {
+	ID    int64
+	Title string
+	Tags  []string
+	Links []int64
+}
@@ -0,0 +1,39 @@
+package slip
+
+// ImportItem is one slip read from an import file, or the reason it could
+// not be read. Source says where in the file it came from, such as a file
+// name inside a zip or "row 3" of a CSV file.
+type ImportItem struct {
+	Source string
+	Slip   Slip
+	Err    error
+}
+
+// ImportReport describes what an import did, or with DryRun what it would
+// have done. An import is all or nothing: if any item failed, Imported is 0.
+type ImportReport struct {
+	DryRun   bool           `json:"dry_run"`
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// ImportResult is the outcome for one ImportItem, in the order they were
+// given: the id of the new slip, or why the item was refused.
+type ImportResult struct {
+	Source string `json:"source"`
+	ID     int64  `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ValidateImport checks a slip about to be imported. Beyond what Validate
+// checks, its timestamps must be in order.
+func (s Slip) ValidateImport() error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if !s.CreatedAt.IsZero() && !s.UpdatedAt.IsZero() && s.UpdatedAt.Before(s.CreatedAt) {
+		return InvalidError("updated_at is before created_at")
+	}
+	return nil
+}
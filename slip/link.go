@@ -0,0 +1,50 @@
+package slip
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Link is a wiki-style reference from one slip to another, written in a body
+// as [[123]] to name a slip by id or [[Some title]] to name it by title.
+type Link struct {
+	// Target is the text between the brackets.
+	Target string `json:"target"`
+	// Slip is the slip linked to, or nil while no slip outside the trash
+	// answers to Target.
+	Slip *Slip `json:"slip"`
+}
+
+var (
+	linkPattern = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+	// linkIDPattern matches the targets that name a slip by id. The
+	// migrations backfilling links use the same pattern.
+	linkIDPattern = regexp.MustCompile(`^0*[1-9][0-9]{0,17}$`)
+)
+
+// ParseLinks returns the targets of the links in body in the order they first
+// appear, without duplicates.
+func ParseLinks(body string) []string {
+	targets := []string{}
+	seen := map[string]bool{}
+	for _, match := range linkPattern.FindAllStringSubmatch(body, -1) {
+		target := strings.Trim(match[1], " \t\r")
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// LinkID returns the id of the slip a link target names, if it names one by
+// id rather than by title.
+func LinkID(target string) (int64, bool) {
+	if !linkIDPattern.MatchString(target) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(target, 10, 64)
+	return id, err == nil
+}
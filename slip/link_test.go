@@ -0,0 +1,49 @@
+package slip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		body    string
+		targets []string
+	}{
+		{body: "no links", targets: []string{}},
+		{body: "see [[12]] and [[ Reading list ]]", targets: []string{"12", "Reading list"}},
+		{body: "[[a]] [[b]] [[a]]", targets: []string{"a", "b"}},
+		{body: "[[[nested]]] [[]] [[ ]] [[split\nline]]", targets: []string{"nested"}},
+		{body: "[[half] and [[whole]]", targets: []string{"whole"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			assert.Equal(t, tt.targets, ParseLinks(tt.body))
+		})
+	}
+}
+
+func TestLinkID(t *testing.T) {
+	tests := []struct {
+		target string
+		id     int64
+		ok     bool
+	}{
+		{target: "12", id: 12, ok: true},
+		{target: "007", id: 7, ok: true},
+		{target: "0"},
+		{target: "-3"},
+		{target: "12 monkeys"},
+		{target: "1234567890123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			id, ok := LinkID(tt.target)
+			assert.Equal(t, tt.id, id)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package slip
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Page sizes for listing slips.
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 1000
+)
+
+// Cursor marks a position in the listing order (created_at, id). It is handed
+// to clients as an opaque string.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+// CursorAfter returns the cursor positioned just after s.
+func CursorAfter(s Slip) *Cursor {
+	return &Cursor{CreatedAt: s.CreatedAt, ID: s.ID}
+}
+
+func (c Cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a cursor previously produced by Cursor.String.
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, InvalidError("malformed cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 {
+		return nil, InvalidError("malformed cursor")
+	}
+	return &c, nil
+}
+
+// ListOptions selects a page of slips.
+type ListOptions struct {
+	// Limit is the maximum number of slips returned.
+	Limit int
+	// After resumes the listing after the given position; nil starts at
+	// the beginning.
+	After *Cursor
+	// Tags keeps slips carrying all of the given tags.
+	Tags []string
+	// AnyTags keeps slips carrying at least one of the given tags.
+	AnyTags []string
+	// NotTags drops slips carrying any of the given tags.
+	NotTags []string
+}
+
+// Validate checks the options and fills in the default limit.
+func (o *ListOptions) Validate() error {
+	if o.Limit == 0 {
+		o.Limit = DefaultPageLimit
+	}
+	if o.Limit < 0 || o.Limit > MaxPageLimit {
+		return InvalidError("limit must be between 1 and %d", MaxPageLimit)
+	}
+	for _, tags := range [][]string{o.Tags, o.AnyTags, o.NotTags} {
+		for _, tag := range tags {
+			if strings.TrimSpace(tag) == "" {
+				return InvalidError("tag filters must not be blank")
+			}
+		}
+	}
+	return nil
+}
+
+// Page is one page of slips ordered by creation time.
+type Page struct {
+	Slips []Slip
+	// Next is the cursor for the following page, or nil on the last one.
+	Next *Cursor
+}
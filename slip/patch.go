@@ -0,0 +1,133 @@
+package slip
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Patch is a partial update of a slip. It is read from a JSON Merge Patch
+// (RFC 7396) of the title, body and tags, optionally carrying add_tags and
+// remove_tags members that edit the existing tags instead of replacing them.
+type Patch struct {
+	// Title, Body and Tags replace the slip's values when set. A null in
+	// the merge patch clears the value; a cleared title follows the body.
+	Title *string
+	Body  *string
+	Tags  *[]string
+	// AddTags are appended unless already present; RemoveTags are dropped.
+	AddTags    []string
+	RemoveTags []string
+	// Version, when non-zero, makes the patch conditional on the slip still
+	// being at that version.
+	Version int64
+	// Links are the targets of the links in Body, filled in by the service
+	// when Body is set.
+	Links []string
+}
+
+// ParsePatch reads a merge patch document. Members other than title, body,
+// tags, add_tags and remove_tags are refused, as none of them can be changed.
+func ParsePatch(data []byte) (Patch, error) {
+	var p Patch
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return p, InvalidError("patch must be a JSON object: %v", err)
+	}
+	for name, raw := range members {
+		null := string(raw) == "null"
+		var err error
+		switch name {
+		case "title":
+			var title string
+			if !null {
+				err = json.Unmarshal(raw, &title)
+			}
+			p.Title = &title
+		case "body":
+			var body string
+			if !null {
+				err = json.Unmarshal(raw, &body)
+			}
+			p.Body = &body
+		case "tags":
+			tags := []string{}
+			if !null {
+				err = json.Unmarshal(raw, &tags)
+			}
+			p.Tags = &tags
+		case "add_tags":
+			err = json.Unmarshal(raw, &p.AddTags)
+		case "remove_tags":
+			err = json.Unmarshal(raw, &p.RemoveTags)
+		default:
+			return p, InvalidError("%q cannot be patched", name)
+		}
+		if err != nil {
+			return p, InvalidError("%s: %v", name, err)
+		}
+	}
+	return p, nil
+}
+
+// Validate checks the title a patch would set and the tags it would set, add
+// or remove.
+func (p Patch) Validate() error {
+	if p.Title != nil {
+		if err := (Slip{Title: *p.Title}).Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Tags != nil {
+		if err := (Slip{Tags: *p.Tags}).Validate(); err != nil {
+			return err
+		}
+	}
+	removing := make(map[string]bool, len(p.RemoveTags))
+	for _, tag := range p.RemoveTags {
+		if strings.TrimSpace(tag) == "" {
+			return InvalidError("tags must not be blank")
+		}
+		removing[tag] = true
+	}
+	for _, tag := range p.AddTags {
+		if strings.TrimSpace(tag) == "" {
+			return InvalidError("tags must not be blank")
+		}
+		if removing[tag] {
+			return InvalidError("tag %q both added and removed", tag)
+		}
+	}
+	return nil
+}
+
+// Apply makes the patch's changes to s.
+func (p Patch) Apply(s *Slip) {
+	if p.Title != nil {
+		s.Title = strings.TrimSpace(*p.Title)
+	}
+	if p.Body != nil {
+		s.Body = *p.Body
+	}
+	if p.Tags != nil {
+		s.Tags = append([]string(nil), *p.Tags...)
+	}
+	removing := make(map[string]bool, len(p.RemoveTags))
+	for _, tag := range p.RemoveTags {
+		removing[tag] = true
+	}
+	tags := []string{}
+	have := make(map[string]bool, len(s.Tags))
+	for _, tag := range s.Tags {
+		if !removing[tag] {
+			tags = append(tags, tag)
+			have[tag] = true
+		}
+	}
+	for _, tag := range p.AddTags {
+		if !have[tag] {
+			tags = append(tags, tag)
+			have[tag] = true
+		}
+	}
+	s.Tags = tags
+}
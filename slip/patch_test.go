@@ -0,0 +1,98 @@
+package slip
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePatch(t *testing.T) {
+	body := "new body"
+	empty := ""
+	tests := []struct {
+		name        string
+		data        string
+		errExpected bool
+		expected    Patch
+	}{
+		{name: "Empty", data: `{}`},
+		{name: "Body", data: `{"body":"new body"}`, expected: Patch{Body: &body}},
+		{name: "Null body", data: `{"body":null}`, expected: Patch{Body: &empty}},
+		{name: "Null title", data: `{"title":null}`, expected: Patch{Title: &empty}},
+		{name: "Tags", data: `{"tags":["a","b"]}`, expected: Patch{Tags: &[]string{"a", "b"}}},
+		{name: "Null tags", data: `{"tags":null}`, expected: Patch{Tags: &[]string{}}},
+		{
+			name:     "Tag deltas",
+			data:     `{"add_tags":["a"],"remove_tags":["b"]}`,
+			expected: Patch{AddTags: []string{"a"}, RemoveTags: []string{"b"}},
+		},
+		{name: "Read-only member", data: `{"id":4}`, errExpected: true},
+		{name: "Wrong type", data: `{"tags":"a"}`, errExpected: true},
+		{name: "Not an object", data: `[]`, errExpected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePatch([]byte(tt.data))
+			if tt.errExpected {
+				assert.True(t, errors.Is(err, ErrInvalid))
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expected, p)
+			}
+		})
+	}
+}
+
+func TestPatchApply(t *testing.T) {
+	body := "new body"
+	title := " New title "
+	tests := []struct {
+		name     string
+		patch    Patch
+		expected Slip
+	}{
+		{
+			name:     "Nothing",
+			expected: Slip{Body: "body", Tags: []string{"a", "b"}},
+		},
+		{
+			name:     "Body",
+			patch:    Patch{Body: &body},
+			expected: Slip{Body: "new body", Tags: []string{"a", "b"}},
+		},
+		{
+			name:     "Title",
+			patch:    Patch{Title: &title},
+			expected: Slip{Title: "New title", Body: "body", Tags: []string{"a", "b"}},
+		},
+		{
+			name:     "Add and remove tags",
+			patch:    Patch{AddTags: []string{"c", "a"}, RemoveTags: []string{"b"}},
+			expected: Slip{Body: "body", Tags: []string{"a", "c"}},
+		},
+		{
+			name:     "Replace then add tags",
+			patch:    Patch{Tags: &[]string{"x"}, AddTags: []string{"y"}},
+			expected: Slip{Body: "body", Tags: []string{"x", "y"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Slip{Body: "body", Tags: []string{"a", "b"}}
+			tt.patch.Apply(&s)
+			assert.Equal(t, tt.expected, s)
+		})
+	}
+}
+
+func TestPatchValidate(t *testing.T) {
+	assert.Nil(t, Patch{AddTags: []string{"a"}, RemoveTags: []string{"b"}}.Validate())
+	assert.Error(t, Patch{AddTags: []string{"a"}, RemoveTags: []string{"a"}}.Validate())
+	assert.Error(t, Patch{AddTags: []string{" "}}.Validate())
+	assert.Error(t, Patch{Tags: &[]string{"a", "a"}}.Validate())
+	title := "two\nlines"
+	assert.Error(t, Patch{Title: &title}.Validate())
+}
@@ -0,0 +1,753 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// MemoryRepository keeps slips in memory, for demos and tests. It behaves
+// like the database repositories: ids come from a sequence, every change
+// bumps the version and updated_at, and a revision is recorded whenever the
+// body or tags change. Search matches terms as plain substrings, as on SQLite.
+//
+// It is safe for concurrent use. Nothing is kept once the process exits.
+type MemoryRepository struct {
+	mu        sync.RWMutex
+	lastID    int64
+	slips     map[int64]*slip.Slip
+	revisions map[int64][]slip.Revision
+	// links holds the link targets of each slip that has any.
+	links map[int64][]string
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		slips:     map[int64]*slip.Slip{},
+		revisions: map[int64][]slip.Revision{},
+		links:     map[int64][]string{},
+	}
+}
+
+// memoryNow is the current time at the microsecond precision Postgres keeps.
+func memoryNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// CreateSlip stores a slip and returns it with its id and timestamps filled
+// in.
+func (r *MemoryRepository) CreateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(s), nil
+}
+
+func (r *MemoryRepository) create(s slip.Slip) slip.Slip {
+	r.lastID++
+	now := memoryNow()
+	stored := &slip.Slip{
+		ID:        r.lastID,
+		Title:     s.GivenTitle(),
+		Body:      s.Body,
+		Tags:      copyTags(s.Tags),
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.slips[stored.ID] = stored
+	r.recordRevision(stored)
+	r.link(stored.ID, s.Links)
+	return copySlip(stored)
+}
+
+// ImportSlips stores slips with the timestamps they carry and returns them
+// with their ids filled in.
+func (r *MemoryRepository) ImportSlips(ctx context.Context, slips []slip.Slip) ([]slip.Slip, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := make([]slip.Slip, len(slips))
+	for i, s := range slips {
+		r.lastID++
+		stored := &slip.Slip{
+			ID:        r.lastID,
+			Title:     s.GivenTitle(),
+			Body:      s.Body,
+			Tags:      copyTags(s.Tags),
+			Version:   1,
+			CreatedAt: s.CreatedAt.UTC().Truncate(time.Microsecond),
+			UpdatedAt: s.UpdatedAt.UTC().Truncate(time.Microsecond),
+		}
+		r.slips[stored.ID] = stored
+		r.recordRevision(stored)
+		r.link(stored.ID, s.Links)
+		created[i] = copySlip(stored)
+	}
+	return created, nil
+}
+
+func (r *MemoryRepository) GetSlip(ctx context.Context, id int64) (slip.Slip, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.slips[id]
+	if !ok || s.DeletedAt != nil {
+		return slip.Slip{}, slip.NotFoundError(id)
+	}
+	return copySlip(s), nil
+}
+
+func (r *MemoryRepository) GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	page := slip.Page{Slips: make([]slip.Slip, 0, opts.Limit)}
+	for _, s := range r.sorted() {
+		if s.DeletedAt != nil {
+			continue
+		}
+		if opts.After != nil && !after(s, opts.After) {
+			continue
+		}
+		if !matchTags(s.Tags, opts.Tags, opts.AnyTags, opts.NotTags) {
+			continue
+		}
+		if len(page.Slips) == opts.Limit {
+			page.Next = slip.CursorAfter(page.Slips[opts.Limit-1])
+			break
+		}
+		page.Slips = append(page.Slips, copySlip(s))
+	}
+	return page, nil
+}
+
+// SearchSlips finds the slips matching every term of the query, or one of
+// the terms joined by OR, and none of its -negated terms. They are ranked by
+// how often the terms occur.
+func (r *MemoryRepository) SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	results := []slip.SearchResult{}
+	groups := parseSearchTerms(opts.Query)
+	if len(groups) == 0 {
+		return results, nil
+	}
+	wanted := wantedTerms(groups)
+
+	for _, s := range r.sorted() {
+		body := strings.ToLower(s.Body)
+		if s.DeletedAt != nil || !matchesSearch(body, groups) {
+			continue
+		}
+		var rank int
+		for _, term := range wanted {
+			rank += strings.Count(body, strings.ToLower(term))
+		}
+		results = append(results, slip.SearchResult{Slip: copySlip(s), Rank: float64(rank), Snippet: highlight(s.Body, wanted)})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// UpdateSlip replaces the title, body and tags of a slip and returns it as
+// stored. A slip with no title of its own is not given the one it goes by
+// just because that is written back. A non-zero s.Version makes the update
+// conditional on the slip still being at that version.
+func (r *MemoryRepository) UpdateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(s)
+}
+
+func (r *MemoryRepository) update(s slip.Slip) (slip.Slip, error) {
+	stored, err := r.live(s.ID, s.Version)
+	if err != nil {
+		return slip.Slip{}, err
+	}
+	if title := s.GivenTitle(); stored.Title != "" || title != memoryTitle(stored) {
+		stored.Title = title
+	}
+	r.change(stored, s.Body, copyTags(s.Tags))
+	r.link(stored.ID, s.Links)
+	return copySlip(stored), nil
+}
+
+// PatchSlip applies a partial update to a slip.
+func (r *MemoryRepository) PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.live(id, p.Version)
+	if err != nil {
+		return slip.Slip{}, err
+	}
+	patched := copySlip(stored)
+	p.Apply(&patched)
+	if p.Title != nil {
+		stored.Title = patched.Title
+	}
+	r.change(stored, patched.Body, patched.Tags)
+	if p.Body != nil {
+		r.link(id, p.Links)
+	}
+	return copySlip(stored), nil
+}
+
+// DeleteSlip moves a slip to the trash. A non-zero version makes the delete
+// conditional on the slip still being at that version.
+func (r *MemoryRepository) DeleteSlip(ctx context.Context, id, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.delete(id, version)
+}
+
+func (r *MemoryRepository) delete(id, version int64) error {
+	stored, err := r.live(id, version)
+	if err != nil {
+		return err
+	}
+	r.touch(stored)
+	deletedAt := stored.UpdatedAt
+	stored.DeletedAt = &deletedAt
+	return nil
+}
+
+// ApplyBatch applies the operations of a batch while holding the lock, so
+// no one sees it half done. Unless b.ContinueOnError is set, a failure puts
+// back everything as it was before the batch.
+func (r *MemoryRepository) ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var undo func()
+	if !b.ContinueOnError {
+		undo = r.snapshot()
+	}
+	results := make([]slip.BatchResult, len(b.Operations))
+	for i, op := range b.Operations {
+		var s slip.Slip
+		var err error
+		switch op.Op {
+		case slip.OpCreate:
+			s = r.create(op.Slip())
+		case slip.OpUpdate:
+			s, err = r.update(op.Slip())
+		case slip.OpDelete:
+			err = r.delete(op.ID, op.Version)
+		default:
+			err = slip.InvalidError("unknown operation %q", op.Op)
+		}
+		switch {
+		case err != nil && undo != nil:
+			undo()
+			slip.AbandonBatch(results, i, err)
+			return results, nil
+		case err != nil:
+			results[i] = slip.BatchResult{Status: slip.StatusFailed, Err: err}
+		case op.Op == slip.OpDelete:
+			results[i] = slip.BatchResult{Status: slip.StatusApplied}
+		default:
+			results[i] = slip.BatchResult{Status: slip.StatusApplied, Slip: &s}
+		}
+	}
+	return results, nil
+}
+
+// snapshot copies the stored slips, revisions and links and returns a
+// function that puts them back.
+func (r *MemoryRepository) snapshot() func() {
+	lastID := r.lastID
+	slips := make(map[int64]*slip.Slip, len(r.slips))
+	for id, s := range r.slips {
+		c := copySlip(s)
+		c.Title = s.Title
+		slips[id] = &c
+	}
+	revisions := make(map[int64][]slip.Revision, len(r.revisions))
+	for id, revs := range r.revisions {
+		revisions[id] = append([]slip.Revision(nil), revs...)
+	}
+	links := make(map[int64][]string, len(r.links))
+	for id, targets := range r.links {
+		links[id] = targets
+	}
+	return func() {
+		r.lastID, r.slips, r.revisions, r.links = lastID, slips, revisions, links
+	}
+}
+
+// GetTrash lists the slips in the trash, most recently deleted first.
+func (r *MemoryRepository) GetTrash(ctx context.Context) ([]slip.Slip, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	slips := []slip.Slip{}
+	for _, s := range r.sorted() {
+		if s.DeletedAt != nil {
+			slips = append(slips, copySlip(s))
+		}
+	}
+	sort.SliceStable(slips, func(i, j int) bool {
+		if !slips[i].DeletedAt.Equal(*slips[j].DeletedAt) {
+			return slips[i].DeletedAt.After(*slips[j].DeletedAt)
+		}
+		return slips[i].ID < slips[j].ID
+	})
+	return slips, nil
+}
+
+// RestoreSlip takes a slip back out of the trash.
+func (r *MemoryRepository) RestoreSlip(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.slips[id]
+	if !ok || s.DeletedAt == nil {
+		return slip.NotFoundError(id)
+	}
+	r.touch(s)
+	s.DeletedAt = nil
+	return nil
+}
+
+// PurgeSlip permanently deletes a slip that is in the trash.
+func (r *MemoryRepository) PurgeSlip(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.slips[id]
+	if !ok || s.DeletedAt == nil {
+		return slip.NotFoundError(id)
+	}
+	delete(r.slips, id)
+	delete(r.revisions, id)
+	delete(r.links, id)
+	return nil
+}
+
+// PurgeTrash permanently deletes the slips trashed before the given time and
+// returns how many there were.
+func (r *MemoryRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, s := range r.slips {
+		if s.DeletedAt != nil && s.DeletedAt.Before(before) {
+			delete(r.slips, id)
+			delete(r.revisions, id)
+			delete(r.links, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryRepository) GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored := r.revisions[id]
+	if len(stored) == 0 {
+		return []slip.Revision{}, slip.NotFoundError(id)
+	}
+	revisions := make([]slip.Revision, len(stored))
+	for i, rev := range stored {
+		revisions[i] = copyRevision(rev)
+	}
+	return revisions, nil
+}
+
+func (r *MemoryRepository) GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	revisions := r.revisions[id]
+	if rev < 1 || rev > int64(len(revisions)) {
+		return slip.Revision{}, slip.RevisionNotFoundError(id, rev)
+	}
+	return copyRevision(revisions[rev-1]), nil
+}
+
+// RestoreRevision puts the body and tags of an earlier revision back on the
+// slip, which records them again as its newest revision, and the links of
+// that body, which the service found, with them.
+func (r *MemoryRepository) RestoreRevision(ctx context.Context, id, rev int64, links []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.slips[id]
+	revisions := r.revisions[id]
+	if !ok || s.DeletedAt != nil || rev < 1 || rev > int64(len(revisions)) {
+		return slip.RevisionNotFoundError(id, rev)
+	}
+	restored := revisions[rev-1]
+	r.change(s, restored.Body, copyTags(restored.Tags))
+	r.link(id, links)
+	return nil
+}
+
+// GetLinks lists the links in a slip in the order they appear, each with the
+// slip it leads to.
+func (r *MemoryRepository) GetLinks(ctx context.Context, id int64) ([]slip.Link, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, err := r.live(id, 0); err != nil {
+		return nil, err
+	}
+	titles := r.titles()
+	links := []slip.Link{}
+	for _, target := range r.links[id] {
+		link := slip.Link{Target: target}
+		if linked, ok := r.slips[r.resolve(target, titles)]; ok {
+			s := copySlip(linked)
+			link.Slip = &s
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// GetBacklinks lists the slips outside the trash that link to a slip, oldest
+// first.
+func (r *MemoryRepository) GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, err := r.live(id, 0); err != nil {
+		return nil, err
+	}
+	titles := r.titles()
+	slips := []slip.Slip{}
+	for _, s := range r.sorted() {
+		if s.DeletedAt != nil {
+			continue
+		}
+		for _, target := range r.links[s.ID] {
+			if r.resolve(target, titles) == id {
+				slips = append(slips, copySlip(s))
+				break
+			}
+		}
+	}
+	return slips, nil
+}
+
+// Graph calls fn with each slip in the graph that opts select, oldest first.
+// The graph is gathered under the lock and written out after it is released.
+func (r *MemoryRepository) Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error {
+	nodes, err := r.graph(opts)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err := fn(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) graph(opts slip.GraphOptions) ([]slip.GraphSlip, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if opts.Root != 0 {
+		if _, err := r.live(opts.Root, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	titles := r.titles()
+	links := map[int64][]int64{}
+	neighbours := map[int64][]int64{}
+	for id, s := range r.slips {
+		if s.DeletedAt != nil {
+			continue
+		}
+		for _, target := range r.links[id] {
+			if linked := r.resolve(target, titles); linked != 0 {
+				links[id] = append(links[id], linked)
+				neighbours[id] = append(neighbours[id], linked)
+				neighbours[linked] = append(neighbours[linked], id)
+			}
+		}
+	}
+	var reach map[int64]bool
+	if opts.Root != 0 {
+		reach = map[int64]bool{opts.Root: true}
+		frontier := []int64{opts.Root}
+		for depth := 0; depth < opts.Depth; depth++ {
+			var next []int64
+			for _, id := range frontier {
+				for _, n := range neighbours[id] {
+					if !reach[n] {
+						reach[n] = true
+						next = append(next, n)
+					}
+				}
+			}
+			frontier = next
+		}
+	}
+
+	in := map[int64]bool{}
+	var selected []*slip.Slip
+	for _, s := range r.sorted() {
+		if s.DeletedAt != nil || (reach != nil && !reach[s.ID]) {
+			continue
+		}
+		if s.ID != opts.Root && !matchTags(s.Tags, opts.Tags, opts.AnyTags, opts.NotTags) {
+			continue
+		}
+		in[s.ID] = true
+		selected = append(selected, s)
+	}
+	nodes := make([]slip.GraphSlip, len(selected))
+	for i, s := range selected {
+		nodes[i] = slip.GraphSlip{ID: s.ID, Title: memoryTitle(s), Tags: copyTags(s.Tags), Links: []int64{}}
+		seen := map[int64]bool{}
+		for _, linked := range links[s.ID] {
+			if in[linked] && !seen[linked] {
+				seen[linked] = true
+				nodes[i].Links = append(nodes[i].Links, linked)
+			}
+		}
+		sort.Slice(nodes[i].Links, func(a, b int) bool { return nodes[i].Links[a] < nodes[i].Links[b] })
+	}
+	return nodes, nil
+}
+
+// titles maps the lower-cased title of each slip outside the trash to the id
+// of the oldest slip with that title.
+func (r *MemoryRepository) titles() map[string]int64 {
+	titles := map[string]int64{}
+	for id, s := range r.slips {
+		if s.DeletedAt != nil {
+			continue
+		}
+		title := strings.ToLower(memoryTitle(s))
+		if first, ok := titles[title]; !ok || id < first {
+			titles[title] = id
+		}
+	}
+	return titles
+}
+
+// resolve returns the id of the slip outside the trash that a link target
+// leads to, or zero if there is none.
+func (r *MemoryRepository) resolve(target string, titles map[string]int64) int64 {
+	if id, ok := slip.LinkID(target); ok {
+		if s, ok := r.slips[id]; ok && s.DeletedAt == nil {
+			return id
+		}
+		return 0
+	}
+	return titles[strings.ToLower(target)]
+}
+
+func (r *MemoryRepository) GetTags(ctx context.Context) ([]slip.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	counts := map[string]int64{}
+	for _, s := range r.slips {
+		if s.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range s.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]slip.Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, slip.Tag{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// RenameTag renames a tag on every slip carrying it and returns how many
+// slips changed. Renaming onto a tag already in use outside the trash is a
+// conflict; that is a merge.
+func (r *MemoryRepository) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.slips {
+		if s.DeletedAt == nil && hasAnyTag(s.Tags, []string{to}) {
+			return 0, fmt.Errorf("%w: tag %q already exists, merge into it instead", slip.ErrConflict, to)
+		}
+	}
+	return r.replaceTags([]string{from}, to)
+}
+
+// MergeTags replaces every tag in m.From with m.Into and returns how many
+// slips changed.
+func (r *MemoryRepository) MergeTags(ctx context.Context, m slip.TagMerge) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.replaceTags(m.From, m.Into)
+}
+
+// replaceTags swaps each of from for to in the tags of every slip carrying
+// one of them, trashed slips included.
+func (r *MemoryRepository) replaceTags(from []string, to string) (int64, error) {
+	var n int64
+	for _, s := range r.slips {
+		if hasAnyTag(s.Tags, from) {
+			r.change(s, s.Body, replaceTag(s.Tags, from, to))
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("tags %q: %w", from, slip.ErrNotFound)
+	}
+	return n, nil
+}
+
+// live returns the stored slip with the given id unless it is missing, in the
+// trash, or not at a non-zero expected version.
+func (r *MemoryRepository) live(id, version int64) (*slip.Slip, error) {
+	s, ok := r.slips[id]
+	if !ok || s.DeletedAt != nil {
+		return nil, slip.NotFoundError(id)
+	}
+	if version != 0 && version != s.Version {
+		return nil, slip.VersionMismatchError(id, version, s.Version)
+	}
+	return s, nil
+}
+
+// change sets the body and tags of a stored slip, recording a revision if
+// either differs.
+func (r *MemoryRepository) change(s *slip.Slip, body string, tags []string) {
+	changed := body != s.Body || !sameTags(tags, s.Tags)
+	s.Body, s.Tags = body, tags
+	r.touch(s)
+	if changed {
+		r.recordRevision(s)
+	}
+}
+
+// link records targets as the links of slip id in place of those it had.
+func (r *MemoryRepository) link(id int64, targets []string) {
+	if len(targets) > 0 {
+		r.links[id] = append([]string(nil), targets...)
+	} else {
+		delete(r.links, id)
+	}
+}
+
+// touch does what the Postgres triggers do on every update.
+func (r *MemoryRepository) touch(s *slip.Slip) {
+	s.Version++
+	s.UpdatedAt = memoryNow()
+}
+
+func (r *MemoryRepository) recordRevision(s *slip.Slip) {
+	r.revisions[s.ID] = append(r.revisions[s.ID], slip.Revision{
+		SlipID:    s.ID,
+		Revision:  int64(len(r.revisions[s.ID]) + 1),
+		Body:      s.Body,
+		Tags:      copyTags(s.Tags),
+		CreatedAt: s.UpdatedAt,
+	})
+}
+
+// sorted returns the stored slips in listing order, oldest first.
+func (r *MemoryRepository) sorted() []*slip.Slip {
+	slips := make([]*slip.Slip, 0, len(r.slips))
+	for _, s := range r.slips {
+		slips = append(slips, s)
+	}
+	sort.Slice(slips, func(i, j int) bool {
+		return after(slips[j], slip.CursorAfter(*slips[i]))
+	})
+	return slips
+}
+
+// after reports whether s comes after the cursor in listing order.
+func after(s *slip.Slip, c *slip.Cursor) bool {
+	if !s.CreatedAt.Equal(c.CreatedAt) {
+		return s.CreatedAt.After(c.CreatedAt)
+	}
+	return s.ID > c.ID
+}
+
+// matchTags reports whether tags include all of wanted, at least one of
+// anyWanted and none of unwanted.
+func matchTags(tags, wanted, anyWanted, unwanted []string) bool {
+	return hasAllTags(tags, wanted) &&
+		(len(anyWanted) == 0 || hasAnyTag(tags, anyWanted)) &&
+		!hasAnyTag(tags, unwanted)
+}
+
+func hasAllTags(tags, wanted []string) bool {
+	for _, w := range wanted {
+		if !hasAnyTag(tags, []string{w}) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if tag == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameTags compares tags as Postgres compares arrays, so nil and empty tags
+// differ.
+func sameTags(a, b []string) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	return append([]string{}, tags...)
+}
+
+// copySlip copies a stored slip to hand out, with the title it goes by.
+func copySlip(s *slip.Slip) slip.Slip {
+	c := *s
+	c.Title = memoryTitle(s)
+	c.Tags = copyTags(s.Tags)
+	if s.DeletedAt != nil {
+		deletedAt := *s.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	return c
+}
+
+// memoryTitle is the title a stored slip goes by: the one it was given,
+// which is all that is kept in its Title, or else the one its body gives.
+func memoryTitle(s *slip.Slip) string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return slip.Title(s.Body)
+}
+
+func copyRevision(rev slip.Revision) slip.Revision {
+	rev.Tags = copyTags(rev.Tags)
+	return rev
+}
@@ -1,56 +1,338 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/pmaterer/meta/slip"
 )
 
-type Repository struct {
+// PostgresRepository stores slips in Postgres.
+type PostgresRepository struct {
 	db *sql.DB
 }
 
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{
 		db: db,
 	}
 }
 
-func (r *Repository) CreateSlip(slip slip.Slip) error {
-	query := `INSERT INTO slips(body, tags) VALUES($1, $2)`
-	statement, err := r.db.Prepare(query)
+// CreateSlip inserts a slip, with the links in its body, and returns it as
+// stored, with its id and timestamps filled in.
+func (r *PostgresRepository) CreateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	var created slip.Slip
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		created, err = createSlip(ctx, tx, s)
+		return err
+	})
+	return created, err
+}
+
+func createSlip(ctx context.Context, tx *sql.Tx, s slip.Slip) (slip.Slip, error) {
+	var created slip.Slip
+	query := `INSERT INTO slips(given_title, body, tags) VALUES(NULLIF($1, ''), $2, $3) RETURNING ` + slipColumns
+	err := tx.QueryRowContext(ctx, query, s.GivenTitle(), s.Body, pq.Array(s.Tags)).Scan(slipFields(&created)...)
+	if err != nil {
+		return created, mapError(err)
+	}
+	return created, mapError(insertLinks(ctx, tx, "$", created.ID, s.Links))
+}
+
+// ImportSlips inserts slips and their links in a single transaction, keeping
+// their timestamps, and returns them as stored. Either all are inserted or
+// none.
+func (r *PostgresRepository) ImportSlips(ctx context.Context, slips []slip.Slip) ([]slip.Slip, error) {
+	created := make([]slip.Slip, len(slips))
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO slips(given_title, body, tags, created_at, updated_at)
+			VALUES(NULLIF($1, ''), $2, $3, $4, $5) RETURNING `+slipColumns)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i, s := range slips {
+			err := stmt.QueryRowContext(ctx, s.GivenTitle(), s.Body, pq.Array(s.Tags), s.CreatedAt, s.UpdatedAt).
+				Scan(slipFields(&created[i])...)
+			if err != nil {
+				return err
+			}
+			if err := insertLinks(ctx, tx, "$", created[i].ID, s.Links); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return created, nil
+}
+
+func (r *PostgresRepository) GetSlip(ctx context.Context, id int64) (slip.Slip, error) {
+	var s slip.Slip
+	err := r.db.QueryRowContext(ctx, "SELECT "+slipColumns+" FROM slips WHERE id = $1 AND deleted_at IS NULL", id).Scan(slipFields(&s)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, slip.NotFoundError(id)
+	}
+	if err != nil {
+		return s, mapError(err)
+	}
+	return s, nil
+}
+
+func (r *PostgresRepository) GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error) {
+	var q queryBuilder
+	q.where("deleted_at IS NULL")
+	if opts.After != nil {
+		q.where("(created_at, id) > (%s, %s)", opts.After.CreatedAt, opts.After.ID)
+	}
+	filterTags(&q, opts.Tags, opts.AnyTags, opts.NotTags)
+	// Fetch one extra row to learn whether there is a next page.
+	query := "SELECT " + slipColumns + " FROM slips" + q.clause() +
+		" ORDER BY created_at, id LIMIT " + q.arg(opts.Limit+1)
+
+	page := slip.Page{Slips: make([]slip.Slip, 0, opts.Limit)}
+	rows, err := r.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return page, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slip slip.Slip
+		err = rows.Scan(slipFields(&slip)...)
+		if err != nil {
+			return page, err
+		}
+		page.Slips = append(page.Slips, slip)
+	}
+	err = rows.Err()
+	if err != nil {
+		return page, err
+	}
+	if len(page.Slips) > opts.Limit {
+		page.Slips = page.Slips[:opts.Limit]
+		page.Next = slip.CursorAfter(page.Slips[opts.Limit-1])
+	}
+	return page, nil
+}
+
+// filterTags keeps the slips carrying all of tags, at least one of anyTags and
+// none of notTags.
+func filterTags(q *queryBuilder, tags, anyTags, notTags []string) {
+	if len(tags) > 0 {
+		q.where("tags @> %s", pq.Array(tags))
+	}
+	if len(anyTags) > 0 {
+		q.where("tags && %s", pq.Array(anyTags))
+	}
+	if len(notTags) > 0 {
+		q.where("NOT (COALESCE(tags, '{}') && %s)", pq.Array(notTags))
+	}
+}
+
+// SearchSlips ranks slips against a web search style query. Prefix terms,
+// which websearch_to_tsquery does not understand, are combined in with
+// to_tsquery, in a subquery since FROM takes no operators.
+func (r *PostgresRepository) SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error) {
+	var q queryBuilder
+	web, prefixes := slip.SplitPrefixTerms(opts.Query)
+	var tsqueries []string
+	if web != "" {
+		tsqueries = append(tsqueries, "websearch_to_tsquery('english', "+q.arg(web)+")")
+	}
+	if len(prefixes) > 0 {
+		terms := make([]string, len(prefixes))
+		for i, p := range prefixes {
+			terms[i] = tsqueryQuote(p.Word) + ":*"
+			if p.Negated {
+				terms[i] = "!" + terms[i]
+			}
+		}
+		tsqueries = append(tsqueries, "to_tsquery('english', "+q.arg(strings.Join(terms, " & "))+")")
+	}
+	query := `SELECT ` + slipColumns + `,
+		ts_rank(search, query) AS rank,
+		ts_headline('english', COALESCE(body, ''), query) AS snippet
+		FROM slips, (SELECT ` + strings.Join(tsqueries, " && ") + ` AS query) AS terms
+		WHERE search @@ query AND deleted_at IS NULL
+		ORDER BY rank DESC, id
+		LIMIT ` + q.arg(opts.Limit)
+
+	results := []slip.SearchResult{}
+	rows, err := r.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return results, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result slip.SearchResult
+		err = rows.Scan(append(slipFields(&result.Slip), &result.Rank, &result.Snippet)...)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	err = rows.Err()
 	if err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// tsqueryQuote quotes a word as a single tsquery lexeme, so that characters
+// such as & ! : ( ) in it are not read as operators.
+func tsqueryQuote(word string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(word) + "'"
+}
+
+// UpdateSlip replaces the title, body and tags of a slip, and the links in
+// its body, and returns it as stored. A slip with no title of its own is not
+// given the one it goes by just because that is written back. A non-zero
+// s.Version makes the update conditional on the slip still being at that
+// version.
+func (r *PostgresRepository) UpdateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	var updated slip.Slip
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		updated, err = updateSlip(ctx, tx, s)
 		return err
+	})
+	return updated, err
+}
+
+func updateSlip(ctx context.Context, tx *sql.Tx, s slip.Slip) (slip.Slip, error) {
+	var updated slip.Slip
+	query := `UPDATE slips SET
+			given_title = CASE WHEN given_title IS NULL AND $1 = title THEN NULL ELSE NULLIF($1, '') END,
+			body = $2, tags = $3
+		WHERE id = $4 AND deleted_at IS NULL AND ($5::BIGINT = 0 OR version = $5)
+		RETURNING ` + slipColumns
+	err := tx.QueryRowContext(ctx, query, s.GivenTitle(), s.Body, pq.Array(s.Tags), s.ID, s.Version).Scan(slipFields(&updated)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return updated, explainMissing(ctx, tx, s.ID, s.Version)
+	}
+	if err != nil {
+		return updated, mapError(err)
+	}
+	return updated, mapError(replaceLinks(ctx, tx, "$", updated.ID, s.Links))
+}
+
+// PatchSlip applies a partial update to a slip in a single statement, so
+// concurrent tag edits do not lose each other's changes. A new body brings
+// its links with it.
+func (r *PostgresRepository) PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error) {
+	var patched slip.Slip
+	var title sql.NullString
+	if p.Title != nil {
+		title = sql.NullString{String: strings.TrimSpace(*p.Title), Valid: true}
 	}
-	_, err = statement.Exec(slip.Body, pq.Array(slip.Tags))
+	var tags interface{}
+	if p.Tags != nil {
+		tags = pq.Array(*p.Tags)
+	}
+	query := `UPDATE slips SET
+			given_title = CASE WHEN $7::TEXT IS NULL THEN given_title ELSE NULLIF($7, '') END,
+			body = COALESCE($2, body),
+			tags = slip_patch_tags(COALESCE($3, tags), $4, $5)
+		WHERE id = $1 AND deleted_at IS NULL AND ($6::BIGINT = 0 OR version = $6)
+		RETURNING ` + slipColumns
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, id, p.Body, tags, pq.Array(p.AddTags), pq.Array(p.RemoveTags), p.Version, title).
+			Scan(slipFields(&patched)...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return explainMissing(ctx, tx, id, p.Version)
+		}
+		if err != nil || p.Body == nil {
+			return err
+		}
+		return replaceLinks(ctx, tx, "$", id, p.Links)
+	})
+	return patched, mapError(err)
+}
+
+// DeleteSlip moves a slip to the trash. A non-zero version makes the delete
+// conditional on the slip still being at that version.
+func (r *PostgresRepository) DeleteSlip(ctx context.Context, id, version int64) error {
+	return deleteSlip(ctx, r.db, id, version)
+}
+
+func deleteSlip(ctx context.Context, q querier, id, version int64) error {
+	query := `UPDATE slips SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND ($2::BIGINT = 0 OR version = $2)`
+	result, err := q.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return mapError(err)
+	}
+	n, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return explainMissing(ctx, q, id, version)
+	}
 	return nil
 }
 
-func (r *Repository) GetSlip(id int64) (slip.Slip, error) {
-	var slip slip.Slip
-	err := r.db.QueryRow("SELECT id, body, tags, created_at, updated_at FROM slips WHERE id = $1", id).Scan(&slip.ID, &slip.Body, pq.Array(&slip.Tags), &slip.CreatedAt, &slip.UpdatedAt)
+// ApplyBatch applies the operations of a batch in a single transaction.
+func (r *PostgresRepository) ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error) {
+	return applyBatch(ctx, r.db, b, func(tx *sql.Tx, op slip.Operation) (*slip.Slip, error) {
+		var s slip.Slip
+		var err error
+		switch op.Op {
+		case slip.OpCreate:
+			s, err = createSlip(ctx, tx, op.Slip())
+		case slip.OpUpdate:
+			s, err = updateSlip(ctx, tx, op.Slip())
+		case slip.OpDelete:
+			return nil, deleteSlip(ctx, tx, op.ID, op.Version)
+		default:
+			return nil, slip.InvalidError("unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &s, nil
+	})
+}
+
+// explainMissing explains a conditional statement that touched no rows:
+// either the slip does not exist or it has moved past the expected version.
+func explainMissing(ctx context.Context, q querier, id, version int64) error {
+	if version == 0 {
+		return slip.NotFoundError(id)
+	}
+	var current int64
+	err := q.QueryRowContext(ctx, "SELECT version FROM slips WHERE id = $1 AND deleted_at IS NULL", id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return slip.NotFoundError(id)
+	}
 	if err != nil {
-		return slip, err
+		return err
 	}
-	return slip, nil
+	return slip.VersionMismatchError(id, version, current)
 }
 
-func (r *Repository) GetAllSlips() ([]slip.Slip, error) {
-	var slips []slip.Slip
-	rows, err := r.db.Query("SELECT * FROM slips")
+// GetTrash lists the slips in the trash, most recently deleted first.
+func (r *PostgresRepository) GetTrash(ctx context.Context) ([]slip.Slip, error) {
+	slips := []slip.Slip{}
+	rows, err := r.db.QueryContext(ctx, "SELECT "+slipColumns+" FROM slips WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id")
 	if err != nil {
-		return slips, nil
+		return slips, mapError(err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var slip slip.Slip
-		err = rows.Scan(&slip.ID, &slip.Body, pq.Array(&slip.Tags), &slip.CreatedAt, &slip.UpdatedAt)
+		err = rows.Scan(slipFields(&slip)...)
 		if err != nil {
 			return slips, err
 		}
@@ -63,31 +345,323 @@ func (r *Repository) GetAllSlips() ([]slip.Slip, error) {
 	return slips, nil
 }
 
-func (r *Repository) UpdateSlip(slip slip.Slip) error {
-	query := `UPDATE slips SET body = $1, tags = $2 WHERE id=$3`
-	statement, err := r.db.Prepare(query)
+// RestoreSlip takes a slip back out of the trash.
+func (r *PostgresRepository) RestoreSlip(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE slips SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
 	if err != nil {
-		return err
+		return mapError(err)
 	}
-	log.Println(slip)
-	rowID, err := statement.Exec(slip.Body, pq.Array(slip.Tags), slip.ID)
+	return expectRow(result, id)
+}
+
+// PurgeSlip permanently deletes a slip that is in the trash.
+func (r *PostgresRepository) PurgeSlip(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM slips WHERE id = $1 AND deleted_at IS NOT NULL", id)
 	if err != nil {
-		return err
+		return mapError(err)
+	}
+	return expectRow(result, id)
+}
+
+// PurgeTrash permanently deletes the slips trashed before the given time and
+// returns how many there were.
+func (r *PostgresRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM slips WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *PostgresRepository) GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error) {
+	revisions := []slip.Revision{}
+	rows, err := r.db.QueryContext(ctx, `SELECT slip_id, revision, body, tags, created_at FROM slip_revisions
+		WHERE slip_id = $1 ORDER BY revision`, id)
+	if err != nil {
+		return revisions, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rev slip.Revision
+		err = rows.Scan(&rev.SlipID, &rev.Revision, &rev.Body, pq.Array(&rev.Tags), &rev.CreatedAt)
+		if err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, rev)
+	}
+	err = rows.Err()
+	if err != nil {
+		return revisions, err
+	}
+	// Every slip has at least the revision recorded when it was created.
+	if len(revisions) == 0 {
+		return revisions, slip.NotFoundError(id)
+	}
+	return revisions, nil
+}
+
+func (r *PostgresRepository) GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error) {
+	var revision slip.Revision
+	err := r.db.QueryRowContext(ctx, `SELECT slip_id, revision, body, tags, created_at FROM slip_revisions
+		WHERE slip_id = $1 AND revision = $2`, id, rev).
+		Scan(&revision.SlipID, &revision.Revision, &revision.Body, pq.Array(&revision.Tags), &revision.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return revision, slip.RevisionNotFoundError(id, rev)
+	}
+	if err != nil {
+		return revision, mapError(err)
+	}
+	return revision, nil
+}
+
+// RestoreRevision puts the body and tags of an earlier revision back on the
+// slip, which records them again as its newest revision, and the links of
+// that body, which the service found, with them.
+func (r *PostgresRepository) RestoreRevision(ctx context.Context, id, rev int64, links []string) error {
+	query := `UPDATE slips SET body = r.body, tags = r.tags
+		FROM slip_revisions r
+		WHERE slips.id = $1 AND slips.deleted_at IS NULL AND r.slip_id = slips.id AND r.revision = $2`
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, rev)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return slip.RevisionNotFoundError(id, rev)
+		}
+		return replaceLinks(ctx, tx, "$", id, links)
+	})
+	return mapError(err)
+}
+
+// GetLinks lists the links in a slip in the order they appear, each with the
+// slip it leads to.
+func (r *PostgresRepository) GetLinks(ctx context.Context, id int64) ([]slip.Link, error) {
+	if err := r.expectLive(ctx, id); err != nil {
+		return nil, err
+	}
+	links := []slip.Link{}
+	ids := []int64{}
+	rows, err := r.db.QueryContext(ctx, "SELECT l.target, COALESCE("+linkedSlipID+`, 0)
+		FROM slip_links l WHERE l.slip_id = $1 ORDER BY l.position`, id)
+	if err != nil {
+		return links, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link slip.Link
+		var linkedID int64
+		err = rows.Scan(&link.Target, &linkedID)
+		if err != nil {
+			return links, err
+		}
+		links = append(links, link)
+		ids = append(ids, linkedID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return links, err
+	}
+
+	linked, err := r.querySlips(ctx, "SELECT "+slipColumns+" FROM slips WHERE id IN (SELECT "+linkedSlipID+`
+		FROM slip_links l WHERE l.slip_id = $1)`, id)
+	if err != nil {
+		return links, err
+	}
+	fillLinks(links, ids, linked)
+	return links, nil
+}
+
+// GetBacklinks lists the slips outside the trash that link to a slip, oldest
+// first.
+func (r *PostgresRepository) GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error) {
+	if err := r.expectLive(ctx, id); err != nil {
+		return nil, err
+	}
+	// The first two conditions narrow the links down with their indexes;
+	// the last makes sure each really leads here.
+	return r.querySlips(ctx, "SELECT "+slipColumns+` FROM slips
+		WHERE deleted_at IS NULL AND id IN (
+			SELECT l.slip_id FROM slip_links l
+			WHERE (l.target_id = $1
+				OR (l.target_id IS NULL AND lower(l.target) = (SELECT lower(title) FROM slips WHERE id = $1)))
+				AND `+linkedSlipID+` = $1
+		)
+		ORDER BY created_at, id`, id)
+}
+
+// Graph calls fn with each slip in the graph that opts select, oldest first,
+// as rows arrive from a single query.
+func (r *PostgresRepository) Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error {
+	if opts.Root != 0 {
+		if err := r.expectLive(ctx, opts.Root); err != nil {
+			return err
+		}
+	}
+	var q queryBuilder
+	filterTags(&q, opts.Tags, opts.AnyTags, opts.NotTags)
+	rows, err := r.db.QueryContext(ctx, graphQuery(&q, opts, "ARRAY(%s ORDER BY e.target)"), q.args...)
+	if err != nil {
+		return mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s slip.GraphSlip
+		err = rows.Scan(&s.ID, &s.Title, pq.Array(&s.Tags), pq.Array(&s.Links))
+		if err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// expectLive returns slip.ErrNotFound unless the slip exists outside the
+// trash.
+func (r *PostgresRepository) expectLive(ctx context.Context, id int64) error {
+	var live bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM slips WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&live)
+	if err != nil {
+		return mapError(err)
+	}
+	if !live {
+		return slip.NotFoundError(id)
 	}
-	id, _ := rowID.RowsAffected()
-	log.Printf("Row updated: %d", id)
 	return nil
 }
 
-func (r *Repository) DeleteSlip(id int64) error {
-	query := `DELETE FROM slips WHERE id=$1`
-	statement, err := r.db.Prepare(query)
+func (r *PostgresRepository) GetTags(ctx context.Context) ([]slip.Tag, error) {
+	tags := []slip.Tag{}
+	rows, err := r.db.QueryContext(ctx, `SELECT tag, count(*) FROM slips, unnest(tags) AS tag
+		WHERE deleted_at IS NULL
+		GROUP BY tag ORDER BY count(*) DESC, tag`)
 	if err != nil {
+		return tags, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag slip.Tag
+		err = rows.Scan(&tag.Name, &tag.Count)
+		if err != nil {
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+	err = rows.Err()
+	if err != nil {
+		return tags, err
+	}
+	return tags, nil
+}
+
+// RenameTag renames a tag on every slip carrying it and returns how many
+// slips changed. Renaming onto a tag already in use outside the trash is a
+// conflict; that is a merge.
+func (r *PostgresRepository) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	var n int64
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var inUse bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM slips WHERE tags @> $1 AND deleted_at IS NULL)", pq.Array([]string{to})).Scan(&inUse)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return fmt.Errorf("%w: tag %q already exists, merge into it instead", slip.ErrConflict, to)
+		}
+		n, err = replaceTags(ctx, tx, []string{from}, to)
+		return err
+	})
+	return n, err
+}
+
+// MergeTags replaces every tag in m.From with m.Into and returns how many
+// slips changed.
+func (r *PostgresRepository) MergeTags(ctx context.Context, m slip.TagMerge) (int64, error) {
+	var n int64
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		n, err = replaceTags(ctx, tx, m.From, m.Into)
 		return err
+	})
+	return n, err
+}
+
+// replaceTags swaps each of from for to in the tags of every slip carrying
+// one of them, keeping the tag order and dropping any duplicates created.
+func replaceTags(ctx context.Context, tx *sql.Tx, from []string, to string) (int64, error) {
+	query := `UPDATE slips SET tags = ARRAY(
+			SELECT tag FROM (
+				SELECT CASE WHEN t = ANY($1) THEN $2 ELSE t END AS tag, n
+				FROM unnest(tags) WITH ORDINALITY AS u(t, n)
+			) AS replaced
+			GROUP BY tag ORDER BY min(n)
+		)
+		WHERE tags && $1`
+	result, err := tx.ExecContext(ctx, query, pq.Array(from), to)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("tags %q: %w", from, slip.ErrNotFound)
 	}
-	_, err = statement.Exec(id)
+	return n, nil
+}
+
+func (r *PostgresRepository) querySlips(ctx context.Context, query string, args ...interface{}) ([]slip.Slip, error) {
+	slips := []slip.Slip{}
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
+		return slips, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slip slip.Slip
+		err = rows.Scan(slipFields(&slip)...)
+		if err != nil {
+			return slips, err
+		}
+		slips = append(slips, slip)
+	}
+	err = rows.Err()
+	if err != nil {
+		return slips, err
+	}
+	return slips, nil
+}
+
+func slipFields(s *slip.Slip) []interface{} {
+	return []interface{}{&s.ID, &s.Body, pq.Array(&s.Tags), &s.Version, &s.CreatedAt, &s.UpdatedAt, &s.DeletedAt, &s.Title}
+}
+
+// mapError translates Postgres errors into the slip error taxonomy. Errors it
+// does not recognise are returned unchanged.
+func mapError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
 		return err
 	}
-	return nil
+	switch {
+	case pqErr.Code.Name() == "unique_violation", pqErr.Code.Name() == "foreign_key_violation":
+		return fmt.Errorf("%w: %s", slip.ErrConflict, pqErr.Message)
+	case pqErr.Code.Class() == "22", pqErr.Code.Class() == "23":
+		// Class 22 is data exceptions, class 23 the remaining integrity
+		// constraints (not null, check).
+		return fmt.Errorf("%w: %s", slip.ErrInvalid, pqErr.Message)
+	}
+	return err
 }
@@ -0,0 +1,245 @@
+// Package repository stores slips in a SQL database, either Postgres or
+// SQLite.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pmaterer/meta/slip"
+)
+
+// slipColumns are the columns of a slip, in the order slipFields scans them.
+const slipColumns = "id, body, tags, version, created_at, updated_at, deleted_at, COALESCE(title, '')"
+
+// linkedSlipID is an expression for the id of the slip that the link l leads
+// to, or NULL if no slip outside the trash answers to it: the slip it names
+// by id, or else the oldest whose title matches it, ignoring case.
+const linkedSlipID = `CASE WHEN l.target_id IS NOT NULL
+		THEN (SELECT id FROM slips WHERE id = l.target_id AND deleted_at IS NULL)
+		ELSE (SELECT min(id) FROM slips WHERE lower(title) = lower(l.target) AND deleted_at IS NULL)
+	END`
+
+// withTx runs fn in a transaction, committing if it succeeds and rolling back
+// otherwise.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertLinks records targets, the links the service found in the body, as
+// those of the new slip id. Like replaceLinks it runs in the transaction that
+// wrote the body, so that the links are stored with it or not at all. marker
+// is as for queryBuilder.
+func insertLinks(ctx context.Context, tx *sql.Tx, marker string, id int64, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	q := queryBuilder{marker: marker}
+	slipID := q.arg(id)
+	rows := make([]string, len(targets))
+	for i, target := range targets {
+		var targetID sql.NullInt64
+		targetID.Int64, targetID.Valid = slip.LinkID(target)
+		rows[i] = fmt.Sprintf("(%s, %d, %s, %s)", slipID, i, q.arg(target), q.arg(targetID))
+	}
+	query := "INSERT INTO slip_links (slip_id, position, target, target_id) VALUES " + strings.Join(rows, ", ")
+	_, err := tx.ExecContext(ctx, query, q.args...)
+	return err
+}
+
+// replaceLinks records targets as the links of slip id, in place of those it
+// had.
+func replaceLinks(ctx context.Context, tx *sql.Tx, marker string, id int64, targets []string) error {
+	q := queryBuilder{marker: marker}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM slip_links WHERE slip_id = "+q.arg(id), q.args...); err != nil {
+		return err
+	}
+	return insertLinks(ctx, tx, marker, id, targets)
+}
+
+// querier runs statements, either directly on the database or inside a
+// transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// applyBatch runs the operations of b with apply, all in one transaction.
+// The first failure rolls the transaction back unless b.ContinueOnError is
+// set, in which case each operation runs under a savepoint so that one
+// failing undoes only itself. Failed operations are reported in the results;
+// the error is for a transaction that could not be begun or committed.
+func applyBatch(ctx context.Context, db *sql.DB, b slip.Batch, apply func(tx *sql.Tx, op slip.Operation) (*slip.Slip, error)) ([]slip.BatchResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]slip.BatchResult, len(b.Operations))
+	for i, op := range b.Operations {
+		if b.ContinueOnError {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_operation"); err != nil {
+				_ = tx.Rollback()
+				return nil, err
+			}
+		}
+		s, err := apply(tx, op)
+		if err != nil && !b.ContinueOnError {
+			_ = tx.Rollback()
+			slip.AbandonBatch(results, i, err)
+			return results, nil
+		}
+		if err != nil {
+			results[i] = slip.BatchResult{Status: slip.StatusFailed, Err: err}
+		} else {
+			results[i] = slip.BatchResult{Status: slip.StatusApplied, Slip: s}
+		}
+		if !b.ContinueOnError {
+			continue
+		}
+		if err != nil {
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_operation")
+		} else {
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_operation")
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// replaceTag swaps each of from in tags for to, keeping the first of any
+// duplicates this creates.
+func replaceTag(tags, from []string, to string) []string {
+	replacing := make(map[string]bool, len(from))
+	for _, tag := range from {
+		replacing[tag] = true
+	}
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if replacing[tag] {
+			tag = to
+		}
+		if !seen[tag] {
+			result = append(result, tag)
+			seen[tag] = true
+		}
+	}
+	return result
+}
+
+// queryBuilder accumulates WHERE conditions and their positional arguments.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+	// marker starts each numbered placeholder: "$" (the default) for
+	// Postgres, "?" for SQLite.
+	marker string
+}
+
+// arg adds a positional argument and returns its placeholder.
+func (q *queryBuilder) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	marker := q.marker
+	if marker == "" {
+		marker = "$"
+	}
+	return fmt.Sprintf("%s%d", marker, len(q.args))
+}
+
+// where adds a condition; each %s in format is replaced by a placeholder for
+// the corresponding value.
+func (q *queryBuilder) where(format string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, v := range values {
+		placeholders[i] = q.arg(v)
+	}
+	q.conditions = append(q.conditions, fmt.Sprintf(format, placeholders...))
+}
+
+// clause renders the accumulated conditions as a WHERE clause.
+func (q *queryBuilder) clause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// graphQuery builds the query behind Graph from the tag conditions already in
+// q. It selects a row for each slip in the graph, oldest first, with its id,
+// title, tags and the slips in the graph it links to, which aggregate
+// gathers from a subquery with a target column.
+func graphQuery(q *queryBuilder, opts slip.GraphOptions, aggregate string) string {
+	nodes := "TRUE"
+	if len(q.conditions) > 0 {
+		nodes = strings.Join(q.conditions, " AND ")
+	}
+	query := `WITH RECURSIVE edges (source, target) AS (
+			SELECT source, target FROM (
+				SELECT l.slip_id AS source, ` + linkedSlipID + ` AS target
+				FROM slip_links l JOIN slips s ON s.id = l.slip_id
+				WHERE s.deleted_at IS NULL
+			) AS resolved
+			WHERE target IS NOT NULL
+		)`
+	if opts.Root != 0 {
+		root := q.arg(opts.Root)
+		query += `, reach (id, depth) AS (
+			SELECT CAST(` + root + ` AS INTEGER), 0
+			UNION
+			SELECT CASE WHEN e.source = reach.id THEN e.target ELSE e.source END, reach.depth + 1
+			FROM reach JOIN edges e ON reach.id IN (e.source, e.target)
+			WHERE reach.depth < ` + q.arg(opts.Depth) + `
+		)`
+		nodes = "(" + nodes + " OR id = " + root + ") AND id IN (SELECT id FROM reach)"
+	}
+	query += `, nodes AS (
+			SELECT id, title, tags, created_at FROM slips WHERE deleted_at IS NULL AND ` + nodes + `
+		)
+		SELECT n.id, COALESCE(n.title, ''), n.tags, ` + fmt.Sprintf(aggregate,
+		"SELECT DISTINCT e.target FROM edges e WHERE e.source = n.id AND e.target IN (SELECT id FROM nodes)") + `
+		FROM nodes n ORDER BY n.created_at, n.id`
+	return query
+}
+
+// fillLinks points each of links at the slip among linked with the matching
+// entry of ids, leaving it nil if there is none.
+func fillLinks(links []slip.Link, ids []int64, linked []slip.Slip) {
+	byID := make(map[int64]slip.Slip, len(linked))
+	for _, s := range linked {
+		byID[s.ID] = s
+	}
+	for i := range links {
+		if s, ok := byID[ids[i]]; ok {
+			links[i].Slip = &s
+		}
+	}
+}
+
+// expectRow turns a statement that touched no rows into slip.ErrNotFound.
+func expectRow(result sql.Result, id int64) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return slip.NotFoundError(id)
+	}
+	return nil
+}
@@ -0,0 +1,772 @@
+// Package repotest is the contract every slip repository must honour, written
+// as a test suite that can be run against any implementation.
+//
+// Postgres is the reference: where the backends could differ, such as in the
+// handling of nil and empty tags, the suite expects what Postgres does.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/meta/slip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Repository is the full set of operations a slip repository provides.
+type Repository interface {
+	CreateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error)
+	ImportSlips(ctx context.Context, slips []slip.Slip) ([]slip.Slip, error)
+	GetSlip(ctx context.Context, id int64) (slip.Slip, error)
+	GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error)
+	SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error)
+	UpdateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error)
+	PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error)
+	DeleteSlip(ctx context.Context, id, version int64) error
+	ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error)
+	GetTrash(ctx context.Context) ([]slip.Slip, error)
+	RestoreSlip(ctx context.Context, id int64) error
+	PurgeSlip(ctx context.Context, id int64) error
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error)
+	GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error)
+	RestoreRevision(ctx context.Context, id, rev int64, links []string) error
+	GetTags(ctx context.Context) ([]slip.Tag, error)
+	RenameTag(ctx context.Context, from, to string) (int64, error)
+	MergeTags(ctx context.Context, m slip.TagMerge) (int64, error)
+	GetLinks(ctx context.Context, id int64) ([]slip.Link, error)
+	GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error)
+	Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error
+}
+
+// missingID is an id no test creates a slip with, small enough for a
+// Postgres SERIAL column.
+const missingID = 1 << 30
+
+// Run runs the contract. newRepository is called once per test and must
+// return a repository holding no slips.
+func Run(t *testing.T, newRepository func(t *testing.T) Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r Repository)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"TagsRoundTrip", testTagsRoundTrip},
+		{"Update", testUpdate},
+		{"Patch", testPatch},
+		{"NotFound", testNotFound},
+		{"Ordering", testOrdering},
+		{"TagFilters", testTagFilters},
+		{"Search", testSearch},
+		{"Trash", testTrash},
+		{"Revisions", testRevisions},
+		{"Tags", testTags},
+		{"Import", testImport},
+		{"Batch", testBatch},
+		{"Links", testLinks},
+		{"LinksFollowWrites", testLinksFollowWrites},
+		{"Graph", testGraph},
+		{"Titles", testTitles},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func create(t *testing.T, r Repository, body string, tags ...string) slip.Slip {
+	t.Helper()
+	if tags == nil {
+		tags = []string{}
+	}
+	created, err := r.CreateSlip(context.Background(), slip.Slip{Body: body, Tags: tags, Links: slip.ParseLinks(body)})
+	require.NoError(t, err)
+	return created
+}
+
+// assertSameSlip compares slips field by field, timestamps by the instant
+// they name rather than their location.
+func assertSameSlip(t *testing.T, expected, actual slip.Slip) {
+	t.Helper()
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.Title, actual.Title)
+	assert.Equal(t, expected.Body, actual.Body)
+	assert.Equal(t, expected.Tags, actual.Tags)
+	assert.Equal(t, expected.Version, actual.Version)
+	assert.True(t, expected.CreatedAt.Equal(actual.CreatedAt), "created_at %v, not %v", actual.CreatedAt, expected.CreatedAt)
+	assert.True(t, expected.UpdatedAt.Equal(actual.UpdatedAt), "updated_at %v, not %v", actual.UpdatedAt, expected.UpdatedAt)
+	assert.Equal(t, expected.DeletedAt == nil, actual.DeletedAt == nil)
+}
+
+func ids(slips []slip.Slip) []int64 {
+	ids := make([]int64, len(slips))
+	for i, s := range slips {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func testCreateAndGet(t *testing.T, r Repository) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Minute)
+	created := create(t, r, "Lorem ipsum", "a", "b")
+
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, "Lorem ipsum", created.Body)
+	assert.Equal(t, []string{"a", "b"}, created.Tags)
+	assert.Equal(t, int64(1), created.Version)
+	assert.True(t, created.CreatedAt.After(before), "created_at is set")
+	assert.True(t, created.UpdatedAt.Equal(created.CreatedAt), "updated_at starts at created_at")
+	assert.Nil(t, created.DeletedAt)
+
+	got, err := r.GetSlip(ctx, created.ID)
+	require.NoError(t, err)
+	assertSameSlip(t, created, got)
+
+	second := create(t, r, "dolor")
+	assert.Greater(t, second.ID, created.ID, "ids come from a sequence")
+}
+
+func testTagsRoundTrip(t *testing.T, r Repository) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name string
+		tags []string
+	}{
+		{"nil", nil},
+		{"empty", []string{}},
+		{"ordered", []string{"zebra", "apple", "mango"}},
+		{"unicode", []string{"café", "日本", "with space", `"quoted", comma`}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			created, err := r.CreateSlip(ctx, slip.Slip{Body: tt.name, Tags: tt.tags})
+			require.NoError(t, err)
+			assert.Equal(t, tt.tags, created.Tags)
+			got, err := r.GetSlip(ctx, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.tags, got.Tags)
+
+			updated, err := r.UpdateSlip(ctx, slip.Slip{ID: created.ID, Body: tt.name, Tags: tt.tags})
+			require.NoError(t, err)
+			assert.Equal(t, tt.tags, updated.Tags)
+		})
+	}
+}
+
+func testUpdate(t *testing.T, r Repository) {
+	ctx := context.Background()
+	created := create(t, r, "before", "a")
+	time.Sleep(2 * time.Millisecond)
+
+	updated, err := r.UpdateSlip(ctx, slip.Slip{ID: created.ID, Body: "after", Tags: []string{"b"}})
+	require.NoError(t, err)
+	assert.Equal(t, "after", updated.Body)
+	assert.Equal(t, []string{"b"}, updated.Tags)
+	assert.Equal(t, int64(2), updated.Version)
+	assert.True(t, updated.CreatedAt.Equal(created.CreatedAt), "created_at is kept")
+	assert.True(t, updated.UpdatedAt.After(created.UpdatedAt), "updated_at moves on")
+
+	got, err := r.GetSlip(ctx, created.ID)
+	require.NoError(t, err)
+	assertSameSlip(t, updated, got)
+
+	_, err = r.UpdateSlip(ctx, slip.Slip{ID: created.ID, Body: "stale", Version: 1})
+	assert.True(t, errors.Is(err, slip.ErrVersionMismatch), "got %v", err)
+	conditional, err := r.UpdateSlip(ctx, slip.Slip{ID: created.ID, Body: "current", Version: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), conditional.Version)
+}
+
+func testPatch(t *testing.T, r Repository) {
+	ctx := context.Background()
+	created := create(t, r, "body", "a", "b")
+
+	patched, err := r.PatchSlip(ctx, created.ID, slip.Patch{AddTags: []string{"c", "a"}, RemoveTags: []string{"b"}})
+	require.NoError(t, err)
+	assert.Equal(t, "body", patched.Body, "an absent body is kept")
+	assert.Equal(t, []string{"a", "c"}, patched.Tags)
+	assert.Equal(t, int64(2), patched.Version)
+
+	body := "new body"
+	patched, err = r.PatchSlip(ctx, created.ID, slip.Patch{Body: &body, Version: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "new body", patched.Body)
+	assert.Equal(t, []string{"a", "c"}, patched.Tags)
+
+	tags := []string{"x"}
+	patched, err = r.PatchSlip(ctx, created.ID, slip.Patch{Tags: &tags, AddTags: []string{"y"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x", "y"}, patched.Tags)
+
+	_, err = r.PatchSlip(ctx, created.ID, slip.Patch{Body: &body, Version: 1})
+	assert.True(t, errors.Is(err, slip.ErrVersionMismatch), "got %v", err)
+}
+
+func testNotFound(t *testing.T, r Repository) {
+	ctx := context.Background()
+	body := "x"
+	for name, err := range map[string]error{
+		"GetSlip":         func() error { _, err := r.GetSlip(ctx, missingID); return err }(),
+		"UpdateSlip":      func() error { _, err := r.UpdateSlip(ctx, slip.Slip{ID: missingID}); return err }(),
+		"UpdateSlipAt":    func() error { _, err := r.UpdateSlip(ctx, slip.Slip{ID: missingID, Version: 1}); return err }(),
+		"PatchSlip":       func() error { _, err := r.PatchSlip(ctx, missingID, slip.Patch{Body: &body}); return err }(),
+		"DeleteSlip":      r.DeleteSlip(ctx, missingID, 0),
+		"RestoreSlip":     r.RestoreSlip(ctx, missingID),
+		"PurgeSlip":       r.PurgeSlip(ctx, missingID),
+		"GetRevisions":    func() error { _, err := r.GetRevisions(ctx, missingID); return err }(),
+		"GetRevision":     func() error { _, err := r.GetRevision(ctx, missingID, 1); return err }(),
+		"RestoreRevision": r.RestoreRevision(ctx, missingID, 1, nil),
+		"RenameTag":       func() error { _, err := r.RenameTag(ctx, "missing", "other"); return err }(),
+		"MergeTags": func() error {
+			_, err := r.MergeTags(ctx, slip.TagMerge{From: []string{"missing"}, Into: "x"})
+			return err
+		}(),
+	} {
+		assert.True(t, errors.Is(err, slip.ErrNotFound), "%s: got %v", name, err)
+	}
+
+	created := create(t, r, "live")
+	_, err := r.GetRevision(ctx, created.ID, 2)
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "GetRevision of a later revision: got %v", err)
+	assert.True(t, errors.Is(r.RestoreSlip(ctx, created.ID), slip.ErrNotFound), "restoring a slip not in the trash")
+	assert.True(t, errors.Is(r.PurgeSlip(ctx, created.ID), slip.ErrNotFound), "purging a slip not in the trash")
+}
+
+func testOrdering(t *testing.T, r Repository) {
+	ctx := context.Background()
+	var created []int64
+	for _, body := range []string{"one", "two", "three", "four", "five"} {
+		created = append(created, create(t, r, body).ID)
+	}
+
+	var listed []int64
+	opts := slip.ListOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "pagination ends")
+		page, err := r.GetAllSlips(ctx, opts)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Slips), 2)
+		listed = append(listed, ids(page.Slips)...)
+		if page.Next == nil {
+			break
+		}
+		opts.After = page.Next
+	}
+	assert.Equal(t, created, listed, "slips are listed oldest first, each once")
+
+	page, err := r.GetAllSlips(ctx, slip.ListOptions{Limit: 5})
+	require.NoError(t, err)
+	assert.Nil(t, page.Next, "an exactly full last page has no next page")
+	assert.NotNil(t, page.Slips)
+
+	empty, err := r.GetAllSlips(ctx, slip.ListOptions{Limit: 5, After: slip.CursorAfter(page.Slips[4])})
+	require.NoError(t, err)
+	assert.NotNil(t, empty.Slips)
+	assert.Empty(t, empty.Slips)
+}
+
+func testTagFilters(t *testing.T, r Repository) {
+	ctx := context.Background()
+	ab := create(t, r, "ab", "a", "b").ID
+	a := create(t, r, "a", "a").ID
+	c := create(t, r, "c", "c").ID
+	none, err := r.CreateSlip(ctx, slip.Slip{Body: "none"})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		opts     slip.ListOptions
+		expected []int64
+	}{
+		{"all of", slip.ListOptions{Tags: []string{"a", "b"}}, []int64{ab}},
+		{"any of", slip.ListOptions{AnyTags: []string{"b", "c"}}, []int64{ab, c}},
+		{"none of", slip.ListOptions{NotTags: []string{"a"}}, []int64{c, none.ID}},
+		{"combined", slip.ListOptions{Tags: []string{"a"}, NotTags: []string{"b"}}, []int64{a}},
+		{"unknown tag", slip.ListOptions{Tags: []string{"z"}}, []int64{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Limit = 10
+			page, err := r.GetAllSlips(ctx, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ids(page.Slips))
+		})
+	}
+}
+
+func testSearch(t *testing.T, r Repository) {
+	ctx := context.Background()
+	pie := create(t, r, "Apple pie with cinnamon").ID
+	bread := create(t, r, "Banana bread").ID
+	crumble := create(t, r, "An apple crumble").ID
+	trashed := create(t, r, "Apple tart").ID
+	require.NoError(t, r.DeleteSlip(ctx, trashed, 0))
+
+	search := func(query string) []int64 {
+		results, err := r.SearchSlips(ctx, slip.SearchOptions{Query: query, Limit: 10})
+		require.NoError(t, err)
+		found := make([]int64, len(results))
+		for i, result := range results {
+			found[i] = result.ID
+			assert.NotEmpty(t, result.Snippet)
+		}
+		sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+		return found
+	}
+	assert.Equal(t, []int64{pie, crumble}, search("apple"), "matches ignore case and the trash")
+	assert.Equal(t, []int64{pie}, search("apple cinnamon"), "every term must match")
+	assert.Equal(t, []int64{crumble}, search("apple -pie"), "negated terms must not match")
+	assert.Equal(t, []int64{bread, crumble}, search("-pie"), "a negated term alone matches every slip without it")
+	assert.Equal(t, []int64{pie, crumble}, search("pie OR crumble"), "either term joined by OR may match")
+	assert.Equal(t, []int64{pie}, search("apple cinna*"), "words and prefix terms combine")
+	assert.Equal(t, []int64{}, search("durian"))
+}
+
+func testTrash(t *testing.T, r Repository) {
+	ctx := context.Background()
+	kept := create(t, r, "kept").ID
+	trashed := create(t, r, "trashed", "gone")
+
+	assert.True(t, errors.Is(r.DeleteSlip(ctx, trashed.ID, 5), slip.ErrVersionMismatch), "a stale delete is refused")
+	require.NoError(t, r.DeleteSlip(ctx, trashed.ID, trashed.Version))
+	assert.True(t, errors.Is(r.DeleteSlip(ctx, trashed.ID, 0), slip.ErrNotFound), "a slip is only deleted once")
+
+	_, err := r.GetSlip(ctx, trashed.ID)
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "trashed slips cannot be fetched")
+	page, err := r.GetAllSlips(ctx, slip.ListOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{kept}, ids(page.Slips), "trashed slips are not listed")
+	_, err = r.UpdateSlip(ctx, slip.Slip{ID: trashed.ID, Body: "x"})
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "trashed slips cannot be updated")
+	tags, err := r.GetTags(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, tags, "tags of trashed slips are not counted")
+
+	trash, err := r.GetTrash(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int64{trashed.ID}, ids(trash))
+	assert.NotNil(t, trash[0].DeletedAt)
+
+	require.NoError(t, r.RestoreSlip(ctx, trashed.ID))
+	restored, err := r.GetSlip(ctx, trashed.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, "trashed", restored.Body)
+
+	require.NoError(t, r.DeleteSlip(ctx, trashed.ID, 0))
+	require.NoError(t, r.PurgeSlip(ctx, trashed.ID))
+	assert.True(t, errors.Is(r.RestoreSlip(ctx, trashed.ID), slip.ErrNotFound), "purged slips are gone")
+	_, err = r.GetRevisions(ctx, trashed.ID)
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "purged slips lose their revisions")
+
+	require.NoError(t, r.DeleteSlip(ctx, kept, 0))
+	n, err := r.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n, "recently trashed slips are kept")
+	n, err = r.PurgeTrash(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	trash, err = r.GetTrash(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, trash)
+	assert.Empty(t, trash)
+}
+
+func testRevisions(t *testing.T, r Repository) {
+	ctx := context.Background()
+	created := create(t, r, "first", "a")
+	_, err := r.UpdateSlip(ctx, slip.Slip{ID: created.ID, Body: "second", Tags: []string{"a"}})
+	require.NoError(t, err)
+	_, err = r.UpdateSlip(ctx, slip.Slip{ID: created.ID, Body: "second", Tags: []string{"a"}})
+	require.NoError(t, err)
+
+	revisions, err := r.GetRevisions(ctx, created.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2, "an update changing nothing records no revision")
+	assert.Equal(t, int64(1), revisions[0].Revision)
+	assert.Equal(t, "first", revisions[0].Body)
+	assert.Equal(t, []string{"a"}, revisions[0].Tags)
+	assert.Equal(t, created.ID, revisions[0].SlipID)
+	assert.False(t, revisions[0].CreatedAt.IsZero())
+	assert.Equal(t, "second", revisions[1].Body)
+
+	first, err := r.GetRevision(ctx, created.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "first", first.Body)
+
+	require.NoError(t, r.RestoreRevision(ctx, created.ID, 1, nil))
+	restored, err := r.GetSlip(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "first", restored.Body)
+	assert.Equal(t, int64(4), restored.Version)
+	revisions, err = r.GetRevisions(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 3, "restoring records a new revision")
+}
+
+func testTags(t *testing.T, r Repository) {
+	ctx := context.Background()
+	first := create(t, r, "1", "go", "db")
+	create(t, r, "2", "go")
+	third := create(t, r, "3", "golang", "go", "sql")
+
+	tags, err := r.GetTags(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []slip.Tag{{Name: "go", Count: 3}, {Name: "db", Count: 1}, {Name: "golang", Count: 1}, {Name: "sql", Count: 1}}, tags,
+		"tags are ordered by use, then name")
+
+	_, err = r.RenameTag(ctx, "db", "go")
+	assert.True(t, errors.Is(err, slip.ErrConflict), "renaming onto a tag in use is a conflict: got %v", err)
+	n, err := r.RenameTag(ctx, "db", "database")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	renamed, err := r.GetSlip(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "database"}, renamed.Tags, "renaming keeps the tag's place")
+	assert.Equal(t, first.Version+1, renamed.Version)
+
+	trashed := create(t, r, "4", "archive")
+	require.NoError(t, r.DeleteSlip(ctx, trashed.ID, 0))
+	n, err = r.RenameTag(ctx, "database", "archive")
+	require.NoError(t, err, "a tag only trashed slips carry is not in use")
+	assert.Equal(t, int64(1), n)
+
+	n, err = r.MergeTags(ctx, slip.TagMerge{From: []string{"golang", "sql"}, Into: "go"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	merged, err := r.GetSlip(ctx, third.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go"}, merged.Tags, "merging drops the duplicates it makes")
+
+	tags, err = r.GetTags(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []slip.Tag{{Name: "go", Count: 3}, {Name: "archive", Count: 1}}, tags)
+}
+
+func testImport(t *testing.T, r Repository) {
+	ctx := context.Background()
+	existing := create(t, r, "existing")
+	created := time.Date(2019, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	updated := created.Add(48 * time.Hour)
+
+	imported, err := r.ImportSlips(ctx, []slip.Slip{
+		{Body: "old", Tags: []string{"a"}, CreatedAt: created, UpdatedAt: updated},
+		{Body: "older", Tags: []string{}, CreatedAt: created.Add(-time.Hour), UpdatedAt: created.Add(-time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+	assert.Greater(t, imported[0].ID, existing.ID)
+	assert.Greater(t, imported[1].ID, imported[0].ID)
+	assert.Equal(t, int64(1), imported[0].Version)
+	assert.True(t, imported[0].CreatedAt.Equal(created), "created_at %v is kept", imported[0].CreatedAt)
+	assert.True(t, imported[0].UpdatedAt.Equal(updated), "updated_at %v is kept", imported[0].UpdatedAt)
+
+	got, err := r.GetSlip(ctx, imported[0].ID)
+	require.NoError(t, err)
+	assertSameSlip(t, imported[0], got)
+
+	page, err := r.GetAllSlips(ctx, slip.ListOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{imported[1].ID, imported[0].ID, existing.ID}, ids(page.Slips), "imported slips list by their own created_at")
+
+	revisions, err := r.GetRevisions(ctx, imported[0].ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.True(t, revisions[0].CreatedAt.Equal(updated), "the first revision dates from updated_at, not %v", revisions[0].CreatedAt)
+}
+
+func statuses(results []slip.BatchResult) []string {
+	statuses := make([]string, len(results))
+	for i, r := range results {
+		statuses[i] = r.Status
+	}
+	return statuses
+}
+
+func testBatch(t *testing.T, r Repository) {
+	ctx := context.Background()
+	first := create(t, r, "first")
+	second := create(t, r, "second")
+
+	// A failure undoes the whole batch.
+	results, err := r.ApplyBatch(ctx, slip.Batch{Operations: []slip.Operation{
+		{Op: slip.OpCreate, Body: "third", Tags: []string{}},
+		{Op: slip.OpUpdate, ID: first.ID, Body: "first, edited", Tags: []string{}},
+		{Op: slip.OpDelete, ID: second.ID, Version: second.Version + 1},
+		{Op: slip.OpDelete, ID: first.ID},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{slip.StatusRolledBack, slip.StatusRolledBack, slip.StatusFailed, slip.StatusSkipped}, statuses(results))
+	assert.True(t, errors.Is(results[2].Err, slip.ErrVersionMismatch), "got %v", results[2].Err)
+	page, err := r.GetAllSlips(ctx, slip.ListOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, second.ID}, ids(page.Slips))
+	got, err := r.GetSlip(ctx, first.ID)
+	require.NoError(t, err)
+	assertSameSlip(t, first, got)
+
+	// With ContinueOnError only the failure is undone.
+	results, err = r.ApplyBatch(ctx, slip.Batch{ContinueOnError: true, Operations: []slip.Operation{
+		{Op: slip.OpCreate, Body: "third", Tags: []string{"a"}},
+		{Op: slip.OpUpdate, ID: missingID, Body: "missing", Tags: []string{}},
+		{Op: slip.OpUpdate, ID: first.ID, Version: first.Version, Body: "first, edited", Tags: []string{}},
+		{Op: slip.OpDelete, ID: second.ID},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{slip.StatusApplied, slip.StatusFailed, slip.StatusApplied, slip.StatusApplied}, statuses(results))
+	assert.True(t, errors.Is(results[1].Err, slip.ErrNotFound), "got %v", results[1].Err)
+	require.NotNil(t, results[0].Slip)
+	assert.Equal(t, "third", results[0].Slip.Body)
+	assert.Equal(t, []string{"a"}, results[0].Slip.Tags)
+	require.NotNil(t, results[2].Slip)
+	assert.Equal(t, first.Version+1, results[2].Slip.Version)
+	assert.Nil(t, results[3].Slip)
+
+	page, err = r.GetAllSlips(ctx, slip.ListOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, results[0].Slip.ID}, ids(page.Slips))
+	got, err = r.GetSlip(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "first, edited", got.Body)
+}
+
+// linked returns the id of the slip each link leads to, or zero.
+func linked(links []slip.Link) []int64 {
+	ids := make([]int64, len(links))
+	for i, link := range links {
+		if link.Slip != nil {
+			ids[i] = link.Slip.ID
+		}
+	}
+	return ids
+}
+
+func testLinks(t *testing.T, r Repository) {
+	ctx := context.Background()
+	alpha := create(t, r, "# Alpha\n\nThe first.")
+	beta := create(t, r, "Beta")
+	from := create(t, r, fmt.Sprintf("See [[%d]], [[beta]] and [[Nowhere]].", alpha.ID))
+
+	links, err := r.GetLinks(ctx, from.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{strconv.FormatInt(alpha.ID, 10), "beta", "Nowhere"}, []string{links[0].Target, links[1].Target, links[2].Target})
+	assert.Equal(t, []int64{alpha.ID, beta.ID, 0}, linked(links))
+	assertSameSlip(t, alpha, *links[0].Slip)
+	backlinks, err := r.GetBacklinks(ctx, alpha.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{from.ID}, ids(backlinks))
+	backlinks, err = r.GetBacklinks(ctx, beta.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{from.ID}, ids(backlinks))
+
+	_, err = r.UpdateSlip(ctx, slip.Slip{ID: from.ID, Body: "Only [[Beta]]", Tags: []string{}, Links: []string{"Beta"}})
+	require.NoError(t, err)
+	links, err = r.GetLinks(ctx, from.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{beta.ID}, linked(links))
+	backlinks, err = r.GetBacklinks(ctx, alpha.ID)
+	require.NoError(t, err)
+	assert.Empty(t, backlinks)
+
+	// A title leads to the oldest slip outside the trash that has it.
+	later := create(t, r, "## beta")
+	backlinks, err = r.GetBacklinks(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Empty(t, backlinks)
+	require.NoError(t, r.DeleteSlip(ctx, beta.ID, 0))
+	links, err = r.GetLinks(ctx, from.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{later.ID}, linked(links))
+	backlinks, err = r.GetBacklinks(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{from.ID}, ids(backlinks))
+
+	// Trashed slips neither have links nor count as linking.
+	require.NoError(t, r.DeleteSlip(ctx, from.ID, 0))
+	_, err = r.GetLinks(ctx, from.ID)
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "got %v", err)
+	_, err = r.GetBacklinks(ctx, beta.ID)
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "got %v", err)
+	backlinks, err = r.GetBacklinks(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Empty(t, backlinks)
+
+	require.NoError(t, r.RestoreSlip(ctx, from.ID))
+	backlinks, err = r.GetBacklinks(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{from.ID}, ids(backlinks), "restored slips keep their links")
+	_, err = r.GetLinks(ctx, missingID)
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "got %v", err)
+}
+
+// testLinksFollowWrites checks that every write of a body stores the links
+// given with it.
+func testLinksFollowWrites(t *testing.T, r Repository) {
+	ctx := context.Background()
+	target := create(t, r, "Target")
+	targets := func(id int64) []string {
+		t.Helper()
+		links, err := r.GetLinks(ctx, id)
+		require.NoError(t, err)
+		targets := make([]string, len(links))
+		for i, link := range links {
+			targets[i] = link.Target
+		}
+		return targets
+	}
+
+	s := create(t, r, "[[Target]]")
+	assert.Equal(t, []string{"Target"}, targets(s.ID))
+	s, err := r.UpdateSlip(ctx, slip.Slip{ID: s.ID, Body: "[[target]] and [[Elsewhere]]", Tags: []string{}, Links: []string{"target", "Elsewhere"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"target", "Elsewhere"}, targets(s.ID))
+	_, err = r.PatchSlip(ctx, s.ID, slip.Patch{AddTags: []string{"x"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"target", "Elsewhere"}, targets(s.ID), "a patch of the tags alone keeps the links")
+	body := "No links"
+	_, err = r.PatchSlip(ctx, s.ID, slip.Patch{Body: &body})
+	require.NoError(t, err)
+	assert.Empty(t, targets(s.ID))
+	require.NoError(t, r.RestoreRevision(ctx, s.ID, 1, []string{"Target"}))
+	assert.Equal(t, []string{"Target"}, targets(s.ID))
+
+	imported, err := r.ImportSlips(ctx, []slip.Slip{
+		{Body: fmt.Sprintf("[[%d]]", target.ID), Tags: []string{}, Links: []string{strconv.FormatInt(target.ID, 10)}, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{Body: "None", Tags: []string{}, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{strconv.FormatInt(target.ID, 10)}, targets(imported[0].ID))
+	assert.Empty(t, targets(imported[1].ID))
+
+	results, err := r.ApplyBatch(ctx, slip.Batch{Operations: []slip.Operation{
+		{Op: slip.OpCreate, Body: "[[Target]]", Tags: []string{}, Links: []string{"Target"}},
+		{Op: slip.OpUpdate, ID: imported[1].ID, Body: "[[Target]] too", Tags: []string{}, Links: []string{"Target"}},
+	}})
+	require.NoError(t, err)
+	batched := results[0].Slip.ID
+	assert.Equal(t, []string{"Target"}, targets(batched))
+	assert.Equal(t, []string{"Target"}, targets(imported[1].ID))
+	backlinks, err := r.GetBacklinks(ctx, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{s.ID, imported[0].ID, imported[1].ID, batched}, ids(backlinks))
+
+	// A batch that fails keeps none of the links it wrote.
+	results, err = r.ApplyBatch(ctx, slip.Batch{Operations: []slip.Operation{
+		{Op: slip.OpUpdate, ID: imported[1].ID, Body: "Unlinked", Tags: []string{}},
+		{Op: slip.OpCreate, Body: "[[Target]] again", Tags: []string{}, Links: []string{"Target"}},
+		{Op: slip.OpDelete, ID: missingID},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, slip.StatusFailed, results[2].Status)
+	backlinks, err = r.GetBacklinks(ctx, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{s.ID, imported[0].ID, imported[1].ID, batched}, ids(backlinks))
+}
+
+func testGraph(t *testing.T, r Repository) {
+	ctx := context.Background()
+	graph := func(opts slip.GraphOptions) []slip.GraphSlip {
+		t.Helper()
+		var nodes []slip.GraphSlip
+		require.NoError(t, r.Graph(ctx, opts, func(s slip.GraphSlip) error {
+			nodes = append(nodes, s)
+			return nil
+		}))
+		return nodes
+	}
+	alpha := create(t, r, "# Alpha", "x")
+	beta := create(t, r, "Beta, after [[alpha]]", "y")
+	gamma := create(t, r, fmt.Sprintf("Gamma, after [[%d]] and [[Alpha]] and [[Nowhere]]", beta.ID), "x")
+	delta := create(t, r, "Delta")
+	trashed := create(t, r, "Trashed, after [[Alpha]]", "x")
+	require.NoError(t, r.DeleteSlip(ctx, trashed.ID, 0))
+
+	nodes := map[int64]slip.GraphSlip{
+		alpha.ID: {ID: alpha.ID, Title: "Alpha", Tags: []string{"x"}, Links: []int64{}},
+		beta.ID:  {ID: beta.ID, Title: "Beta, after [[alpha]]", Tags: []string{"y"}, Links: []int64{alpha.ID}},
+		gamma.ID: {ID: gamma.ID, Title: gamma.Body, Tags: []string{"x"}, Links: []int64{alpha.ID, beta.ID}},
+		delta.ID: {ID: delta.ID, Title: "Delta", Tags: []string{}, Links: []int64{}},
+	}
+	assert.Equal(t, []slip.GraphSlip{nodes[alpha.ID], nodes[beta.ID], nodes[gamma.ID], nodes[delta.ID]}, graph(slip.GraphOptions{}))
+
+	// Links leading out of the graph are left out.
+	onlyGamma := nodes[gamma.ID]
+	onlyGamma.Links = []int64{alpha.ID}
+	assert.Equal(t, []slip.GraphSlip{nodes[alpha.ID], onlyGamma}, graph(slip.GraphOptions{AnyTags: []string{"x"}}))
+	assert.Empty(t, graph(slip.GraphOptions{Tags: []string{"x", "y"}}))
+
+	// Links are followed either way from the root; tag filters keep it.
+	assert.Equal(t, []slip.GraphSlip{{ID: beta.ID, Title: nodes[beta.ID].Title, Tags: []string{"y"}, Links: []int64{}}},
+		graph(slip.GraphOptions{Root: beta.ID}))
+	assert.Equal(t, []slip.GraphSlip{nodes[alpha.ID], nodes[beta.ID], nodes[gamma.ID]},
+		graph(slip.GraphOptions{Root: beta.ID, Depth: 1}))
+	assert.Equal(t, []slip.GraphSlip{nodes[alpha.ID], onlyGamma},
+		graph(slip.GraphOptions{Root: alpha.ID, Depth: 2, NotTags: []string{"y"}}))
+	assert.Equal(t, []slip.GraphSlip{nodes[delta.ID]}, graph(slip.GraphOptions{Root: delta.ID, Depth: 3, Tags: []string{"x"}}))
+
+	err := r.Graph(ctx, slip.GraphOptions{Root: trashed.ID}, func(slip.GraphSlip) error { return nil })
+	assert.True(t, errors.Is(err, slip.ErrNotFound), "got %v", err)
+	stop := errors.New("stop")
+	err = r.Graph(ctx, slip.GraphOptions{}, func(slip.GraphSlip) error { return stop })
+	assert.Equal(t, stop, err)
+}
+
+func testTitles(t *testing.T, r Repository) {
+	ctx := context.Background()
+	derived := create(t, r, "# Reading list\n\n- Dune")
+	assert.Equal(t, "Reading list", derived.Title)
+	given, err := r.CreateSlip(ctx, slip.Slip{Title: " Books ", Body: "# Reading list\n\n- Emma", Tags: []string{}})
+	require.NoError(t, err)
+	assert.Equal(t, "Books", given.Title)
+	got, err := r.GetSlip(ctx, given.ID)
+	require.NoError(t, err)
+	assertSameSlip(t, given, got)
+
+	// A derived title written back follows the body; a given one stays.
+	derived, err = r.UpdateSlip(ctx, slip.Slip{ID: derived.ID, Title: derived.Title, Body: "To read", Tags: []string{}})
+	require.NoError(t, err)
+	assert.Equal(t, "To read", derived.Title)
+	body := "Other books"
+	given, err = r.PatchSlip(ctx, given.ID, slip.Patch{Body: &body})
+	require.NoError(t, err)
+	assert.Equal(t, "Books", given.Title)
+
+	// Links find slips by the titles they go by.
+	from := create(t, r, "[[books]] [[to read]] [[Other books]]")
+	links, err := r.GetLinks(ctx, from.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{given.ID, derived.ID, 0}, linked(links))
+
+	// Clearing a given title lets the body give it again.
+	empty := ""
+	given, err = r.PatchSlip(ctx, given.ID, slip.Patch{Title: &empty})
+	require.NoError(t, err)
+	assert.Equal(t, "Other books", given.Title)
+	title := " Library "
+	given, err = r.PatchSlip(ctx, given.ID, slip.Patch{Title: &title})
+	require.NoError(t, err)
+	assert.Equal(t, "Library", given.Title)
+	given, err = r.UpdateSlip(ctx, slip.Slip{ID: given.ID, Body: "Other books", Tags: []string{}})
+	require.NoError(t, err)
+	assert.Equal(t, "Other books", given.Title)
+
+	imported, err := r.ImportSlips(ctx, []slip.Slip{{Title: "Imported", Body: "body", CreatedAt: time.Now(), UpdatedAt: time.Now()}})
+	require.NoError(t, err)
+	assert.Equal(t, "Imported", imported[0].Title)
+	results, err := r.ApplyBatch(ctx, slip.Batch{Operations: []slip.Operation{{Op: slip.OpCreate, Title: "Batched", Body: "body"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "Batched", results[0].Slip.Title)
+	page, err := r.GetAllSlips(ctx, slip.ListOptions{Limit: 10})
+	require.NoError(t, err)
+	titles := make([]string, len(page.Slips))
+	for i, s := range page.Slips {
+		titles[i] = s.Title
+	}
+	assert.Equal(t, []string{"To read", "Other books", "[[books]] [[to read]] [[Other books]]", "Imported", "Batched"}, titles)
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchTerm is a word or phrase of a search query. The SQLite and in-memory
+// repositories have no full-text search engine, so they match terms as plain
+// substrings of the body.
+type searchTerm struct {
+	text    string
+	negated bool
+}
+
+// parseSearchTerms splits a web search style query into words and quoted
+// phrases, each negated by a leading -, and groups them the way
+// websearch_to_tsquery does: a match needs every group, and the terms of a
+// group are alternatives joined by OR.
+func parseSearchTerms(query string) [][]searchTerm {
+	var (
+		groups [][]searchTerm
+		or     bool
+	)
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		var term searchTerm
+		quoted := false
+		if rest[0] == '-' {
+			term.negated = true
+			rest = rest[1:]
+		}
+		if strings.HasPrefix(rest, `"`) {
+			quoted = true
+			end := strings.Index(rest[1:], `"`) + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			term.text = rest[1:end]
+			rest = strings.TrimPrefix(rest[end:], `"`)
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			term.text = strings.TrimRight(rest[:end], "*")
+			rest = rest[end:]
+		}
+		rest = strings.TrimSpace(rest)
+		term.text = strings.TrimSpace(term.text)
+		switch {
+		case !quoted && !term.negated && strings.EqualFold(term.text, "or"):
+			// OR joins the next term to the group before it, if any.
+			or = len(groups) > 0
+		case term.text == "":
+		case or:
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+			or = false
+		default:
+			groups = append(groups, []searchTerm{term})
+		}
+	}
+	return groups
+}
+
+// matchesSearch reports whether body, in lower case, matches the groups of
+// terms from parseSearchTerms.
+func matchesSearch(body string, groups [][]searchTerm) bool {
+	for _, group := range groups {
+		matched := false
+		for _, term := range group {
+			if strings.Contains(body, strings.ToLower(term.text)) != term.negated {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// wantedTerms lists the terms that are not negated, which are the ones to
+// rank and highlight matches by.
+func wantedTerms(groups [][]searchTerm) []string {
+	var wanted []string
+	for _, group := range groups {
+		for _, term := range group {
+			if !term.negated {
+				wanted = append(wanted, term.text)
+			}
+		}
+	}
+	return wanted
+}
+
+// highlight picks the stretch of body around the first match, with the
+// matching words marked the way ts_headline marks them.
+func highlight(body string, terms []string) string {
+	const maxWords, before = 35, 10
+	words := strings.Fields(body)
+	matches := func(word string) bool {
+		for _, term := range terms {
+			for _, part := range strings.Fields(term) {
+				if strings.Contains(strings.ToLower(word), strings.ToLower(part)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	start := 0
+	for i, word := range words {
+		if matches(word) {
+			start = i - before
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + maxWords
+	if end > len(words) {
+		end = len(words)
+	}
+	snippet := make([]string, 0, end-start)
+	for _, word := range words[start:end] {
+		if matches(word) {
+			word = "<b>" + word + "</b>"
+		}
+		snippet = append(snippet, word)
+	}
+	return strings.Join(snippet, " ")
+}
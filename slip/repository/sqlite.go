@@ -0,0 +1,696 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pmaterer/meta/internal/sqlite"
+	"github.com/pmaterer/meta/slip"
+)
+
+// SQLiteRepository stores slips in a SQLite database. Tags are kept as a JSON
+// array and timestamps as fixed-width UTC text, which sorts in time order so
+// that listing pages through slips exactly as it does on Postgres.
+//
+// SQLite has no triggers that can rewrite the row being updated, so every
+// update here bumps the version and sets updated_at itself.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+// CreateSlip inserts a slip, with the links in its body, and returns it as
+// stored, with its id and timestamps filled in.
+func (r *SQLiteRepository) CreateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	var created slip.Slip
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		created, err = sqliteCreateSlip(ctx, tx, s)
+		return err
+	})
+	return created, err
+}
+
+func sqliteCreateSlip(ctx context.Context, tx *sql.Tx, s slip.Slip) (slip.Slip, error) {
+	var created slip.Slip
+	query := `INSERT INTO slips (given_title, body, tags, created_at, updated_at)
+		VALUES (NULLIF(?1, ''), ?2, ?3, ?4, ?4) RETURNING ` + slipColumns
+	err := tx.QueryRowContext(ctx, query, s.GivenTitle(), s.Body, sqliteTags(s.Tags), sqlite.Now()).Scan(sqliteSlipFields(&created)...)
+	if err != nil {
+		return created, mapSQLiteError(err)
+	}
+	return created, mapSQLiteError(insertLinks(ctx, tx, "?", created.ID, s.Links))
+}
+
+// ImportSlips inserts slips and their links in a single transaction, keeping
+// their timestamps, and returns them as stored. Either all are inserted or
+// none.
+func (r *SQLiteRepository) ImportSlips(ctx context.Context, slips []slip.Slip) ([]slip.Slip, error) {
+	created := make([]slip.Slip, len(slips))
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO slips (given_title, body, tags, created_at, updated_at)
+			VALUES (NULLIF(?1, ''), ?2, ?3, ?4, ?5) RETURNING `+slipColumns)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i, s := range slips {
+			err := stmt.QueryRowContext(ctx, s.GivenTitle(), s.Body, sqliteTags(s.Tags), sqlite.Time(s.CreatedAt), sqlite.Time(s.UpdatedAt)).
+				Scan(sqliteSlipFields(&created[i])...)
+			if err != nil {
+				return err
+			}
+			if err := insertLinks(ctx, tx, "?", created[i].ID, s.Links); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+	return created, nil
+}
+
+func (r *SQLiteRepository) GetSlip(ctx context.Context, id int64) (slip.Slip, error) {
+	var s slip.Slip
+	err := r.db.QueryRowContext(ctx, "SELECT "+slipColumns+" FROM slips WHERE id = ?1 AND deleted_at IS NULL", id).
+		Scan(sqliteSlipFields(&s)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, slip.NotFoundError(id)
+	}
+	if err != nil {
+		return s, mapSQLiteError(err)
+	}
+	return s, nil
+}
+
+func (r *SQLiteRepository) GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error) {
+	q := queryBuilder{marker: "?"}
+	q.where("deleted_at IS NULL")
+	if opts.After != nil {
+		q.where("(created_at, id) > (%s, %s)", sqlite.Time(opts.After.CreatedAt), opts.After.ID)
+	}
+	sqliteFilterTags(&q, opts.Tags, opts.AnyTags, opts.NotTags)
+	// Fetch one extra row to learn whether there is a next page.
+	query := "SELECT " + slipColumns + " FROM slips" + q.clause() +
+		" ORDER BY created_at, id LIMIT " + q.arg(opts.Limit+1)
+
+	page := slip.Page{Slips: make([]slip.Slip, 0, opts.Limit)}
+	slips, err := r.querySlips(ctx, query, q.args...)
+	if err != nil {
+		return page, err
+	}
+	page.Slips = append(page.Slips, slips...)
+	if len(page.Slips) > opts.Limit {
+		page.Slips = page.Slips[:opts.Limit]
+		page.Next = slip.CursorAfter(page.Slips[opts.Limit-1])
+	}
+	return page, nil
+}
+
+// sqliteFilterTags keeps the slips carrying all of tags, at least one of
+// anyTags and none of notTags.
+func sqliteFilterTags(q *queryBuilder, tags, anyTags, notTags []string) {
+	if len(tags) > 0 {
+		q.where(`NOT EXISTS (SELECT 1 FROM json_each(%s) AS wanted
+			WHERE wanted.value NOT IN (SELECT value FROM json_each(slips.tags)))`, sqliteTags(tags))
+	}
+	if len(anyTags) > 0 {
+		q.where(`EXISTS (SELECT 1 FROM json_each(slips.tags) AS tag
+			WHERE tag.value IN (SELECT value FROM json_each(%s)))`, sqliteTags(anyTags))
+	}
+	if len(notTags) > 0 {
+		q.where(`NOT EXISTS (SELECT 1 FROM json_each(slips.tags) AS tag
+			WHERE tag.value IN (SELECT value FROM json_each(%s)))`, sqliteTags(notTags))
+	}
+}
+
+// SearchSlips finds the slips matching every term of the query, or one of
+// the terms joined by OR, and none of its -negated terms, ignoring case.
+// Quoted phrases are matched whole and a trailing * is dropped, as terms
+// already match any word they start. Slips are ranked by how often the terms
+// occur.
+//
+// This is plain substring matching: there is no stemming, and only ASCII
+// letters are compared without regard to case.
+func (r *SQLiteRepository) SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error) {
+	results := []slip.SearchResult{}
+	groups := parseSearchTerms(opts.Query)
+	if len(groups) == 0 {
+		return results, nil
+	}
+	q := queryBuilder{marker: "?"}
+	q.where("deleted_at IS NULL")
+	occurrences := []string{"0"}
+	for _, group := range groups {
+		alternatives := make([]string, len(group))
+		for i, term := range group {
+			p := q.arg(term.text)
+			if term.negated {
+				alternatives[i] = fmt.Sprintf("instr(lower(COALESCE(body, '')), lower(%s)) = 0", p)
+				continue
+			}
+			alternatives[i] = fmt.Sprintf("instr(lower(COALESCE(body, '')), lower(%s)) > 0", p)
+			occurrences = append(occurrences, fmt.Sprintf(
+				"(length(COALESCE(body, '')) - length(replace(lower(COALESCE(body, '')), lower(%s), ''))) / length(%s)", p, p))
+		}
+		q.conditions = append(q.conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	wanted := wantedTerms(groups)
+	query := "SELECT " + slipColumns + ", CAST(" + strings.Join(occurrences, " + ") + " AS REAL) AS rank FROM slips" +
+		q.clause() + " ORDER BY rank DESC, id LIMIT " + q.arg(opts.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return results, mapSQLiteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result slip.SearchResult
+		err = rows.Scan(append(sqliteSlipFields(&result.Slip), &result.Rank)...)
+		if err != nil {
+			return results, err
+		}
+		result.Snippet = highlight(result.Body, wanted)
+		results = append(results, result)
+	}
+	err = rows.Err()
+	if err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// UpdateSlip replaces the title, body and tags of a slip, and the links in
+// its body, and returns it as stored. A slip with no title of its own is not
+// given the one it goes by just because that is written back. A non-zero
+// s.Version makes the update conditional on the slip still being at that
+// version.
+func (r *SQLiteRepository) UpdateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	var updated slip.Slip
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		updated, err = sqliteUpdateSlip(ctx, tx, s)
+		return err
+	})
+	return updated, err
+}
+
+func sqliteUpdateSlip(ctx context.Context, tx *sql.Tx, s slip.Slip) (slip.Slip, error) {
+	var updated slip.Slip
+	query := `UPDATE slips SET
+			given_title = CASE WHEN given_title IS NULL AND ?6 = title THEN NULL ELSE NULLIF(?6, '') END,
+			body = ?1, tags = ?2, version = version + 1, updated_at = ?5
+		WHERE id = ?3 AND deleted_at IS NULL AND (?4 = 0 OR version = ?4)
+		RETURNING ` + slipColumns
+	err := tx.QueryRowContext(ctx, query, s.Body, sqliteTags(s.Tags), s.ID, s.Version, sqlite.Now(), s.GivenTitle()).
+		Scan(sqliteSlipFields(&updated)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return updated, sqliteExplainMissing(ctx, tx, s.ID, s.Version)
+	}
+	if err != nil {
+		return updated, mapSQLiteError(err)
+	}
+	return updated, mapSQLiteError(replaceLinks(ctx, tx, "?", updated.ID, s.Links))
+}
+
+// PatchSlip applies a partial update to a slip. Transactions take the write
+// lock as they begin, so reading the slip and writing it back cannot lose a
+// concurrent change. A new body brings its links with it.
+func (r *SQLiteRepository) PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error) {
+	var patched slip.Slip
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT "+slipColumns+" FROM slips WHERE id = ?1 AND deleted_at IS NULL", id).
+			Scan(sqliteSlipFields(&patched)...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return slip.NotFoundError(id)
+		}
+		if err != nil {
+			return mapSQLiteError(err)
+		}
+		if p.Version != 0 && p.Version != patched.Version {
+			return slip.VersionMismatchError(id, p.Version, patched.Version)
+		}
+		// The title read back is the one in use, perhaps taken from the
+		// body, so it is only written when the patch sets it.
+		p.Apply(&patched)
+		var title sql.NullString
+		if p.Title != nil {
+			title = sql.NullString{String: patched.Title, Valid: true}
+		}
+		query := `UPDATE slips SET
+				given_title = CASE WHEN ?5 IS NULL THEN given_title ELSE NULLIF(?5, '') END,
+				body = ?2, tags = ?3, version = version + 1, updated_at = ?4
+			WHERE id = ?1
+			RETURNING ` + slipColumns
+		err = tx.QueryRowContext(ctx, query, id, patched.Body, sqliteTags(patched.Tags), sqlite.Now(), title).
+			Scan(sqliteSlipFields(&patched)...)
+		if err != nil || p.Body == nil {
+			return mapSQLiteError(err)
+		}
+		return mapSQLiteError(replaceLinks(ctx, tx, "?", id, p.Links))
+	})
+	return patched, err
+}
+
+// DeleteSlip moves a slip to the trash. A non-zero version makes the delete
+// conditional on the slip still being at that version.
+func (r *SQLiteRepository) DeleteSlip(ctx context.Context, id, version int64) error {
+	return sqliteDeleteSlip(ctx, r.db, id, version)
+}
+
+func sqliteDeleteSlip(ctx context.Context, q querier, id, version int64) error {
+	query := `UPDATE slips SET deleted_at = ?3, version = version + 1, updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL AND (?2 = 0 OR version = ?2)`
+	result, err := q.ExecContext(ctx, query, id, version, sqlite.Now())
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sqliteExplainMissing(ctx, q, id, version)
+	}
+	return nil
+}
+
+// ApplyBatch applies the operations of a batch in a single transaction.
+func (r *SQLiteRepository) ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error) {
+	return applyBatch(ctx, r.db, b, func(tx *sql.Tx, op slip.Operation) (*slip.Slip, error) {
+		var s slip.Slip
+		var err error
+		switch op.Op {
+		case slip.OpCreate:
+			s, err = sqliteCreateSlip(ctx, tx, op.Slip())
+		case slip.OpUpdate:
+			s, err = sqliteUpdateSlip(ctx, tx, op.Slip())
+		case slip.OpDelete:
+			return nil, sqliteDeleteSlip(ctx, tx, op.ID, op.Version)
+		default:
+			return nil, slip.InvalidError("unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &s, nil
+	})
+}
+
+// sqliteExplainMissing explains a conditional statement that touched no
+// rows: either the slip does not exist or it has moved past the expected
+// version.
+func sqliteExplainMissing(ctx context.Context, q querier, id, version int64) error {
+	if version == 0 {
+		return slip.NotFoundError(id)
+	}
+	var current int64
+	err := q.QueryRowContext(ctx, "SELECT version FROM slips WHERE id = ?1 AND deleted_at IS NULL", id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return slip.NotFoundError(id)
+	}
+	if err != nil {
+		return err
+	}
+	return slip.VersionMismatchError(id, version, current)
+}
+
+// GetTrash lists the slips in the trash, most recently deleted first.
+func (r *SQLiteRepository) GetTrash(ctx context.Context) ([]slip.Slip, error) {
+	return r.querySlips(ctx, "SELECT "+slipColumns+" FROM slips WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id")
+}
+
+// RestoreSlip takes a slip back out of the trash.
+func (r *SQLiteRepository) RestoreSlip(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE slips SET deleted_at = NULL, version = version + 1, updated_at = ?2
+		WHERE id = ?1 AND deleted_at IS NOT NULL`, id, sqlite.Now())
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	return expectRow(result, id)
+}
+
+// PurgeSlip permanently deletes a slip that is in the trash.
+func (r *SQLiteRepository) PurgeSlip(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM slips WHERE id = ?1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	return expectRow(result, id)
+}
+
+// PurgeTrash permanently deletes the slips trashed before the given time and
+// returns how many there were.
+func (r *SQLiteRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM slips WHERE deleted_at < ?1", sqlite.Time(before))
+	if err != nil {
+		return 0, mapSQLiteError(err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *SQLiteRepository) GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error) {
+	revisions := []slip.Revision{}
+	rows, err := r.db.QueryContext(ctx, `SELECT slip_id, revision, body, tags, created_at FROM slip_revisions
+		WHERE slip_id = ?1 ORDER BY revision`, id)
+	if err != nil {
+		return revisions, mapSQLiteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rev slip.Revision
+		err = rows.Scan(sqliteRevisionFields(&rev)...)
+		if err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, rev)
+	}
+	err = rows.Err()
+	if err != nil {
+		return revisions, err
+	}
+	// Every slip has at least the revision recorded when it was created.
+	if len(revisions) == 0 {
+		return revisions, slip.NotFoundError(id)
+	}
+	return revisions, nil
+}
+
+func (r *SQLiteRepository) GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error) {
+	var revision slip.Revision
+	err := r.db.QueryRowContext(ctx, `SELECT slip_id, revision, body, tags, created_at FROM slip_revisions
+		WHERE slip_id = ?1 AND revision = ?2`, id, rev).
+		Scan(sqliteRevisionFields(&revision)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return revision, slip.RevisionNotFoundError(id, rev)
+	}
+	if err != nil {
+		return revision, mapSQLiteError(err)
+	}
+	return revision, nil
+}
+
+// RestoreRevision puts the body and tags of an earlier revision back on the
+// slip, which records them again as its newest revision, and the links of
+// that body, which the service found, with them.
+func (r *SQLiteRepository) RestoreRevision(ctx context.Context, id, rev int64, links []string) error {
+	query := `UPDATE slips SET body = r.body, tags = r.tags, version = slips.version + 1, updated_at = ?3
+		FROM slip_revisions AS r
+		WHERE slips.id = ?1 AND slips.deleted_at IS NULL AND r.slip_id = slips.id AND r.revision = ?2`
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, rev, sqlite.Now())
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return slip.RevisionNotFoundError(id, rev)
+		}
+		return replaceLinks(ctx, tx, "?", id, links)
+	})
+	return mapSQLiteError(err)
+}
+
+// GetLinks lists the links in a slip in the order they appear, each with the
+// slip it leads to.
+func (r *SQLiteRepository) GetLinks(ctx context.Context, id int64) ([]slip.Link, error) {
+	if err := r.expectLive(ctx, id); err != nil {
+		return nil, err
+	}
+	links := []slip.Link{}
+	ids := []int64{}
+	rows, err := r.db.QueryContext(ctx, "SELECT l.target, COALESCE("+linkedSlipID+`, 0)
+		FROM slip_links l WHERE l.slip_id = ?1 ORDER BY l.position`, id)
+	if err != nil {
+		return links, mapSQLiteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link slip.Link
+		var linkedID int64
+		err = rows.Scan(&link.Target, &linkedID)
+		if err != nil {
+			return links, err
+		}
+		links = append(links, link)
+		ids = append(ids, linkedID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return links, err
+	}
+
+	linked, err := r.querySlips(ctx, "SELECT "+slipColumns+" FROM slips WHERE id IN (SELECT "+linkedSlipID+`
+		FROM slip_links l WHERE l.slip_id = ?1)`, id)
+	if err != nil {
+		return links, err
+	}
+	fillLinks(links, ids, linked)
+	return links, nil
+}
+
+// GetBacklinks lists the slips outside the trash that link to a slip, oldest
+// first.
+func (r *SQLiteRepository) GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error) {
+	if err := r.expectLive(ctx, id); err != nil {
+		return nil, err
+	}
+	// The first two conditions narrow the links down with their indexes;
+	// the last makes sure each really leads here.
+	return r.querySlips(ctx, "SELECT "+slipColumns+` FROM slips
+		WHERE deleted_at IS NULL AND id IN (
+			SELECT l.slip_id FROM slip_links l
+			WHERE (l.target_id = ?1
+				OR (l.target_id IS NULL AND lower(l.target) = (SELECT lower(title) FROM slips WHERE id = ?1)))
+				AND `+linkedSlipID+` = ?1
+		)
+		ORDER BY created_at, id`, id)
+}
+
+// Graph calls fn with each slip in the graph that opts select, oldest first,
+// as rows arrive from a single query.
+func (r *SQLiteRepository) Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error {
+	if opts.Root != 0 {
+		if err := r.expectLive(ctx, opts.Root); err != nil {
+			return err
+		}
+	}
+	q := queryBuilder{marker: "?"}
+	sqliteFilterTags(&q, opts.Tags, opts.AnyTags, opts.NotTags)
+	rows, err := r.db.QueryContext(ctx, graphQuery(&q, opts, "(SELECT json_group_array(target) FROM (%s ORDER BY e.target))"), q.args...)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s slip.GraphSlip
+		var links string
+		err = rows.Scan(&s.ID, &s.Title, sqliteTagsField{&s.Tags}, &links)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(links), &s.Links); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// expectLive returns slip.ErrNotFound unless the slip exists outside the
+// trash.
+func (r *SQLiteRepository) expectLive(ctx context.Context, id int64) error {
+	var live bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM slips WHERE id = ?1 AND deleted_at IS NULL)", id).Scan(&live)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	if !live {
+		return slip.NotFoundError(id)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetTags(ctx context.Context) ([]slip.Tag, error) {
+	tags := []slip.Tag{}
+	rows, err := r.db.QueryContext(ctx, `SELECT tag.value, count(*) FROM slips, json_each(slips.tags) AS tag
+		WHERE deleted_at IS NULL
+		GROUP BY tag.value ORDER BY count(*) DESC, tag.value`)
+	if err != nil {
+		return tags, mapSQLiteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag slip.Tag
+		err = rows.Scan(&tag.Name, &tag.Count)
+		if err != nil {
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+	err = rows.Err()
+	if err != nil {
+		return tags, err
+	}
+	return tags, nil
+}
+
+// RenameTag renames a tag on every slip carrying it and returns how many
+// slips changed. Renaming onto a tag already in use outside the trash is a
+// conflict; that is a merge.
+func (r *SQLiteRepository) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	var n int64
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var inUse bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM slips, json_each(slips.tags) AS tag
+			WHERE tag.value = ?1 AND slips.deleted_at IS NULL)`, to).Scan(&inUse)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return fmt.Errorf("%w: tag %q already exists, merge into it instead", slip.ErrConflict, to)
+		}
+		n, err = sqliteReplaceTags(ctx, tx, []string{from}, to)
+		return err
+	})
+	return n, err
+}
+
+// MergeTags replaces every tag in m.From with m.Into and returns how many
+// slips changed.
+func (r *SQLiteRepository) MergeTags(ctx context.Context, m slip.TagMerge) (int64, error) {
+	var n int64
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		n, err = sqliteReplaceTags(ctx, tx, m.From, m.Into)
+		return err
+	})
+	return n, err
+}
+
+// sqliteReplaceTags swaps each of from for to in the tags of every slip
+// carrying one of them, keeping the tag order and dropping any duplicates
+// created.
+func sqliteReplaceTags(ctx context.Context, tx *sql.Tx, from []string, to string) (int64, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, tags FROM slips
+		WHERE EXISTS (SELECT 1 FROM json_each(slips.tags) AS tag WHERE tag.value IN (SELECT value FROM json_each(?1)))`,
+		sqliteTags(from))
+	if err != nil {
+		return 0, mapSQLiteError(err)
+	}
+	replaced := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var tags []string
+		if err := rows.Scan(&id, sqliteTagsField{&tags}); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		replaced[id] = replaceTag(tags, from, to)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(replaced) == 0 {
+		return 0, fmt.Errorf("tags %q: %w", from, slip.ErrNotFound)
+	}
+
+	now := sqlite.Now()
+	for id, tags := range replaced {
+		_, err := tx.ExecContext(ctx, "UPDATE slips SET tags = ?2, version = version + 1, updated_at = ?3 WHERE id = ?1",
+			id, sqliteTags(tags), now)
+		if err != nil {
+			return 0, mapSQLiteError(err)
+		}
+	}
+	return int64(len(replaced)), nil
+}
+
+// querySlips runs a query returning slipColumns and scans every row.
+func (r *SQLiteRepository) querySlips(ctx context.Context, query string, args ...interface{}) ([]slip.Slip, error) {
+	slips := []slip.Slip{}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return slips, mapSQLiteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slip slip.Slip
+		err = rows.Scan(sqliteSlipFields(&slip)...)
+		if err != nil {
+			return slips, err
+		}
+		slips = append(slips, slip)
+	}
+	err = rows.Err()
+	if err != nil {
+		return slips, err
+	}
+	return slips, nil
+}
+
+func sqliteSlipFields(s *slip.Slip) []interface{} {
+	return []interface{}{&s.ID, &s.Body, sqliteTagsField{&s.Tags}, &s.Version,
+		sqlite.TimeField(&s.CreatedAt), sqlite.TimeField(&s.UpdatedAt), sqlite.NullTimeField(&s.DeletedAt), &s.Title}
+}
+
+func sqliteRevisionFields(rev *slip.Revision) []interface{} {
+	return []interface{}{&rev.SlipID, &rev.Revision, &rev.Body, sqliteTagsField{&rev.Tags}, sqlite.TimeField(&rev.CreatedAt)}
+}
+
+// sqliteTags encodes tags as the JSON array they are stored as; nil tags are
+// stored as NULL, as on Postgres.
+func sqliteTags(tags []string) interface{} {
+	if tags == nil {
+		return nil
+	}
+	data, _ := json.Marshal(tags)
+	return string(data)
+}
+
+// sqliteTagsField scans a JSON array of tags.
+type sqliteTagsField struct {
+	tags *[]string
+}
+
+func (f sqliteTagsField) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*f.tags = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f.tags)
+	case []byte:
+		return json.Unmarshal(v, f.tags)
+	}
+	return fmt.Errorf("cannot scan %T as tags", src)
+}
+
+// mapSQLiteError translates SQLite errors into the slip error taxonomy.
+func mapSQLiteError(err error) error {
+	return sqlite.MapError(err, slip.ErrConflict, slip.ErrInvalid)
+}
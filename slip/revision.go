@@ -0,0 +1,31 @@
+package slip
+
+import (
+	"fmt"
+	"time"
+)
+
+// Revision is the content of a slip as it stood after a change. Revisions
+// are numbered from one, in the order the changes were made.
+type Revision struct {
+	SlipID    int64     `json:"slip_id"`
+	Revision  int64     `json:"revision"`
+	Body      string    `json:"body"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevisionDiff describes the changes between two revisions of a slip.
+type RevisionDiff struct {
+	From        int64    `json:"from"`
+	To          int64    `json:"to"`
+	AddedTags   []string `json:"added_tags"`
+	RemovedTags []string `json:"removed_tags"`
+	// Body is a unified diff of the bodies, empty when they are the same.
+	Body string `json:"body"`
+}
+
+// RevisionNotFoundError reports that the slip has no such revision.
+func RevisionNotFoundError(id, rev int64) error {
+	return fmt.Errorf("slip %d revision %d: %w", id, rev, ErrNotFound)
+}
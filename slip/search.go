@@ -0,0 +1,77 @@
+package slip
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchOptions describes a full-text search over slip bodies.
+//
+// Query uses web search syntax: "quoted phrases", -negation, OR between
+// alternatives, and a trailing * for prefix matches (go* finds golang).
+type SearchOptions struct {
+	Query string
+	Limit int
+}
+
+// Validate checks the options and fills in the default limit.
+func (o *SearchOptions) Validate() error {
+	if strings.TrimSpace(o.Query) == "" {
+		return InvalidError("search query must not be empty")
+	}
+	if rest, prefixes := SplitPrefixTerms(o.Query); rest == "" && len(prefixes) == 0 {
+		return InvalidError("search query %q has no words to search for", o.Query)
+	}
+	if o.Limit == 0 {
+		o.Limit = DefaultPageLimit
+	}
+	if o.Limit < 0 || o.Limit > MaxPageLimit {
+		return InvalidError("limit must be between 1 and %d", MaxPageLimit)
+	}
+	return nil
+}
+
+// SearchResult is a slip matching a search, with its relevance and an
+// excerpt of the body where matches are wrapped in <b></b>.
+type SearchResult struct {
+	Slip
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// PrefixTerm is a word ending in * in a search query.
+type PrefixTerm struct {
+	Word    string
+	Negated bool
+}
+
+// SplitPrefixTerms separates the prefix terms (word*, -word*) from the rest of
+// a search query, which is returned unchanged otherwise. Prefix terms inside
+// quoted phrases are left alone, and those without a letter or digit, such
+// as a lone *, are dropped. The words returned are otherwise as written, so
+// they must be quoted before use in a query language.
+func SplitPrefixTerms(query string) (string, []PrefixTerm) {
+	var (
+		rest     []string
+		prefixes []PrefixTerm
+		inQuote  bool
+	)
+	for _, field := range strings.Fields(query) {
+		if strings.Count(field, `"`)%2 == 1 {
+			inQuote = !inQuote
+		}
+		if inQuote || strings.Contains(field, `"`) || !strings.HasSuffix(field, "*") {
+			rest = append(rest, field)
+			continue
+		}
+		term := PrefixTerm{Negated: strings.HasPrefix(field, "-")}
+		term.Word = strings.TrimRight(field, "*")
+		if term.Negated {
+			term.Word = term.Word[1:]
+		}
+		if strings.IndexFunc(term.Word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			prefixes = append(prefixes, term)
+		}
+	}
+	return strings.Join(rest, " "), prefixes
+}
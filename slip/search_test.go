@@ -0,0 +1,46 @@
+package slip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPrefixTerms(t *testing.T) {
+	tests := []struct {
+		query    string
+		rest     string
+		prefixes []PrefixTerm
+	}{
+		{query: "lorem ipsum", rest: "lorem ipsum"},
+		{query: "go* notes", rest: "notes", prefixes: []PrefixTerm{{Word: "go"}}},
+		{query: "-draft* notes", rest: "notes", prefixes: []PrefixTerm{{Word: "draft", Negated: true}}},
+		{query: `"star* phrase" other*`, rest: `"star* phrase"`, prefixes: []PrefixTerm{{Word: "other"}}},
+		{query: "weird:&!* ok", rest: "ok", prefixes: []PrefixTerm{{Word: "weird:&!"}}},
+		{query: "foo-bar** it's*", prefixes: []PrefixTerm{{Word: "foo-bar"}, {Word: "it's"}}},
+		{query: "* ok", rest: "ok"},
+		{query: "-* !*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rest, prefixes := SplitPrefixTerms(tt.query)
+			assert.Equal(t, tt.rest, rest)
+			assert.Equal(t, tt.prefixes, prefixes)
+		})
+	}
+}
+
+func TestSearchOptionsValidate(t *testing.T) {
+	for _, query := range []string{"", "  ", "*", "-*", "!*", "* -**"} {
+		opts := SearchOptions{Query: query}
+		assert.ErrorIs(t, opts.Validate(), ErrInvalid, query)
+	}
+	for _, query := range []string{"go*", "-draft*", "lorem", `"a phrase"`} {
+		opts := SearchOptions{Query: query}
+		assert.NoError(t, opts.Validate(), query)
+		assert.Equal(t, DefaultPageLimit, opts.Limit)
+	}
+	opts := SearchOptions{Query: "go", Limit: MaxPageLimit + 1}
+	assert.ErrorIs(t, opts.Validate(), ErrInvalid)
+}
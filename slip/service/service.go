@@ -1,13 +1,38 @@
 package service
 
-import "github.com/pmaterer/meta/slip"
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pmaterer/meta/internal/diff"
+	"github.com/pmaterer/meta/slip"
+)
 
 type repository interface {
-	CreateSlip(slip slip.Slip) error
-	GetSlip(id int64) (slip.Slip, error)
-	GetAllSlips() ([]slip.Slip, error)
-	UpdateSlip(slip slip.Slip) error
-	DeleteSlip(id int64) error
+	CreateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	ImportSlips(ctx context.Context, slips []slip.Slip) ([]slip.Slip, error)
+	GetSlip(ctx context.Context, id int64) (slip.Slip, error)
+	GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error)
+	SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error)
+	UpdateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error)
+	PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error)
+	DeleteSlip(ctx context.Context, id, version int64) error
+	ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error)
+	GetTrash(ctx context.Context) ([]slip.Slip, error)
+	RestoreSlip(ctx context.Context, id int64) error
+	PurgeSlip(ctx context.Context, id int64) error
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error)
+	GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error)
+	RestoreRevision(ctx context.Context, id, rev int64, links []string) error
+	GetLinks(ctx context.Context, id int64) ([]slip.Link, error)
+	GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error)
+	Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error
+	GetTags(ctx context.Context) ([]slip.Tag, error)
+	RenameTag(ctx context.Context, from, to string) (int64, error)
+	MergeTags(ctx context.Context, m slip.TagMerge) (int64, error)
 }
 
 type Service struct {
@@ -20,42 +45,363 @@ func NewService(r repository) *Service {
 	}
 }
 
-func (s *Service) CreateSlip(slip slip.Slip) error {
-	err := s.repository.CreateSlip(slip)
+func (s *Service) CreateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error) {
+	if err := slip.Validate(); err != nil {
+		return slip, err
+	}
+	created, err := s.repository.CreateSlip(ctx, withLinks(slip))
 	if err != nil {
-		return err
+		return created, err
 	}
-	return nil
+	return created, nil
 }
 
-func (s *Service) GetSlip(id int64) (slip.Slip, error) {
-	slip, err := s.repository.GetSlip(id)
+// ImportSlips validates every item and, unless dryRun is set or any item
+// failed, stores them all at once. Missing timestamps default to now, or to
+// the creation time for updated_at. The report has a result for each item.
+func (s *Service) ImportSlips(ctx context.Context, items []slip.ImportItem, dryRun bool) (slip.ImportReport, error) {
+	if len(items) == 0 {
+		return slip.ImportReport{}, slip.InvalidError("nothing to import")
+	}
+	report := slip.ImportReport{DryRun: dryRun, Results: make([]slip.ImportResult, len(items))}
+	slips := make([]slip.Slip, len(items))
+	now := time.Now()
+	for i, item := range items {
+		report.Results[i].Source = item.Source
+		err := item.Err
+		if err == nil {
+			err = item.Slip.ValidateImport()
+		}
+		if err != nil {
+			report.Results[i].Error = err.Error()
+			report.Failed++
+			continue
+		}
+		sl := item.Slip
+		if sl.CreatedAt.IsZero() {
+			sl.CreatedAt = now
+		}
+		if sl.UpdatedAt.IsZero() {
+			sl.UpdatedAt = sl.CreatedAt
+		}
+		sl.CreatedAt = sl.CreatedAt.Truncate(time.Microsecond)
+		sl.UpdatedAt = sl.UpdatedAt.Truncate(time.Microsecond)
+		slips[i] = withLinks(sl)
+	}
+	if report.Failed > 0 || dryRun {
+		return report, nil
+	}
+
+	created, err := s.repository.ImportSlips(ctx, slips)
+	if err != nil {
+		return slip.ImportReport{}, err
+	}
+	for i, sl := range created {
+		report.Results[i].ID = sl.ID
+	}
+	report.Imported = len(created)
+	return report, nil
+}
+
+func (s *Service) GetSlip(ctx context.Context, id int64) (slip.Slip, error) {
+	slip, err := s.repository.GetSlip(ctx, id)
 	if err != nil {
 		return slip, err
 	}
 	return slip, nil
 }
 
-func (s *Service) GetAllSlips() ([]slip.Slip, error) {
-	slips, err := s.repository.GetAllSlips()
+func (s *Service) GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error) {
+	if err := opts.Validate(); err != nil {
+		return slip.Page{}, err
+	}
+	page, err := s.repository.GetAllSlips(ctx, opts)
+	if err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+func (s *Service) SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	results, err := s.repository.SearchSlips(ctx, opts)
+	if err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func (s *Service) UpdateSlip(ctx context.Context, slip slip.Slip) (slip.Slip, error) {
+	if err := slip.Validate(); err != nil {
+		return slip, err
+	}
+	updated, err := s.repository.UpdateSlip(ctx, withLinks(slip))
+	if err != nil {
+		return updated, err
+	}
+	return updated, nil
+}
+
+func (s *Service) PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error) {
+	if err := p.Validate(); err != nil {
+		return slip.Slip{}, err
+	}
+	if p.Body != nil {
+		p.Links = slip.ParseLinks(*p.Body)
+	}
+	patched, err := s.repository.PatchSlip(ctx, id, p)
+	if err != nil {
+		return patched, err
+	}
+	return patched, nil
+}
+
+func (s *Service) DeleteSlip(ctx context.Context, id, version int64) error {
+	err := s.repository.DeleteSlip(ctx, id, version)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ApplyBatch applies a batch of operations and reports on each. Operations
+// that are incomplete are refused before anything is applied, failing the
+// whole batch unless it continues on error.
+func (s *Service) ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	results := make([]slip.BatchResult, len(b.Operations))
+	valid := slip.Batch{ContinueOnError: b.ContinueOnError}
+	indexes := make([]int, 0, len(b.Operations))
+	for i, op := range b.Operations {
+		if err := op.Validate(); err != nil {
+			if !b.ContinueOnError {
+				slip.AbandonBatch(results, i, err)
+				for j := 0; j < i; j++ {
+					results[j].Status = slip.StatusSkipped
+				}
+				return results, nil
+			}
+			results[i] = slip.BatchResult{Status: slip.StatusFailed, Err: err}
+			continue
+		}
+		if op.Op != slip.OpDelete {
+			op.Links = slip.ParseLinks(op.Body)
+		}
+		valid.Operations = append(valid.Operations, op)
+		indexes = append(indexes, i)
+	}
+	if len(valid.Operations) == 0 {
+		return results, nil
+	}
+
+	applied, err := s.repository.ApplyBatch(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for j, result := range applied {
+		results[indexes[j]] = result
+	}
+	return results, nil
+}
+
+func (s *Service) GetTrash(ctx context.Context) ([]slip.Slip, error) {
+	slips, err := s.repository.GetTrash(ctx)
 	if err != nil {
 		return slips, err
 	}
 	return slips, nil
 }
 
-func (s *Service) UpdateSlip(slip slip.Slip) error {
-	err := s.repository.UpdateSlip(slip)
+func (s *Service) RestoreSlip(ctx context.Context, id int64) error {
+	err := s.repository.RestoreSlip(ctx, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Service) DeleteSlip(id int64) error {
-	err := s.repository.DeleteSlip(id)
+func (s *Service) PurgeSlip(ctx context.Context, id int64) error {
+	err := s.repository.PurgeSlip(ctx, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// PurgeTrash permanently deletes slips that have been in the trash for longer
+// than retention.
+func (s *Service) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	n, err := s.repository.PurgeTrash(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// PurgeTrashEvery runs PurgeTrash every interval until ctx is done.
+func (s *Service) PurgeTrashEvery(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeTrash(ctx, retention)
+			if err != nil {
+				log.Printf("Purging trash: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Purged %d slips from the trash", n)
+			}
+		}
+	}
+}
+
+func (s *Service) GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error) {
+	revisions, err := s.repository.GetRevisions(ctx, id)
+	if err != nil {
+		return revisions, err
+	}
+	return revisions, nil
+}
+
+func (s *Service) GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error) {
+	revision, err := s.repository.GetRevision(ctx, id, rev)
+	if err != nil {
+		return revision, err
+	}
+	return revision, nil
+}
+
+// DiffRevisions compares two revisions of a slip. A to of zero compares
+// against the latest revision.
+func (s *Service) DiffRevisions(ctx context.Context, id, from, to int64) (slip.RevisionDiff, error) {
+	older, err := s.repository.GetRevision(ctx, id, from)
+	if err != nil {
+		return slip.RevisionDiff{}, err
+	}
+	var newer slip.Revision
+	if to == 0 {
+		revisions, err := s.repository.GetRevisions(ctx, id)
+		if err != nil {
+			return slip.RevisionDiff{}, err
+		}
+		newer = revisions[len(revisions)-1]
+	} else {
+		newer, err = s.repository.GetRevision(ctx, id, to)
+		if err != nil {
+			return slip.RevisionDiff{}, err
+		}
+	}
+
+	return slip.RevisionDiff{
+		From:        older.Revision,
+		To:          newer.Revision,
+		AddedTags:   missingFrom(older.Tags, newer.Tags),
+		RemovedTags: missingFrom(newer.Tags, older.Tags),
+		Body: diff.Unified(
+			fmt.Sprintf("slip/%d/revisions/%d", id, older.Revision),
+			fmt.Sprintf("slip/%d/revisions/%d", id, newer.Revision),
+			older.Body, newer.Body),
+	}, nil
+}
+
+// missingFrom returns the tags in b that are not in a.
+func missingFrom(a, b []string) []string {
+	have := make(map[string]bool, len(a))
+	for _, tag := range a {
+		have[tag] = true
+	}
+	missing := []string{}
+	for _, tag := range b {
+		if !have[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
+// RestoreRevision puts an earlier revision of a slip back, with the links in
+// its body. Revisions never change, so the body can be read beforehand.
+func (s *Service) RestoreRevision(ctx context.Context, id, rev int64) error {
+	revision, err := s.repository.GetRevision(ctx, id, rev)
+	if err != nil {
+		return err
+	}
+	err = s.repository.RestoreRevision(ctx, id, rev, slip.ParseLinks(revision.Body))
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// withLinks fills in the targets of the links in the body of a slip about to
+// be written, for the repository to store alongside it.
+func withLinks(s slip.Slip) slip.Slip {
+	s.Links = slip.ParseLinks(s.Body)
+	return s
+}
+
+func (s *Service) GetLinks(ctx context.Context, id int64) ([]slip.Link, error) {
+	links, err := s.repository.GetLinks(ctx, id)
+	if err != nil {
+		return links, err
+	}
+	return links, nil
+}
+
+func (s *Service) GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error) {
+	slips, err := s.repository.GetBacklinks(ctx, id)
+	if err != nil {
+		return slips, err
+	}
+	return slips, nil
+}
+
+// Graph calls fn with each slip in the graph of the notebook that opts
+// select, as the repository produces them.
+func (s *Service) Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	return s.repository.Graph(ctx, opts, fn)
+}
+
+func (s *Service) GetTags(ctx context.Context) ([]slip.Tag, error) {
+	tags, err := s.repository.GetTags(ctx)
+	if err != nil {
+		return tags, err
+	}
+	return tags, nil
+}
+
+func (s *Service) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	if err := (slip.TagMerge{From: []string{from}, Into: to}).Validate(); err != nil {
+		return 0, err
+	}
+	if from == to {
+		return 0, slip.InvalidError("tag %q renamed to itself", from)
+	}
+	n, err := s.repository.RenameTag(ctx, from, to)
+	if err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (s *Service) MergeTags(ctx context.Context, m slip.TagMerge) (int64, error) {
+	if err := m.Validate(); err != nil {
+		return 0, err
+	}
+	n, err := s.repository.MergeTags(ctx, m)
+	if err != nil {
+		return n, err
+	}
+	return n, nil
+}
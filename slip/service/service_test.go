@@ -1,26 +1,105 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/pmaterer/meta/slip"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockRepository struct {
-	CreateSlipFunc  func(s slip.Slip) error
-	GetSlipFunc     func(id int64) (slip.Slip, error)
-	GetAllSlipsFunc func() ([]slip.Slip, error)
-	UpdateSlipFunc  func(s slip.Slip) error
-	DeleteSlipFunc  func(id int64) error
+	CreateSlipFunc      func(s slip.Slip) (slip.Slip, error)
+	ImportSlipsFunc     func(slips []slip.Slip) ([]slip.Slip, error)
+	GetSlipFunc         func(id int64) (slip.Slip, error)
+	GetAllSlipsFunc     func(opts slip.ListOptions) (slip.Page, error)
+	SearchSlipsFunc     func(opts slip.SearchOptions) ([]slip.SearchResult, error)
+	UpdateSlipFunc      func(s slip.Slip) (slip.Slip, error)
+	DeleteSlipFunc      func(id, version int64) error
+	ApplyBatchFunc      func(b slip.Batch) ([]slip.BatchResult, error)
+	GetTagsFunc         func() ([]slip.Tag, error)
+	RenameTagFunc       func(from, to string) (int64, error)
+	MergeTagsFunc       func(m slip.TagMerge) (int64, error)
+	GetRevisionsFunc    func(id int64) ([]slip.Revision, error)
+	GetRevisionFunc     func(id, rev int64) (slip.Revision, error)
+	RestoreRevisionFunc func(id, rev int64, links []string) error
+	GetTrashFunc        func() ([]slip.Slip, error)
+	RestoreSlipFunc     func(id int64) error
+	PurgeSlipFunc       func(id int64) error
+	PurgeTrashFunc      func(before time.Time) (int64, error)
+	PatchSlipFunc       func(id int64, p slip.Patch) (slip.Slip, error)
+	GetLinksFunc        func(id int64) ([]slip.Link, error)
+	GetBacklinksFunc    func(id int64) ([]slip.Slip, error)
+	GraphFunc           func(opts slip.GraphOptions, fn func(slip.GraphSlip) error) error
 }
 
-func (r *mockRepository) CreateSlip(s slip.Slip) error        { return r.CreateSlipFunc(s) }
-func (r *mockRepository) GetSlip(id int64) (slip.Slip, error) { return r.GetSlipFunc(id) }
-func (r *mockRepository) GetAllSlips() ([]slip.Slip, error)   { return r.GetAllSlipsFunc() }
-func (r *mockRepository) UpdateSlip(s slip.Slip) error        { return r.UpdateSlipFunc(s) }
-func (r *mockRepository) DeleteSlip(id int64) error           { return r.DeleteSlipFunc(id) }
+func (r *mockRepository) CreateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	return r.CreateSlipFunc(s)
+}
+func (r *mockRepository) ImportSlips(ctx context.Context, slips []slip.Slip) ([]slip.Slip, error) {
+	return r.ImportSlipsFunc(slips)
+}
+func (r *mockRepository) GetSlip(ctx context.Context, id int64) (slip.Slip, error) {
+	return r.GetSlipFunc(id)
+}
+func (r *mockRepository) GetAllSlips(ctx context.Context, opts slip.ListOptions) (slip.Page, error) {
+	return r.GetAllSlipsFunc(opts)
+}
+func (r *mockRepository) SearchSlips(ctx context.Context, opts slip.SearchOptions) ([]slip.SearchResult, error) {
+	return r.SearchSlipsFunc(opts)
+}
+func (r *mockRepository) UpdateSlip(ctx context.Context, s slip.Slip) (slip.Slip, error) {
+	return r.UpdateSlipFunc(s)
+}
+func (r *mockRepository) DeleteSlip(ctx context.Context, id, version int64) error {
+	return r.DeleteSlipFunc(id, version)
+}
+func (r *mockRepository) ApplyBatch(ctx context.Context, b slip.Batch) ([]slip.BatchResult, error) {
+	return r.ApplyBatchFunc(b)
+}
+func (r *mockRepository) GetTags(ctx context.Context) ([]slip.Tag, error) { return r.GetTagsFunc() }
+func (r *mockRepository) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	return r.RenameTagFunc(from, to)
+}
+func (r *mockRepository) MergeTags(ctx context.Context, m slip.TagMerge) (int64, error) {
+	return r.MergeTagsFunc(m)
+}
+func (r *mockRepository) GetRevisions(ctx context.Context, id int64) ([]slip.Revision, error) {
+	return r.GetRevisionsFunc(id)
+}
+func (r *mockRepository) GetRevision(ctx context.Context, id, rev int64) (slip.Revision, error) {
+	return r.GetRevisionFunc(id, rev)
+}
+func (r *mockRepository) RestoreRevision(ctx context.Context, id, rev int64, links []string) error {
+	return r.RestoreRevisionFunc(id, rev, links)
+}
+func (r *mockRepository) GetTrash(ctx context.Context) ([]slip.Slip, error) {
+	return r.GetTrashFunc()
+}
+func (r *mockRepository) RestoreSlip(ctx context.Context, id int64) error {
+	return r.RestoreSlipFunc(id)
+}
+func (r *mockRepository) PurgeSlip(ctx context.Context, id int64) error {
+	return r.PurgeSlipFunc(id)
+}
+func (r *mockRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	return r.PurgeTrashFunc(before)
+}
+func (r *mockRepository) PatchSlip(ctx context.Context, id int64, p slip.Patch) (slip.Slip, error) {
+	return r.PatchSlipFunc(id, p)
+}
+
+func (r *mockRepository) GetLinks(ctx context.Context, id int64) ([]slip.Link, error) {
+	return r.GetLinksFunc(id)
+}
+func (r *mockRepository) GetBacklinks(ctx context.Context, id int64) ([]slip.Slip, error) {
+	return r.GetBacklinksFunc(id)
+}
+func (r *mockRepository) Graph(ctx context.Context, opts slip.GraphOptions, fn func(slip.GraphSlip) error) error {
+	return r.GraphFunc(opts, fn)
+}
 
 var (
 	testSlip = slip.Slip{
@@ -67,20 +146,20 @@ func TestCreateSlip(t *testing.T) {
 	tests := []struct {
 		name        string
 		errExpected bool
-		method      func(s slip.Slip) error
+		method      func(s slip.Slip) (slip.Slip, error)
 	}{
 		{
 			name:        "Create slip OK",
 			errExpected: false,
-			method: func(s slip.Slip) error {
-				return nil
+			method: func(s slip.Slip) (slip.Slip, error) {
+				return s, nil
 			},
 		},
 		{
 			name:        "Create slip error",
 			errExpected: true,
-			method: func(s slip.Slip) error {
-				return errors.New("oh no")
+			method: func(s slip.Slip) (slip.Slip, error) {
+				return s, errors.New("oh no")
 			},
 		},
 	}
@@ -89,7 +168,7 @@ func TestCreateSlip(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockRepository{CreateSlipFunc: tt.method}
 			s := NewService(r)
-			err := s.CreateSlip(testSlip)
+			_, err := s.CreateSlip(context.Background(), testSlip)
 			if tt.errExpected {
 				assert.Error(t, err)
 			} else {
@@ -99,6 +178,28 @@ func TestCreateSlip(t *testing.T) {
 	}
 }
 
+func TestCreateSlipInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+	}{
+		{name: "Blank tag", tags: []string{"tag1", " "}},
+		{name: "Duplicate tag", tags: []string{"tag1", "tag1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mockRepository{CreateSlipFunc: func(s slip.Slip) (slip.Slip, error) {
+				t.Fatal("repository called with invalid slip")
+				return s, nil
+			}}
+			s := NewService(r)
+			_, err := s.CreateSlip(context.Background(), slip.Slip{Body: "Lorem ipsum", Tags: tt.tags})
+			assert.True(t, errors.Is(err, slip.ErrInvalid))
+		})
+	}
+}
+
 func TestGetSlip(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -125,7 +226,7 @@ func TestGetSlip(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockRepository{GetSlipFunc: tt.method}
 			s := NewService(r)
-			slip, err := s.GetSlip(1)
+			slip, err := s.GetSlip(context.Background(), 1)
 			if tt.errExpected {
 				assert.Error(t, err)
 			} else {
@@ -141,20 +242,20 @@ func TestGetAllSlips(t *testing.T) {
 	tests := []struct {
 		name        string
 		errExpected bool
-		method      func() ([]slip.Slip, error)
+		method      func(opts slip.ListOptions) (slip.Page, error)
 	}{
 		{
 			name:        "Get all slips OK",
 			errExpected: false,
-			method: func() ([]slip.Slip, error) {
-				return testSlips, nil
+			method: func(opts slip.ListOptions) (slip.Page, error) {
+				return slip.Page{Slips: testSlips}, nil
 			},
 		},
 		{
 			name:        "Get all slips error",
 			errExpected: true,
-			method: func() ([]slip.Slip, error) {
-				return testSlips, errors.New("this is bad")
+			method: func(opts slip.ListOptions) (slip.Page, error) {
+				return slip.Page{}, errors.New("this is bad")
 			},
 		},
 	}
@@ -163,12 +264,12 @@ func TestGetAllSlips(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockRepository{GetAllSlipsFunc: tt.method}
 			s := NewService(r)
-			slips, err := s.GetAllSlips()
+			page, err := s.GetAllSlips(context.Background(), slip.ListOptions{})
 			if tt.errExpected {
 				assert.Error(t, err)
 			} else {
 				assert.Nil(t, err)
-				for i, s := range slips {
+				for i, s := range page.Slips {
 					assert.Equal(t, testSlips[i].ID, s.ID)
 					assert.Equal(t, testSlips[i].Body, s.Body)
 					assert.Equal(t, testSlips[i].Tags, s.Tags)
@@ -178,24 +279,108 @@ func TestGetAllSlips(t *testing.T) {
 	}
 }
 
+func TestGetAllSlipsOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		tags        []string
+		errExpected bool
+		expected    int
+	}{
+		{name: "Default limit", limit: 0, expected: slip.DefaultPageLimit},
+		{name: "Explicit limit", limit: 10, expected: 10},
+		{name: "Negative limit", limit: -1, errExpected: true},
+		{name: "Limit too large", limit: slip.MaxPageLimit + 1, errExpected: true},
+		{name: "Blank tag filter", tags: []string{""}, errExpected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mockRepository{GetAllSlipsFunc: func(opts slip.ListOptions) (slip.Page, error) {
+				assert.Equal(t, tt.expected, opts.Limit)
+				return slip.Page{}, nil
+			}}
+			s := NewService(r)
+			_, err := s.GetAllSlips(context.Background(), slip.ListOptions{Limit: tt.limit, NotTags: tt.tags})
+			if tt.errExpected {
+				assert.True(t, errors.Is(err, slip.ErrInvalid))
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestSearchSlips(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		limit       int
+		errExpected bool
+		method      func(opts slip.SearchOptions) ([]slip.SearchResult, error)
+	}{
+		{
+			name:  "Search slips OK",
+			query: "lorem",
+			method: func(opts slip.SearchOptions) ([]slip.SearchResult, error) {
+				assert.Equal(t, slip.DefaultPageLimit, opts.Limit)
+				return []slip.SearchResult{{Slip: testSlip, Rank: 0.5}}, nil
+			},
+		},
+		{
+			name:        "Search slips empty query",
+			query:       "  ",
+			errExpected: true,
+		},
+		{
+			name:        "Search slips limit too large",
+			query:       "lorem",
+			limit:       slip.MaxPageLimit + 1,
+			errExpected: true,
+		},
+		{
+			name:        "Search slips error",
+			query:       "lorem",
+			errExpected: true,
+			method: func(opts slip.SearchOptions) ([]slip.SearchResult, error) {
+				return nil, errors.New("index exploded")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mockRepository{SearchSlipsFunc: tt.method}
+			s := NewService(r)
+			results, err := s.SearchSlips(context.Background(), slip.SearchOptions{Query: tt.query, Limit: tt.limit})
+			if tt.errExpected {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, testSlip.ID, results[0].ID)
+			}
+		})
+	}
+}
+
 func TestUpdateSlip(t *testing.T) {
 	tests := []struct {
 		name        string
 		errExpected bool
-		method      func(s slip.Slip) error
+		method      func(s slip.Slip) (slip.Slip, error)
 	}{
 		{
 			name:        "Update slip OK",
 			errExpected: false,
-			method: func(s slip.Slip) error {
-				return nil
+			method: func(s slip.Slip) (slip.Slip, error) {
+				return s, nil
 			},
 		},
 		{
 			name:        "Update slip error",
 			errExpected: true,
-			method: func(s slip.Slip) error {
-				return errors.New("things went wrong")
+			method: func(s slip.Slip) (slip.Slip, error) {
+				return s, errors.New("things went wrong")
 			},
 		},
 	}
@@ -204,7 +389,7 @@ func TestUpdateSlip(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockRepository{UpdateSlipFunc: tt.method}
 			s := NewService(r)
-			err := s.UpdateSlip(testSlip)
+			_, err := s.UpdateSlip(context.Background(), testSlip)
 			if tt.errExpected {
 				assert.Error(t, err)
 			} else {
@@ -218,19 +403,19 @@ func TestDeleteSlip(t *testing.T) {
 	tests := []struct {
 		name        string
 		errExpected bool
-		method      func(id int64) error
+		method      func(id, version int64) error
 	}{
 		{
 			name:        "Delete slip OK",
 			errExpected: false,
-			method: func(id int64) error {
+			method: func(id, version int64) error {
 				return nil
 			},
 		},
 		{
 			name:        "Delete slip error",
 			errExpected: true,
-			method: func(id int64) error {
+			method: func(id, version int64) error {
 				return errors.New("kaboom")
 			},
 		},
@@ -240,12 +425,352 @@ func TestDeleteSlip(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockRepository{DeleteSlipFunc: tt.method}
 			s := NewService(r)
-			err := s.DeleteSlip(1)
+			err := s.DeleteSlip(context.Background(), 1, 0)
+			if tt.errExpected {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		from, to    string
+		errExpected bool
+		method      func(from, to string) (int64, error)
+	}{
+		{
+			name: "Rename tag OK",
+			from: "golang",
+			to:   "go",
+			method: func(from, to string) (int64, error) {
+				return 3, nil
+			},
+		},
+		{
+			name:        "Rename tag to itself",
+			from:        "go",
+			to:          "go",
+			errExpected: true,
+		},
+		{
+			name:        "Rename tag to blank",
+			from:        "go",
+			to:          " ",
+			errExpected: true,
+		},
+		{
+			name:        "Rename tag error",
+			from:        "golang",
+			to:          "go",
+			errExpected: true,
+			method: func(from, to string) (int64, error) {
+				return 0, errors.New("splat")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mockRepository{RenameTagFunc: tt.method}
+			s := NewService(r)
+			n, err := s.RenameTag(context.Background(), tt.from, tt.to)
 			if tt.errExpected {
 				assert.Error(t, err)
 			} else {
 				assert.Nil(t, err)
+				assert.Equal(t, int64(3), n)
 			}
 		})
 	}
 }
+
+func TestMergeTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		merge       slip.TagMerge
+		errExpected bool
+		method      func(m slip.TagMerge) (int64, error)
+	}{
+		{
+			name:  "Merge tags OK",
+			merge: slip.TagMerge{From: []string{"golang", "Go"}, Into: "go"},
+			method: func(m slip.TagMerge) (int64, error) {
+				return 2, nil
+			},
+		},
+		{
+			name:        "Merge nothing",
+			merge:       slip.TagMerge{Into: "go"},
+			errExpected: true,
+		},
+		{
+			name:        "Merge blank tag",
+			merge:       slip.TagMerge{From: []string{""}, Into: "go"},
+			errExpected: true,
+		},
+		{
+			name:        "Merge tags error",
+			merge:       slip.TagMerge{From: []string{"golang"}, Into: "go"},
+			errExpected: true,
+			method: func(m slip.TagMerge) (int64, error) {
+				return 0, errors.New("splat")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mockRepository{MergeTagsFunc: tt.method}
+			s := NewService(r)
+			n, err := s.MergeTags(context.Background(), tt.merge)
+			if tt.errExpected {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, int64(2), n)
+			}
+		})
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	revisions := []slip.Revision{
+		{SlipID: 1, Revision: 1, Body: "Lorem ipsum\n", Tags: []string{"tag1", "tag2"}},
+		{SlipID: 1, Revision: 2, Body: "Lorem ipsum\ndolor\n", Tags: []string{"tag2", "tag3"}},
+		{SlipID: 1, Revision: 3, Body: "Lorem ipsum\ndolor\n", Tags: []string{"tag2", "tag3"}},
+	}
+	r := &mockRepository{
+		GetRevisionFunc: func(id, rev int64) (slip.Revision, error) {
+			if rev < 1 || rev > int64(len(revisions)) {
+				return slip.Revision{}, slip.RevisionNotFoundError(id, rev)
+			}
+			return revisions[rev-1], nil
+		},
+		GetRevisionsFunc: func(id int64) ([]slip.Revision, error) {
+			return revisions, nil
+		},
+	}
+	s := NewService(r)
+
+	d, err := s.DiffRevisions(context.Background(), 1, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tag3"}, d.AddedTags)
+	assert.Equal(t, []string{"tag1"}, d.RemovedTags)
+	assert.Equal(t, "--- slip/1/revisions/1\n+++ slip/1/revisions/2\n@@ -1 +1,2 @@\n Lorem ipsum\n+dolor\n", d.Body)
+
+	d, err = s.DiffRevisions(context.Background(), 1, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), d.To)
+	assert.Empty(t, d.AddedTags)
+	assert.Empty(t, d.RemovedTags)
+	assert.Empty(t, d.Body)
+
+	_, err = s.DiffRevisions(context.Background(), 1, 9, 0)
+	assert.True(t, errors.Is(err, slip.ErrNotFound))
+}
+
+func TestPurgeTrash(t *testing.T) {
+	var cutoff time.Time
+	r := &mockRepository{
+		PurgeTrashFunc: func(before time.Time) (int64, error) {
+			cutoff = before
+			return 2, nil
+		},
+	}
+	s := NewService(r)
+
+	n, err := s.PurgeTrash(context.Background(), 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), cutoff, time.Minute)
+}
+
+func TestPatchSlip(t *testing.T) {
+	tests := []struct {
+		name        string
+		patch       slip.Patch
+		errExpected bool
+		method      func(id int64, p slip.Patch) (slip.Slip, error)
+	}{
+		{
+			name:  "Patch slip OK",
+			patch: slip.Patch{AddTags: []string{"tag4"}},
+			method: func(id int64, p slip.Patch) (slip.Slip, error) {
+				return testSlip, nil
+			},
+		},
+		{
+			name:        "Patch slip invalid",
+			patch:       slip.Patch{AddTags: []string{"tag4"}, RemoveTags: []string{"tag4"}},
+			errExpected: true,
+		},
+		{
+			name:        "Patch slip error",
+			patch:       slip.Patch{AddTags: []string{"tag4"}},
+			errExpected: true,
+			method: func(id int64, p slip.Patch) (slip.Slip, error) {
+				return slip.Slip{}, errors.New("whoops")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mockRepository{PatchSlipFunc: tt.method}
+			s := NewService(r)
+			_, err := s.PatchSlip(context.Background(), 1, tt.patch)
+			if tt.errExpected {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestImportSlips(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 6789, time.UTC)
+	items := []slip.ImportItem{
+		{Source: "a.md", Slip: slip.Slip{Body: "a", CreatedAt: created}},
+		{Source: "b.md", Slip: slip.Slip{Body: "b"}},
+	}
+	var imported []slip.Slip
+	s := NewService(&mockRepository{
+		ImportSlipsFunc: func(slips []slip.Slip) ([]slip.Slip, error) {
+			imported = slips
+			for i := range slips {
+				slips[i].ID = int64(i + 10)
+			}
+			return slips, nil
+		},
+	})
+
+	report, err := s.ImportSlips(context.Background(), items, true)
+	assert.NoError(t, err)
+	assert.Nil(t, imported, "a dry run stores nothing")
+	assert.Equal(t, slip.ImportReport{DryRun: true, Results: []slip.ImportResult{{Source: "a.md"}, {Source: "b.md"}}}, report)
+
+	report, err = s.ImportSlips(context.Background(), items, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, []slip.ImportResult{{Source: "a.md", ID: 10}, {Source: "b.md", ID: 11}}, report.Results)
+	assert.Equal(t, created.Truncate(time.Microsecond), imported[0].CreatedAt)
+	assert.Equal(t, imported[0].CreatedAt, imported[0].UpdatedAt)
+	assert.False(t, imported[1].CreatedAt.IsZero())
+}
+
+func TestImportSlipsInvalid(t *testing.T) {
+	s := NewService(&mockRepository{
+		ImportSlipsFunc: func(slips []slip.Slip) ([]slip.Slip, error) {
+			t.Fatal("nothing should be stored when an item fails")
+			return nil, nil
+		},
+	})
+	now := time.Now()
+	report, err := s.ImportSlips(context.Background(), []slip.ImportItem{
+		{Source: "row 1", Slip: slip.Slip{Body: "fine"}},
+		{Source: "row 2", Slip: slip.Slip{Tags: []string{"x", "x"}}},
+		{Source: "row 3", Err: errors.New("bad date")},
+		{Source: "row 4", Slip: slip.Slip{CreatedAt: now, UpdatedAt: now.Add(-time.Hour)}},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Imported)
+	assert.Equal(t, 3, report.Failed)
+	assert.Empty(t, report.Results[0].Error)
+	assert.Contains(t, report.Results[1].Error, "duplicate tag")
+	assert.Equal(t, "bad date", report.Results[2].Error)
+	assert.Contains(t, report.Results[3].Error, "before created_at")
+
+	_, err = s.ImportSlips(context.Background(), nil, false)
+	assert.True(t, errors.Is(err, slip.ErrInvalid))
+}
+
+func TestApplyBatch(t *testing.T) {
+	ops := []slip.Operation{
+		{Op: slip.OpCreate, Body: "new, after [[3]]"},
+		{Op: slip.OpUpdate, Body: "no id"},
+		{Op: slip.OpDelete, ID: 3},
+	}
+	var applied slip.Batch
+	s := NewService(&mockRepository{
+		ApplyBatchFunc: func(b slip.Batch) ([]slip.BatchResult, error) {
+			applied = b
+			results := make([]slip.BatchResult, len(b.Operations))
+			for i := range results {
+				results[i].Status = slip.StatusApplied
+			}
+			return results, nil
+		},
+	})
+
+	results, err := s.ApplyBatch(context.Background(), slip.Batch{Operations: ops})
+	assert.NoError(t, err)
+	assert.Empty(t, applied.Operations, "an incomplete operation stops the batch before it starts")
+	assert.Equal(t, slip.StatusSkipped, results[0].Status)
+	assert.Equal(t, slip.StatusFailed, results[1].Status)
+	assert.True(t, errors.Is(results[1].Err, slip.ErrInvalid))
+	assert.Equal(t, slip.StatusSkipped, results[2].Status)
+
+	results, err = s.ApplyBatch(context.Background(), slip.Batch{Operations: ops, ContinueOnError: true})
+	assert.NoError(t, err)
+	linked := ops[0]
+	linked.Links = []string{"3"}
+	assert.Equal(t, []slip.Operation{linked, ops[2]}, applied.Operations, "the service finds the links to store")
+	assert.True(t, applied.ContinueOnError)
+	assert.Equal(t, slip.StatusApplied, results[0].Status)
+	assert.Equal(t, slip.StatusFailed, results[1].Status)
+	assert.Equal(t, slip.StatusApplied, results[2].Status)
+
+	for _, b := range []slip.Batch{{}, {Operations: make([]slip.Operation, slip.MaxBatchSize+1)}} {
+		_, err = s.ApplyBatch(context.Background(), b)
+		assert.True(t, errors.Is(err, slip.ErrInvalid))
+	}
+}
+
+func TestWritesCarryLinks(t *testing.T) {
+	ctx := context.Background()
+	var links [][]string
+	s := NewService(&mockRepository{
+		CreateSlipFunc: func(s slip.Slip) (slip.Slip, error) {
+			links = append(links, s.Links)
+			return s, nil
+		},
+		UpdateSlipFunc: func(s slip.Slip) (slip.Slip, error) {
+			links = append(links, s.Links)
+			return s, nil
+		},
+		PatchSlipFunc: func(id int64, p slip.Patch) (slip.Slip, error) {
+			links = append(links, p.Links)
+			return slip.Slip{}, nil
+		},
+		ImportSlipsFunc: func(slips []slip.Slip) ([]slip.Slip, error) {
+			links = append(links, slips[0].Links)
+			return slips, nil
+		},
+		GetRevisionFunc: func(id, rev int64) (slip.Revision, error) {
+			return slip.Revision{Body: "was [[e]]"}, nil
+		},
+		RestoreRevisionFunc: func(id, rev int64, l []string) error {
+			links = append(links, l)
+			return nil
+		},
+	})
+
+	_, err := s.CreateSlip(ctx, slip.Slip{Body: "[[a]] [[b]] [[a]]"})
+	assert.NoError(t, err)
+	_, err = s.UpdateSlip(ctx, slip.Slip{ID: 1, Body: "[[c]]"})
+	assert.NoError(t, err)
+	body := "[[d]]"
+	_, err = s.PatchSlip(ctx, 1, slip.Patch{Body: &body})
+	assert.NoError(t, err)
+	_, err = s.PatchSlip(ctx, 1, slip.Patch{AddTags: []string{"x"}})
+	assert.NoError(t, err)
+	_, err = s.ImportSlips(ctx, []slip.ImportItem{{Slip: slip.Slip{Body: "no links"}}}, false)
+	assert.NoError(t, err)
+	assert.NoError(t, s.RestoreRevision(ctx, 1, 1))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}, {"d"}, nil, {}, {"e"}}, links)
+}
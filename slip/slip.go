@@ -3,9 +3,19 @@ package slip
 import "time"
 
 type Slip struct {
-	ID        int64     `json:"id"`
+	ID int64 `json:"id"`
+	// Title is the title the slip was given or, failing that, the one its
+	// body gives. Leaving it empty when writing lets it follow the body.
+	Title     string    `json:"title"`
 	Body      string    `json:"body"`
 	Tags      []string  `json:"tags"`
+	Version   int64     `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set while the slip is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Links are the targets of the links in Body, as ParseLinks finds them.
+	// The service fills them in for the repository to store with a body it
+	// writes; slips read back leave them empty.
+	Links []string `json:"-"`
 }
@@ -0,0 +1,29 @@
+package slip
+
+import "strings"
+
+// Tag is a tag name together with the number of slips carrying it.
+type Tag struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// TagMerge folds one or more tags into another. Every slip carrying any of
+// From ends up carrying Into instead, once.
+type TagMerge struct {
+	From []string `json:"from"`
+	Into string   `json:"into"`
+}
+
+// Validate checks that every tag named in the merge is usable.
+func (m TagMerge) Validate() error {
+	if len(m.From) == 0 {
+		return InvalidError("nothing to merge")
+	}
+	for _, tag := range append([]string{m.Into}, m.From...) {
+		if strings.TrimSpace(tag) == "" {
+			return InvalidError("tags must not be blank")
+		}
+	}
+	return nil
+}
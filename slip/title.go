@@ -0,0 +1,27 @@
+package slip
+
+import "strings"
+
+// Title is the title a body gives a slip that has not been given one: its
+// first line without any leading Markdown heading marks. [[title]] links
+// match slips by their titles, ignoring case. The databases derive the same
+// from the body in a generated column.
+func Title(body string) string {
+	title := strings.TrimLeft(body, "# \t\r\n")
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	return strings.TrimRight(title, " \t\r")
+}
+
+// GivenTitle is the title to store as the slip's own: its Title, trimmed,
+// unless that is blank or no more than the title its body gives anyway. A
+// slip read and written back unchanged thus goes on taking its title from
+// its body.
+func (s Slip) GivenTitle() string {
+	title := strings.TrimSpace(s.Title)
+	if title == Title(s.Body) {
+		return ""
+	}
+	return title
+}
@@ -0,0 +1,45 @@
+package slip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		body  string
+		title string
+	}{
+		{body: "Reading list\n\n- a book", title: "Reading list"},
+		{body: "\n## Reading list  \r\nmore", title: "Reading list"},
+		{body: "one line", title: "one line"},
+		{body: "", title: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			assert.Equal(t, tt.title, Title(tt.body))
+		})
+	}
+}
+
+func TestGivenTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		body  string
+		given string
+	}{
+		{title: "", body: "# Reading list", given: ""},
+		{title: "  ", body: "# Reading list", given: ""},
+		{title: "Reading list", body: "# Reading list\n\n- Dune", given: ""},
+		{title: " Books to read ", body: "# Reading list", given: "Books to read"},
+		{title: "reading list", body: "# Reading list", given: "reading list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.given, Slip{Title: tt.title, Body: tt.body}.GivenTitle())
+		})
+	}
+}
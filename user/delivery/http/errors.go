@@ -0,0 +1,56 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/user"
+)
+
+// errorBody is the JSON shape of every error response, the same as the
+// slip API's:
+//
+//	{"error": {"code": "unauthorized", "message": "unauthorized: no token"}}
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// bearerChallenge and basicChallenge name the ways a client may
+// authenticate, for the WWW-Authenticate header of a 401. Every 401 asks for
+// a bearer token; AuthenticateBrowser also asks for basic credentials.
+const (
+	bearerChallenge = `Bearer realm="meta"`
+	basicChallenge  = `Basic realm="meta", charset="UTF-8"`
+)
+
+// writeError maps err onto a status code using the user error taxonomy and
+// writes it as an errorBody. Anything unrecognised is a 500.
+func writeError(g *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, "internal"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		status, code = http.StatusGatewayTimeout, "timeout"
+	case errors.Is(err, user.ErrUnauthorized):
+		status, code = http.StatusUnauthorized, "unauthorized"
+		g.Writer.Header().Add("WWW-Authenticate", bearerChallenge)
+	case errors.Is(err, user.ErrNotFound):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, user.ErrInvalid):
+		status, code = http.StatusBadRequest, "invalid"
+	case errors.Is(err, user.ErrConflict):
+		status, code = http.StatusConflict, "conflict"
+	}
+	g.AbortWithStatusJSON(status, errorBody{Error: errorDetail{Code: code, Message: err.Error()}})
+}
+
+// badRequest reports malformed input, such as an unparsable id or body.
+func badRequest(g *gin.Context, err error) {
+	writeError(g, user.InvalidError("%v", err))
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/user"
+)
+
+type service interface {
+	Authenticate(ctx context.Context, secret string) (user.User, error)
+	CreateToken(ctx context.Context, userID int64, name string) (user.NewToken, error)
+	GetTokens(ctx context.Context, userID int64) ([]user.Token, error)
+	RevokeToken(ctx context.Context, userID, id int64) error
+}
+
+type Handler struct {
+	service service
+}
+
+func NewHandler(s service) *Handler {
+	return &Handler{
+		service: s,
+	}
+}
+
+// callerKey is where Authenticate keeps the caller in the gin context.
+const callerKey = "meta.caller"
+
+// Authenticate is middleware that works out who is calling from the bearer
+// token in the Authorization header. A bad token is always refused with 401
+// Unauthorized; a request without one only when required is set.
+func (h *Handler) Authenticate(required bool) gin.HandlerFunc {
+	return h.authenticate(required, false)
+}
+
+// AuthenticateBrowser is Authenticate for pages opened in a browser, which
+// does not know bearer tokens: the token may also be sent as the password of
+// basic authentication, and a 401 asks for it. The JSON API is left to
+// Authenticate, since a cross-site form can send basic credentials the
+// browser remembers but never a bearer token.
+func (h *Handler) AuthenticateBrowser(required bool) gin.HandlerFunc {
+	return h.authenticate(required, true)
+}
+
+func (h *Handler) authenticate(required, basic bool) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		refuse := func(err error) {
+			if basic {
+				g.Writer.Header().Add("WWW-Authenticate", basicChallenge)
+			}
+			writeError(g, err)
+		}
+		secret, ok := credentials(g.Request, basic)
+		if !ok {
+			if required {
+				refuse(fmt.Errorf("%w: no token", user.ErrUnauthorized))
+			}
+			return
+		}
+		u, err := h.service.Authenticate(g.Request.Context(), secret)
+		if err != nil {
+			refuse(err)
+			return
+		}
+		g.Set(callerKey, u)
+	}
+}
+
+// credentials takes the token secret from the Authorization header, as a
+// bearer token or, when basic is set, as the basic password. Any header it
+// cannot read still counts as credentials, just bad ones.
+func credentials(r *http.Request, basic bool) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+	if scheme, secret, ok := splitAuthorization(header); ok && strings.EqualFold(scheme, "Bearer") {
+		return secret, true
+	}
+	if !basic {
+		return "", true
+	}
+	_, password, _ := r.BasicAuth()
+	return password, true
+}
+
+func splitAuthorization(header string) (scheme, credentials string, ok bool) {
+	i := strings.IndexByte(header, ' ')
+	if i < 0 {
+		return "", "", false
+	}
+	return header[:i], strings.TrimSpace(header[i+1:]), true
+}
+
+// Caller is the user Authenticate found the request to come from, if any.
+func Caller(g *gin.Context) (user.User, bool) {
+	v, ok := g.Get(callerKey)
+	if !ok {
+		return user.User{}, false
+	}
+	u, ok := v.(user.User)
+	return u, ok
+}
+
+// caller is the caller of a request that must have one, or answers it with
+// 401 Unauthorized and returns false.
+func caller(g *gin.Context) (user.User, bool) {
+	u, ok := Caller(g)
+	if !ok {
+		writeError(g, fmt.Errorf("%w: no token", user.ErrUnauthorized))
+	}
+	return u, ok
+}
+
+type tokenRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateToken gives the caller a new token and answers 201 Created with it.
+// The secret is in the response and nowhere else. The body, naming the
+// token, may be left out.
+func (h *Handler) CreateToken(g *gin.Context) {
+	u, ok := caller(g)
+	if !ok {
+		return
+	}
+	var req tokenRequest
+	if err := g.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		badRequest(g, err)
+		return
+	}
+	created, err := h.service.CreateToken(g.Request.Context(), u.ID, req.Name)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusCreated, created)
+}
+
+// GetTokens lists the caller's tokens, without their secrets.
+func (h *Handler) GetTokens(g *gin.Context) {
+	u, ok := caller(g)
+	if !ok {
+		return
+	}
+	tokens, err := h.service.GetTokens(g.Request.Context(), u.ID)
+	if err != nil {
+		writeError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken deletes one of the caller's tokens. It may be the token the
+// request was made with.
+func (h *Handler) RevokeToken(g *gin.Context) {
+	u, ok := caller(g)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(g.Param("id"), 10, 64)
+	if err != nil {
+		badRequest(g, err)
+		return
+	}
+	if err := h.service.RevokeToken(g.Request.Context(), u.ID, id); err != nil {
+		writeError(g, err)
+		return
+	}
+	g.Status(http.StatusNoContent)
+}
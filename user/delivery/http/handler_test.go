@@ -0,0 +1,165 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmaterer/meta/user"
+	"github.com/pmaterer/meta/user/repository"
+	userservice "github.com/pmaterer/meta/user/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter serves the token endpoints and /whoami, which answers with
+// the caller's name, behind Authenticate, and /ui/whoami behind
+// AuthenticateBrowser. It returns a token for alice.
+func newTestRouter(t *testing.T, required bool) (*gin.Engine, string) {
+	s := userservice.NewService(repository.NewMemoryRepository())
+	alice, err := s.EnsureUser(context.Background(), "alice")
+	require.NoError(t, err)
+	token, err := s.CreateToken(context.Background(), alice.ID, "test")
+	require.NoError(t, err)
+
+	h := NewHandler(s)
+	whoami := func(g *gin.Context) {
+		u, ok := Caller(g)
+		if !ok {
+			g.String(http.StatusOK, "nobody")
+			return
+		}
+		g.String(http.StatusOK, u.Name)
+	}
+	r := gin.Default()
+	r.GET("/ui/whoami", h.AuthenticateBrowser(required), whoami)
+	api := r.Group("", h.Authenticate(required))
+	api.GET("/whoami", whoami)
+	api.POST("/tokens", h.CreateToken)
+	api.GET("/tokens", h.GetTokens)
+	api.DELETE("/tokens/:id", h.RevokeToken)
+	return r, token.Secret
+}
+
+func do(r *gin.Engine, method, path, authorization, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticate(t *testing.T) {
+	r, secret := newTestRouter(t, true)
+
+	w := do(r, "GET", "/whoami", "Bearer "+secret, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	w = do(r, "GET", "/whoami", "bearer "+secret, "")
+	assert.Equal(t, "alice", w.Body.String())
+
+	basic := func(path, password string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.SetBasicAuth("anyone", password)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Only the pages take basic credentials.
+	w = basic("/whoami", secret)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, []string{`Bearer realm="meta"`}, w.Header().Values("WWW-Authenticate"))
+	w = basic("/ui/whoami", secret)
+	assert.Equal(t, "alice", w.Body.String())
+	w = do(r, "GET", "/ui/whoami", "Bearer "+secret, "")
+	assert.Equal(t, "alice", w.Body.String())
+
+	for _, authorization := range []string{"", "Bearer ", "Bearer meta_wrong", "Bearer " + secret + "x", "Token " + secret, "Basic !!!"} {
+		w = do(r, "GET", "/whoami", authorization, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, authorization)
+		assert.Equal(t, []string{`Bearer realm="meta"`}, w.Header().Values("WWW-Authenticate"))
+		assert.Contains(t, w.Body.String(), `"code":"unauthorized"`)
+
+		w = do(r, "GET", "/ui/whoami", authorization, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, authorization)
+		assert.Equal(t, []string{`Basic realm="meta", charset="UTF-8"`, `Bearer realm="meta"`}, w.Header().Values("WWW-Authenticate"))
+	}
+	w = basic("/ui/whoami", "meta_wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthenticateOptional(t *testing.T) {
+	r, secret := newTestRouter(t, false)
+
+	w := do(r, "GET", "/whoami", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "nobody", w.Body.String())
+
+	w = do(r, "GET", "/whoami", "Bearer "+secret, "")
+	assert.Equal(t, "alice", w.Body.String())
+
+	// A token that is sent must still be good.
+	w = do(r, "GET", "/whoami", "Bearer meta_wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The token endpoints need to know whose tokens they are.
+	w = do(r, "GET", "/tokens", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokens(t *testing.T) {
+	r, secret := newTestRouter(t, true)
+	auth := "Bearer " + secret
+
+	w := do(r, "POST", "/tokens", auth, `{"name":"laptop"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created user.NewToken
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, int64(2), created.ID)
+	assert.Equal(t, "laptop", created.Name)
+	assert.True(t, user.IsSecret(created.Secret))
+	assert.NotContains(t, w.Body.String(), "hash")
+
+	w = do(r, "GET", "/whoami", "Bearer "+created.Secret, "")
+	assert.Equal(t, "alice", w.Body.String())
+
+	w = do(r, "POST", "/tokens", auth, "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = do(r, "POST", "/tokens", auth, `{"name":"a\nb"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do(r, "POST", "/tokens", auth, `{"name":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(r, "GET", "/tokens", auth, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	require.Len(t, tokens, 3)
+	assert.Equal(t, "test", tokens[0]["name"])
+	assert.NotNil(t, tokens[0]["last_used_at"])
+	assert.Equal(t, "laptop", tokens[1]["name"])
+	assert.NotContains(t, w.Body.String(), created.Secret)
+
+	w = do(r, "DELETE", "/tokens/2", auth, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do(r, "GET", "/whoami", "Bearer "+created.Secret, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = do(r, "DELETE", "/tokens/2", auth, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(r, "DELETE", "/tokens/x", auth, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Revoking the token in use works, and it stops working at once.
+	w = do(r, "DELETE", "/tokens/1", auth, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do(r, "GET", "/tokens", auth, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
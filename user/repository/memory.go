@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pmaterer/meta/user"
+)
+
+// MemoryRepository keeps users and tokens in memory, for demos and tests.
+// It is safe for concurrent use. Nothing is kept once the process exits.
+type MemoryRepository struct {
+	mu          sync.Mutex
+	lastUserID  int64
+	lastTokenID int64
+	users       []user.User
+	tokens      []user.Token
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+// memoryNow is the current time at the microsecond precision Postgres keeps.
+func memoryNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (r *MemoryRepository) CreateUser(ctx context.Context, u user.User) (user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Name == u.Name {
+			return user.User{}, fmt.Errorf("%w: user %q already exists", user.ErrConflict, u.Name)
+		}
+	}
+	r.lastUserID++
+	created := user.User{ID: r.lastUserID, Name: u.Name, CreatedAt: memoryNow()}
+	r.users = append(r.users, created)
+	return created, nil
+}
+
+func (r *MemoryRepository) GetUserByName(ctx context.Context, name string) (user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+	return user.User{}, userNotFound(name)
+}
+
+// CreateToken stores a token for t.UserID under t.Hash and returns it as
+// stored.
+func (r *MemoryRepository) CreateToken(ctx context.Context, t user.Token) (user.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.user(t.UserID); !ok {
+		return user.Token{}, fmt.Errorf("%w: user %d does not exist", user.ErrConflict, t.UserID)
+	}
+	for _, existing := range r.tokens {
+		if existing.Hash == t.Hash {
+			return user.Token{}, fmt.Errorf("%w: token already exists", user.ErrConflict)
+		}
+	}
+	r.lastTokenID++
+	created := user.Token{ID: r.lastTokenID, UserID: t.UserID, Name: t.Name, Hash: t.Hash, CreatedAt: memoryNow()}
+	r.tokens = append(r.tokens, created)
+	return created, nil
+}
+
+// GetTokens lists the tokens of a user, oldest first.
+func (r *MemoryRepository) GetTokens(ctx context.Context, userID int64) ([]user.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tokens := []user.Token{}
+	for _, t := range r.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, copyToken(t))
+		}
+	}
+	return tokens, nil
+}
+
+// DeleteToken revokes a token of a user. Another user's token is not found.
+func (r *MemoryRepository) DeleteToken(ctx context.Context, userID, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, t := range r.tokens {
+		if t.ID == id && t.UserID == userID {
+			r.tokens = append(r.tokens[:i], r.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("token %d: %w", id, user.ErrNotFound)
+}
+
+// UseToken returns the owner of the token with the given hash, noting that
+// the token was used unless that was noted less than touchInterval ago.
+func (r *MemoryRepository) UseToken(ctx context.Context, hash string) (user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, t := range r.tokens {
+		if t.Hash == hash {
+			now := memoryNow()
+			if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= touchInterval {
+				r.tokens[i].LastUsedAt = &now
+			}
+			u, _ := r.user(t.UserID)
+			return u, nil
+		}
+	}
+	return user.User{}, fmt.Errorf("token: %w", user.ErrNotFound)
+}
+
+func (r *MemoryRepository) user(id int64) (user.User, bool) {
+	for _, u := range r.users {
+		if u.ID == id {
+			return u, true
+		}
+	}
+	return user.User{}, false
+}
+
+// copyToken copies t so that callers cannot change the stored token through
+// LastUsedAt.
+func copyToken(t user.Token) user.Token {
+	if t.LastUsedAt != nil {
+		used := *t.LastUsedAt
+		t.LastUsedAt = &used
+	}
+	return t
+}
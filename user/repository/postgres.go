@@ -0,0 +1,158 @@
+// Package repository stores users and their API tokens, in Postgres, SQLite
+// or memory.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pmaterer/meta/user"
+)
+
+// touchInterval is how stale a token's last_used_at may get before using the
+// token moves it on, so that a busy client does not write on every request.
+const touchInterval = time.Minute
+
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresRepository) CreateUser(ctx context.Context, u user.User) (user.User, error) {
+	var created user.User
+	err := r.db.QueryRowContext(ctx, "INSERT INTO users (name) VALUES ($1) RETURNING id, name, created_at", u.Name).
+		Scan(&created.ID, &created.Name, &created.CreatedAt)
+	if err != nil {
+		return created, mapError(err)
+	}
+	return created, nil
+}
+
+func (r *PostgresRepository) GetUserByName(ctx context.Context, name string) (user.User, error) {
+	var u user.User
+	err := r.db.QueryRowContext(ctx, "SELECT id, name, created_at FROM users WHERE name = $1", name).
+		Scan(&u.ID, &u.Name, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, userNotFound(name)
+	}
+	if err != nil {
+		return u, mapError(err)
+	}
+	return u, nil
+}
+
+// CreateToken stores a token for t.UserID under t.Hash and returns it as
+// stored.
+func (r *PostgresRepository) CreateToken(ctx context.Context, t user.Token) (user.Token, error) {
+	var created user.Token
+	query := `INSERT INTO api_tokens (user_id, name, hash) VALUES ($1, $2, $3)
+		RETURNING id, user_id, name, hash, created_at, last_used_at`
+	err := r.db.QueryRowContext(ctx, query, t.UserID, t.Name, t.Hash).Scan(tokenFields(&created)...)
+	if err != nil {
+		return created, mapError(err)
+	}
+	return created, nil
+}
+
+// GetTokens lists the tokens of a user, oldest first.
+func (r *PostgresRepository) GetTokens(ctx context.Context, userID int64) ([]user.Token, error) {
+	return queryTokens(ctx, r.db, `SELECT id, user_id, name, hash, created_at, last_used_at
+		FROM api_tokens WHERE user_id = $1 ORDER BY id`, userID)
+}
+
+// DeleteToken revokes a token of a user. Another user's token is not found.
+func (r *PostgresRepository) DeleteToken(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return mapError(err)
+	}
+	return expectRow(result, id)
+}
+
+// UseToken returns the owner of the token with the given hash, noting that
+// the token was used unless that was noted less than touchInterval ago.
+func (r *PostgresRepository) UseToken(ctx context.Context, hash string) (user.User, error) {
+	var u user.User
+	query := `WITH token AS (
+			SELECT id, user_id, last_used_at FROM api_tokens WHERE hash = $1
+		), touched AS (
+			UPDATE api_tokens SET last_used_at = NOW() FROM token
+			WHERE api_tokens.id = token.id
+				AND (token.last_used_at IS NULL OR token.last_used_at < NOW() - $2 * INTERVAL '1 second')
+		)
+		SELECT u.id, u.name, u.created_at FROM users u JOIN token ON token.user_id = u.id`
+	err := r.db.QueryRowContext(ctx, query, hash, touchInterval.Seconds()).Scan(&u.ID, &u.Name, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, fmt.Errorf("token: %w", user.ErrNotFound)
+	}
+	if err != nil {
+		return u, mapError(err)
+	}
+	return u, nil
+}
+
+func tokenFields(t *user.Token) []interface{} {
+	return []interface{}{&t.ID, &t.UserID, &t.Name, &t.Hash, &t.CreatedAt, &t.LastUsedAt}
+}
+
+func queryTokens(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]user.Token, error) {
+	tokens := []user.Token{}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return tokens, mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t user.Token
+		err = rows.Scan(tokenFields(&t)...)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, t)
+	}
+	err = rows.Err()
+	if err != nil {
+		return tokens, err
+	}
+	return tokens, nil
+}
+
+func userNotFound(name string) error {
+	return fmt.Errorf("user %q: %w", name, user.ErrNotFound)
+}
+
+// expectRow turns a statement that touched no rows into user.ErrNotFound.
+func expectRow(result sql.Result, id int64) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("token %d: %w", id, user.ErrNotFound)
+	}
+	return nil
+}
+
+func mapError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch {
+	case pqErr.Code.Name() == "unique_violation", pqErr.Code.Name() == "foreign_key_violation":
+		return fmt.Errorf("%w: %s", user.ErrConflict, pqErr.Message)
+	case pqErr.Code.Class() == "22", pqErr.Code.Class() == "23":
+		return fmt.Errorf("%w: %s", user.ErrInvalid, pqErr.Message)
+	}
+	return err
+}
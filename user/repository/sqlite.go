@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pmaterer/meta/internal/sqlite"
+	"github.com/pmaterer/meta/user"
+)
+
+// SQLiteRepository stores users and tokens in SQLite, with timestamps kept
+// as fixed-width UTC text as the slips are.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRepository) CreateUser(ctx context.Context, u user.User) (user.User, error) {
+	var created user.User
+	err := r.db.QueryRowContext(ctx, "INSERT INTO users (name, created_at) VALUES (?1, ?2) RETURNING id, name, created_at", u.Name, sqlite.Now()).
+		Scan(&created.ID, &created.Name, sqlite.TimeField(&created.CreatedAt))
+	if err != nil {
+		return created, mapSQLiteError(err)
+	}
+	return created, nil
+}
+
+func (r *SQLiteRepository) GetUserByName(ctx context.Context, name string) (user.User, error) {
+	var u user.User
+	err := r.db.QueryRowContext(ctx, "SELECT id, name, created_at FROM users WHERE name = ?1", name).
+		Scan(&u.ID, &u.Name, sqlite.TimeField(&u.CreatedAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, userNotFound(name)
+	}
+	if err != nil {
+		return u, mapSQLiteError(err)
+	}
+	return u, nil
+}
+
+// CreateToken stores a token for t.UserID under t.Hash and returns it as
+// stored.
+func (r *SQLiteRepository) CreateToken(ctx context.Context, t user.Token) (user.Token, error) {
+	var created user.Token
+	query := `INSERT INTO api_tokens (user_id, name, hash, created_at) VALUES (?1, ?2, ?3, ?4)
+		RETURNING id, user_id, name, hash, created_at, last_used_at`
+	err := r.db.QueryRowContext(ctx, query, t.UserID, t.Name, t.Hash, sqlite.Now()).Scan(sqliteTokenFields(&created)...)
+	if err != nil {
+		return created, mapSQLiteError(err)
+	}
+	return created, nil
+}
+
+// GetTokens lists the tokens of a user, oldest first.
+func (r *SQLiteRepository) GetTokens(ctx context.Context, userID int64) ([]user.Token, error) {
+	tokens := []user.Token{}
+	rows, err := r.db.QueryContext(ctx, `SELECT id, user_id, name, hash, created_at, last_used_at
+		FROM api_tokens WHERE user_id = ?1 ORDER BY id`, userID)
+	if err != nil {
+		return tokens, mapSQLiteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t user.Token
+		err = rows.Scan(sqliteTokenFields(&t)...)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, t)
+	}
+	err = rows.Err()
+	if err != nil {
+		return tokens, err
+	}
+	return tokens, nil
+}
+
+// DeleteToken revokes a token of a user. Another user's token is not found.
+func (r *SQLiteRepository) DeleteToken(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = ?1 AND user_id = ?2", id, userID)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	return expectRow(result, id)
+}
+
+// UseToken returns the owner of the token with the given hash, noting that
+// the token was used unless that was noted less than touchInterval ago.
+// Fixed-width timestamps compare as text.
+func (r *SQLiteRepository) UseToken(ctx context.Context, hash string) (user.User, error) {
+	var u user.User
+	err := r.db.QueryRowContext(ctx, `SELECT u.id, u.name, u.created_at FROM api_tokens t
+		JOIN users u ON u.id = t.user_id WHERE t.hash = ?1`, hash).
+		Scan(&u.ID, &u.Name, sqlite.TimeField(&u.CreatedAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, fmt.Errorf("token: %w", user.ErrNotFound)
+	}
+	if err != nil {
+		return u, mapSQLiteError(err)
+	}
+	now := time.Now()
+	_, err = r.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ?2
+		WHERE hash = ?1 AND (last_used_at IS NULL OR last_used_at < ?3)`,
+		hash, sqlite.Time(now), sqlite.Time(now.Add(-touchInterval)))
+	if err != nil {
+		return u, mapSQLiteError(err)
+	}
+	return u, nil
+}
+
+func sqliteTokenFields(t *user.Token) []interface{} {
+	return []interface{}{&t.ID, &t.UserID, &t.Name, &t.Hash, sqlite.TimeField(&t.CreatedAt), sqlite.NullTimeField(&t.LastUsedAt)}
+}
+
+// mapSQLiteError translates SQLite errors into the user error taxonomy.
+func mapSQLiteError(err error) error {
+	return sqlite.MapError(err, user.ErrConflict, user.ErrInvalid)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pmaterer/meta/user"
+)
+
+type repository interface {
+	CreateUser(ctx context.Context, u user.User) (user.User, error)
+	GetUserByName(ctx context.Context, name string) (user.User, error)
+	CreateToken(ctx context.Context, t user.Token) (user.Token, error)
+	GetTokens(ctx context.Context, userID int64) ([]user.Token, error)
+	DeleteToken(ctx context.Context, userID, id int64) error
+	UseToken(ctx context.Context, hash string) (user.User, error)
+}
+
+type Service struct {
+	repository repository
+}
+
+func NewService(r repository) *Service {
+	return &Service{
+		repository: r,
+	}
+}
+
+func (s *Service) GetUser(ctx context.Context, name string) (user.User, error) {
+	return s.repository.GetUserByName(ctx, name)
+}
+
+// EnsureUser returns the user with the given name, creating it if there is
+// none yet.
+func (s *Service) EnsureUser(ctx context.Context, name string) (user.User, error) {
+	if err := user.ValidateName(name); err != nil {
+		return user.User{}, err
+	}
+	u, err := s.repository.GetUserByName(ctx, name)
+	if !errors.Is(err, user.ErrNotFound) {
+		return u, err
+	}
+	u, err = s.repository.CreateUser(ctx, user.User{Name: name})
+	if errors.Is(err, user.ErrConflict) {
+		// Someone else created it first.
+		return s.repository.GetUserByName(ctx, name)
+	}
+	return u, err
+}
+
+// CreateToken gives a user a new token. The secret in the result is the
+// only copy there will be.
+func (s *Service) CreateToken(ctx context.Context, userID int64, name string) (user.NewToken, error) {
+	if err := user.ValidateTokenName(name); err != nil {
+		return user.NewToken{}, err
+	}
+	secret, hash, err := user.GenerateSecret()
+	if err != nil {
+		return user.NewToken{}, err
+	}
+	created, err := s.repository.CreateToken(ctx, user.Token{UserID: userID, Name: name, Hash: hash})
+	if err != nil {
+		return user.NewToken{}, err
+	}
+	return user.NewToken{Token: created, Secret: secret}, nil
+}
+
+func (s *Service) GetTokens(ctx context.Context, userID int64) ([]user.Token, error) {
+	return s.repository.GetTokens(ctx, userID)
+}
+
+// RevokeToken deletes one of a user's tokens, so that it no longer works.
+func (s *Service) RevokeToken(ctx context.Context, userID, id int64) error {
+	return s.repository.DeleteToken(ctx, userID, id)
+}
+
+// Authenticate returns the owner of the token with the given secret. An
+// unknown secret is user.ErrUnauthorized.
+func (s *Service) Authenticate(ctx context.Context, secret string) (user.User, error) {
+	if !user.IsSecret(secret) {
+		return user.User{}, fmt.Errorf("%w: malformed token", user.ErrUnauthorized)
+	}
+	u, err := s.repository.UseToken(ctx, user.HashSecret(secret))
+	if errors.Is(err, user.ErrNotFound) {
+		return u, fmt.Errorf("%w: unknown or revoked token", user.ErrUnauthorized)
+	}
+	return u, err
+}
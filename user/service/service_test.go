@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pmaterer/meta/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepository struct {
+	CreateUserFunc    func(u user.User) (user.User, error)
+	GetUserByNameFunc func(name string) (user.User, error)
+	CreateTokenFunc   func(t user.Token) (user.Token, error)
+	GetTokensFunc     func(userID int64) ([]user.Token, error)
+	DeleteTokenFunc   func(userID, id int64) error
+	UseTokenFunc      func(hash string) (user.User, error)
+}
+
+func (r *mockRepository) CreateUser(ctx context.Context, u user.User) (user.User, error) {
+	return r.CreateUserFunc(u)
+}
+func (r *mockRepository) GetUserByName(ctx context.Context, name string) (user.User, error) {
+	return r.GetUserByNameFunc(name)
+}
+func (r *mockRepository) CreateToken(ctx context.Context, t user.Token) (user.Token, error) {
+	return r.CreateTokenFunc(t)
+}
+func (r *mockRepository) GetTokens(ctx context.Context, userID int64) ([]user.Token, error) {
+	return r.GetTokensFunc(userID)
+}
+func (r *mockRepository) DeleteToken(ctx context.Context, userID, id int64) error {
+	return r.DeleteTokenFunc(userID, id)
+}
+func (r *mockRepository) UseToken(ctx context.Context, hash string) (user.User, error) {
+	return r.UseTokenFunc(hash)
+}
+
+var errNoUser = fmt.Errorf("user: %w", user.ErrNotFound)
+
+func TestEnsureUser(t *testing.T) {
+	ctx := context.Background()
+	alice := user.User{ID: 1, Name: "alice"}
+
+	created := false
+	s := NewService(&mockRepository{
+		GetUserByNameFunc: func(name string) (user.User, error) { return user.User{}, errNoUser },
+		CreateUserFunc: func(u user.User) (user.User, error) {
+			created = true
+			return user.User{ID: 1, Name: u.Name}, nil
+		},
+	})
+	u, err := s.EnsureUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, alice, u)
+	assert.True(t, created)
+
+	s = NewService(&mockRepository{
+		GetUserByNameFunc: func(name string) (user.User, error) { return alice, nil },
+	})
+	u, err = s.EnsureUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, alice, u)
+
+	// Created by someone else between looking and creating.
+	calls := 0
+	s = NewService(&mockRepository{
+		GetUserByNameFunc: func(name string) (user.User, error) {
+			calls++
+			if calls == 1 {
+				return user.User{}, errNoUser
+			}
+			return alice, nil
+		},
+		CreateUserFunc: func(u user.User) (user.User, error) {
+			return user.User{}, fmt.Errorf("%w: duplicate", user.ErrConflict)
+		},
+	})
+	u, err = s.EnsureUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, alice, u)
+
+	for _, name := range []string{"", "  ", "a\nb", strings.Repeat("x", 101)} {
+		_, err = NewService(&mockRepository{}).EnsureUser(ctx, name)
+		assert.ErrorIs(t, err, user.ErrInvalid, name)
+	}
+}
+
+func TestCreateToken(t *testing.T) {
+	ctx := context.Background()
+	var stored user.Token
+	s := NewService(&mockRepository{
+		CreateTokenFunc: func(t user.Token) (user.Token, error) {
+			stored = t
+			t.ID = 7
+			return t, nil
+		},
+	})
+
+	created, err := s.CreateToken(ctx, 1, "laptop")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), created.ID)
+	assert.Equal(t, int64(1), stored.UserID)
+	assert.Equal(t, "laptop", stored.Name)
+	assert.True(t, strings.HasPrefix(created.Secret, "meta_"))
+	assert.Equal(t, user.HashSecret(created.Secret), stored.Hash)
+	assert.NotContains(t, stored.Hash, created.Secret)
+
+	again, err := s.CreateToken(ctx, 1, "laptop")
+	require.NoError(t, err)
+	assert.NotEqual(t, created.Secret, again.Secret)
+
+	_, err = s.CreateToken(ctx, 1, "two\nlines")
+	assert.ErrorIs(t, err, user.ErrInvalid)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	alice := user.User{ID: 1, Name: "alice"}
+	secret, hash, err := user.GenerateSecret()
+	require.NoError(t, err)
+	s := NewService(&mockRepository{
+		UseTokenFunc: func(h string) (user.User, error) {
+			if h == hash {
+				return alice, nil
+			}
+			return user.User{}, fmt.Errorf("token: %w", user.ErrNotFound)
+		},
+	})
+
+	u, err := s.Authenticate(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, alice, u)
+
+	for _, bad := range []string{"", "meta_", "not-a-token", secret + "x"} {
+		_, err = s.Authenticate(ctx, bad)
+		assert.ErrorIs(t, err, user.ErrUnauthorized, bad)
+	}
+}
@@ -0,0 +1,106 @@
+// Package user holds the people allowed to use meta and the API tokens they
+// prove who they are with.
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type User struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Token is an API token. Only a hash of its secret is kept, so the secret
+// cannot be shown again once the token has been created.
+type Token struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// Name says what the token is for, such as the machine it is used on.
+	Name       string     `json:"name"`
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// NewToken is a token just created, with the secret to hand to its owner.
+type NewToken struct {
+	Token
+	Secret string `json:"token"`
+}
+
+// tokenPrefix starts every secret, so that a leaked one is easy to recognise
+// and a secret from elsewhere is refused without a database lookup.
+const tokenPrefix = "meta_"
+
+// GenerateSecret returns a new random token secret and its hash.
+func GenerateSecret() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, HashSecret(secret), nil
+}
+
+// HashSecret is the hash a token is stored and looked up by. The secrets are
+// random and long, so a fast hash is enough.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsSecret reports whether s looks like a token secret at all.
+func IsSecret(s string) bool {
+	return strings.HasPrefix(s, tokenPrefix) && len(s) > len(tokenPrefix)
+}
+
+// Errors describing why an operation on a user or token failed. They are
+// wrapped with detail, so callers should test with errors.Is.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid")
+	ErrConflict = errors.New("conflict")
+	// ErrUnauthorized means a request came without a valid token.
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// InvalidError wraps a description of bad input as ErrInvalid.
+func InvalidError(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, a...))
+}
+
+// maxNameLength bounds user and token names, in characters.
+const maxNameLength = 100
+
+// ValidateName checks the name of a user.
+func ValidateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return InvalidError("user name must not be blank")
+	}
+	return checkName("user", name)
+}
+
+// ValidateTokenName checks the name of a token, which may be empty.
+func ValidateTokenName(name string) error {
+	return checkName("token", name)
+}
+
+func checkName(what, name string) error {
+	if strings.ContainsAny(name, "\r\n") {
+		return InvalidError("%s name must be a single line", what)
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return InvalidError("%s name must be at most %d characters", what, maxNameLength)
+	}
+	return nil
+}